@@ -0,0 +1,278 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"testing"
+
+	"github.com/stepzen-dev/jsonata-go/jparse"
+)
+
+func TestFocusBinding(t *testing.T) {
+
+	runTestCases(t, testdata.library, []*testCase{
+		{
+			// A focus binding joins the items in two arrays.
+			Expression: "library.loans@$l.books@$b[$l.isbn=$b.isbn].{'title': $b.title, 'customer': $l.customer}",
+			Output: []interface{}{
+				map[string]interface{}{
+					"title":    "Structure and Interpretation of Computer Programs",
+					"customer": "10001",
+				},
+				map[string]interface{}{
+					"title":    "Compilers: Principles, Techniques, and Tools",
+					"customer": "10003",
+				},
+			},
+		},
+		{
+			// Bindings are visible in the predicates of later steps.
+			Expression: "library.loans@$l.books@$b[$l.isbn=$b.isbn].customers[$l.customer=id].{'book': $b.title, 'customer': name}",
+			Output: []interface{}{
+				map[string]interface{}{
+					"book":     "Structure and Interpretation of Computer Programs",
+					"customer": "Joe Doe",
+				},
+				map[string]interface{}{
+					"book":     "Compilers: Principles, Techniques, and Tools",
+					"customer": "Jason Arthur",
+				},
+			},
+		},
+		{
+			Expression: "library.loans@$l.books@$b[$l.isbn=$b.isbn]^(>$l.customer).$b.title",
+			Output: []interface{}{
+				"Compilers: Principles, Techniques, and Tools",
+				"Structure and Interpretation of Computer Programs",
+			},
+		},
+		{
+			Expression: "library.loans@$l.books@$b[$l.isbn=$b.isbn]{$b.title: $l.return}",
+			Output: map[string]interface{}{
+				"Structure and Interpretation of Computer Programs": "2016-12-05",
+				"Compilers: Principles, Techniques, and Tools":      "2016-10-22",
+			},
+		},
+		{
+			// A focus binding does not change the context, so
+			// the next step is evaluated against library.
+			Expression: "library.books@$b.authors",
+			Error:      ErrUndefined,
+		},
+		{
+			// A focus binding can follow an index binding
+			// or another focus binding.
+			Expression: []string{
+				"library.books#$i@$b.$b.title",
+				"library.books@$a@$b.$b.title",
+			},
+			Output: []interface{}{
+				"Structure and Interpretation of Computer Programs",
+				"The C Programming Language",
+				"The AWK Programming Language",
+				"Compilers: Principles, Techniques, and Tools",
+			},
+		},
+		{
+			Expression: "library.books#$i@$b[$i > 1].{'title': $b.title, 'index': $i}",
+			Output: []interface{}{
+				map[string]interface{}{
+					"title": "The AWK Programming Language",
+					"index": float64(2),
+				},
+				map[string]interface{}{
+					"title": "Compilers: Principles, Techniques, and Tools",
+					"index": float64(3),
+				},
+			},
+		},
+		{
+			Expression: "library.loans@$b@$l.{'b': $b.customer, 'l': $l.customer}",
+			Output: []interface{}{
+				map[string]interface{}{
+					"b": "10001",
+					"l": "10001",
+				},
+				map[string]interface{}{
+					"b": "10003",
+					"l": "10003",
+				},
+			},
+		},
+		{
+			// The members of an array constructor are bound
+			// one at a time.
+			Expression: "[1, 2]@$v.$v",
+			Output: []interface{}{
+				float64(1),
+				float64(2),
+			},
+		},
+		{
+			Expression: "[]@$v.$v",
+			Error:      ErrUndefined,
+		},
+		{
+			Expression: "library.books@b",
+			Error: &jparse.Error{
+				Type:     jparse.ErrBindingVariable,
+				Token:    "@",
+				Position: 13,
+			},
+		},
+		{
+			Expression: "library.books[0]@$b",
+			Error: &jparse.Error{
+				Type:     jparse.ErrBindingPredicate,
+				Token:    "@",
+				Position: 16,
+			},
+		},
+	})
+}
+
+func TestIndexBinding(t *testing.T) {
+
+	runTestCases(t, testdata.account, []*testCase{
+		{
+			Expression: "Account.Order#$o.Product.{'Product': `Product Name`, 'Order': $o}",
+			Output: []interface{}{
+				map[string]interface{}{
+					"Product": "Bowler Hat",
+					"Order":   float64(0),
+				},
+				map[string]interface{}{
+					"Product": "Trilby hat",
+					"Order":   float64(0),
+				},
+				map[string]interface{}{
+					"Product": "Bowler Hat",
+					"Order":   float64(1),
+				},
+				map[string]interface{}{
+					"Product": "Cloak",
+					"Order":   float64(1),
+				},
+			},
+		},
+		{
+			// Positions are relative to the context value.
+			Expression: "Account.Order.Product#$i.$i",
+			Output: []interface{}{
+				float64(0),
+				float64(1),
+				float64(0),
+				float64(1),
+			},
+		},
+		{
+			Expression: "Account.Order@$o#$i.Order[OrderID=$o.OrderID].{'Order': OrderID, 'Index': $i}",
+			Output: []interface{}{
+				map[string]interface{}{
+					"Order": "order103",
+					"Index": float64(0),
+				},
+				map[string]interface{}{
+					"Order": "order104",
+					"Index": float64(1),
+				},
+			},
+		},
+	})
+
+	runTestCases(t, testdata.library, []*testCase{
+		{
+			// Predicates after an index binding see the
+			// positions before filtering.
+			Expression: "library.books#$i['Kernighan' in authors].{'title': title, 'index': $i}",
+			Output: []interface{}{
+				map[string]interface{}{
+					"title": "The C Programming Language",
+					"index": float64(1),
+				},
+				map[string]interface{}{
+					"title": "The AWK Programming Language",
+					"index": float64(2),
+				},
+			},
+		},
+		{
+			// Predicates before an index binding are applied
+			// first.
+			Expression: "library.books['Kernighan' in authors]#$i.{'title': title, 'index': $i}",
+			Output: []interface{}{
+				map[string]interface{}{
+					"title": "The C Programming Language",
+					"index": float64(0),
+				},
+				map[string]interface{}{
+					"title": "The AWK Programming Language",
+					"index": float64(1),
+				},
+			},
+		},
+		{
+			Expression: []string{
+				"library.books#$i[-1].title",
+				"library.books#$i[$i = 3].title",
+			},
+			Output: "Compilers: Principles, Techniques, and Tools",
+		},
+		{
+			Expression: "library.books#$i^(>$i).title",
+			Output: []interface{}{
+				"Compilers: Principles, Techniques, and Tools",
+				"The AWK Programming Language",
+				"The C Programming Language",
+				"Structure and Interpretation of Computer Programs",
+			},
+		},
+		{
+			// In a group, a variable bound by more than one
+			// item is an array of their values.
+			Expression: "library.books#$i{$string(copies): $i}",
+			Output: map[string]interface{}{
+				"1": []interface{}{
+					float64(2),
+					float64(3),
+				},
+				"2": float64(0),
+				"3": float64(1),
+			},
+		},
+		{
+			Expression: "[1, 2]#$i.$i",
+			Output: []interface{}{
+				float64(0),
+				float64(1),
+			},
+		},
+		{
+			Expression: "[]#$i",
+			Error:      ErrUndefined,
+		},
+		{
+			Expression: `[]#$i{"title": $i}`,
+			Output:     map[string]interface{}{},
+		},
+		{
+			// As in nothing{title: $i}, the key is evaluated
+			// against undefined.
+			Expression: "[]#$i{title: $i}",
+			Error: &EvalError{
+				Type:  ErrIllegalKey,
+				Token: "title",
+			},
+		},
+		{
+			Expression: "library.books#1",
+			Error: &jparse.Error{
+				Type:     jparse.ErrBindingVariable,
+				Token:    "#",
+				Position: 13,
+			},
+		},
+	})
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/stepzen-dev/jsonata-go/jparse"
+)
+
+// DefaultCacheSize is the initial size of the cache used by
+// Compile (see CompileCache).
+const DefaultCacheSize = 500
+
+var defaultCache = NewCache(DefaultCacheSize)
+
+// CompileCache returns the Cache used by Compile, CompileWith
+// and the $eval function. Use its methods to get statistics
+// or to change its size. A size of zero disables caching.
+func CompileCache() *Cache {
+	return defaultCache
+}
+
+// A Cache holds the parsed and optimized syntax trees of
+// JSONata expressions, keyed by the text of the expression.
+// Syntax trees are not modified by evaluation, so a cached
+// tree can be shared by any number of Exprs. When the cache
+// is full, the least recently used tree is removed to make
+// room for a new one. Expressions that fail to parse are not
+// cached.
+//
+// A Cache is safe for concurrent use by multiple goroutines.
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	lru   *list.List
+	items map[string]*list.Element
+	stats CacheStats
+}
+
+// CacheStats holds statistics for a Cache.
+type CacheStats struct {
+
+	// Hits is the number of lookups that found the
+	// expression in the cache.
+	Hits uint64
+
+	// Misses is the number of lookups that had to parse
+	// the expression.
+	Misses uint64
+
+	// Evictions is the number of expressions that have been
+	// removed to make room for others.
+	Evictions uint64
+
+	// Len is the number of expressions in the cache.
+	Len int
+
+	// Size is the maximum number of expressions that the
+	// cache can hold.
+	Size int
+}
+
+type cacheEntry struct {
+	expr string
+	node jparse.Node
+}
+
+// NewCache returns a Cache that holds up to size expressions.
+// A Cache with a size of zero does not store anything.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:  max(size, 0),
+		lru:   list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// Parse returns the syntax tree for expr, parsing it only if
+// it is not already in the cache. Errors are the same as those
+// returned by jparse.Parse.
+func (c *Cache) Parse(expr string) (jparse.Node, error) {
+
+	if node, ok := c.get(expr); ok {
+		return node, nil
+	}
+
+	// Parse outside of the lock so that a slow parse does
+	// not hold up other goroutines. If several goroutines
+	// parse the same expression at once, they all count as
+	// misses and the last one to finish wins.
+	node, err := jparse.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.put(expr, node)
+	return node, nil
+}
+
+// Stats returns statistics for the cache.
+func (c *Cache) Stats() CacheStats {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Len = c.lru.Len()
+	stats.Size = c.size
+
+	return stats
+}
+
+// Resize changes the maximum number of expressions in the
+// cache. If the cache is larger than the new size, the least
+// recently used expressions are removed. Removals made by
+// Resize do not count as evictions.
+func (c *Cache) Resize(size int) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.size = max(size, 0)
+	for c.lru.Len() > c.size {
+		c.removeOldest()
+	}
+}
+
+// Clear removes all of the expressions from the cache and
+// resets its statistics.
+func (c *Cache) Clear() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.items = map[string]*list.Element{}
+	c.stats = CacheStats{}
+}
+
+func (c *Cache) get(expr string) (jparse.Node, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[expr]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).node, true
+}
+
+func (c *Cache) put(expr string, node jparse.Node) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size == 0 {
+		return
+	}
+
+	if elem, ok := c.items[expr]; ok {
+		elem.Value.(*cacheEntry).node = node
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	for c.lru.Len() >= c.size {
+		c.removeOldest()
+		c.stats.Evictions++
+	}
+
+	c.items[expr] = c.lru.PushFront(&cacheEntry{
+		expr: expr,
+		node: node,
+	})
+}
+
+func (c *Cache) removeOldest() {
+	elem := c.lru.Back()
+	c.lru.Remove(elem)
+	delete(c.items, elem.Value.(*cacheEntry).expr)
+}
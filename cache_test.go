@@ -0,0 +1,141 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+
+	c := NewCache(2)
+
+	parse := func(expr string) {
+		if _, err := c.Parse(expr); err != nil {
+			t.Fatalf("%s: %s", expr, err)
+		}
+	}
+
+	parse("a")
+	parse("b")
+	parse("a")
+	parse("c") // evicts b, the least recently used
+	parse("a")
+	parse("b")
+
+	expected := CacheStats{
+		Hits:      2,
+		Misses:    4,
+		Evictions: 2,
+		Len:       2,
+		Size:      2,
+	}
+
+	if got := c.Stats(); got != expected {
+		t.Errorf("expected stats %+v, got %+v", expected, got)
+	}
+
+	// Errors are returned but not cached.
+	for i := 0; i < 2; i++ {
+		if _, err := c.Parse("a +"); err == nil {
+			t.Errorf("expected an error parsing %q", "a +")
+		}
+	}
+
+	if got := c.Stats(); got.Misses != 6 || got.Len != 2 {
+		t.Errorf("expected 6 misses and 2 entries, got %+v", got)
+	}
+
+	c.Resize(1)
+	if got := c.Stats(); got.Len != 1 || got.Size != 1 || got.Evictions != 2 {
+		t.Errorf("expected 1 entry and 2 evictions after Resize, got %+v", got)
+	}
+
+	c.Resize(0)
+	parse("a")
+	parse("a")
+	if got := c.Stats(); got.Len != 0 || got.Hits != 2 {
+		t.Errorf("expected an empty cache with no new hits, got %+v", got)
+	}
+
+	c.Clear()
+	if got := c.Stats(); got != (CacheStats{}) {
+		t.Errorf("expected empty stats after Clear, got %+v", got)
+	}
+}
+
+func TestCacheShared(t *testing.T) {
+
+	c := NewCache(10)
+
+	n1, err := c.Parse("$sum(a)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n2, err := c.Parse("$sum(a)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n1 != n2 {
+		t.Errorf("expected the same syntax tree for the same expression")
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+
+	c := NewCache(5)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				expr := fmt.Sprintf("a + %d", (i+j)%10)
+				if _, err := c.Parse(expr); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Hits+stats.Misses != 800 {
+		t.Errorf("expected 800 lookups, got %+v", stats)
+	}
+	if stats.Len > 5 {
+		t.Errorf("expected at most 5 entries, got %d", stats.Len)
+	}
+}
+
+func TestCacheEval(t *testing.T) {
+
+	before := CompileCache().Stats()
+
+	e := MustCompile(`$map([1, 2, 3, 4], function($v) { $eval("$ * 2", $v) })`)
+
+	res, err := e.Eval(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []interface{}{2.0, 4.0, 6.0, 8.0}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %v, got %v", expected, res)
+	}
+
+	// The expression passed to $eval is parsed once.
+	after := CompileCache().Stats()
+	if hits := after.Hits - before.Hits; hits < 3 {
+		t.Errorf("expected at least 3 cache hits, got %d", hits)
+	}
+}
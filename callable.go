@@ -5,11 +5,14 @@
 package jsonata
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/stepzen-dev/jsonata-go/jlib"
 	"github.com/stepzen-dev/jsonata-go/jparse"
@@ -24,10 +27,6 @@ func (n callableName) Name() string {
 	return n.name
 }
 
-func (n *callableName) SetName(s string) {
-	n.name = s
-}
-
 type callableMarshaler struct{}
 
 func (callableMarshaler) MarshalJSON() ([]byte, error) {
@@ -73,6 +72,16 @@ func newGoCallableParam(typ reflect.Type) goCallableParam {
 	return param
 }
 
+// isArray reports whether the parameter takes a slice or an
+// array, or an optional slice or array.
+func (p goCallableParam) isArray() bool {
+	t := p.t
+	if p.isOpt {
+		t = p.optType.t
+	}
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t != typeByteSlice
+}
+
 // A goCallable represents a built-in or third party Go function.
 // It implements the Callable interface.
 type goCallable struct {
@@ -84,6 +93,9 @@ type goCallable struct {
 	undefinedHandler jtypes.ArgHandler
 	contextHandler   jtypes.ArgHandler
 	context          reflect.Value
+	hasCtx           bool
+	ctx              context.Context
+	sequential       bool
 }
 
 func newGoCallable(name string, ext Extension) (*goCallable, error) {
@@ -95,7 +107,7 @@ func newGoCallable(name string, ext Extension) (*goCallable, error) {
 	v := reflect.ValueOf(ext.Func)
 	t := v.Type()
 
-	params := makeGoCallableParams(t)
+	params, hasCtx := makeGoCallableParams(t)
 	if err := validateGoCallableParams(params, t.IsVariadic()); err != nil {
 		return nil, err
 	}
@@ -109,10 +121,15 @@ func newGoCallable(name string, ext Extension) (*goCallable, error) {
 		isVariadic:       t.IsVariadic(),
 		undefinedHandler: ext.UndefinedHandler,
 		contextHandler:   ext.EvalContextHandler,
+		hasCtx:           hasCtx,
+		sequential:       ext.Sequential,
 	}, nil
 }
 
-var typeError = reflect.TypeOf((*error)(nil)).Elem()
+var (
+	typeError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
 
 func validateGoCallableFunc(fn interface{}) error {
 
@@ -178,11 +195,21 @@ func validateGoCallableParams(params []goCallableParam, isVariadic bool) error {
 	return nil
 }
 
-func makeGoCallableParams(typ reflect.Type) []goCallableParam {
+// makeGoCallableParams returns the JSONata parameters for a
+// Go function. If the function's first parameter is of type
+// context.Context, it is excluded from the results and the
+// second return value is true. The context is supplied by the
+// evaluator, not by the caller.
+func makeGoCallableParams(typ reflect.Type) ([]goCallableParam, bool) {
 
-	paramCount := typ.NumIn()
+	var offset int
+	if typ.NumIn() > 0 && typ.In(0) == typeContext {
+		offset = 1
+	}
+
+	paramCount := typ.NumIn() - offset
 	if paramCount == 0 {
-		return nil
+		return nil, offset > 0
 	}
 
 	isVariadic := typ.IsVariadic()
@@ -190,7 +217,7 @@ func makeGoCallableParams(typ reflect.Type) []goCallableParam {
 
 	for i := range params {
 
-		t := typ.In(i)
+		t := typ.In(i + offset)
 		if isVariadic && i == paramCount-1 {
 			// The type of the final parameter in a variadic
 			// function is a slice of the declared type. Call
@@ -201,7 +228,7 @@ func makeGoCallableParams(typ reflect.Type) []goCallableParam {
 		params[i] = newGoCallableParam(t)
 	}
 
-	return params
+	return params, offset > 0
 }
 
 func (c *goCallable) SetContext(context reflect.Value) {
@@ -214,9 +241,7 @@ func (c *goCallable) ParamCount() int {
 
 func (c *goCallable) Call(argv []reflect.Value) (reflect.Value, error) {
 
-	var err error
-
-	argv, err = c.validateArgCount(argv)
+	argv, hasContext, err := c.validateArgCount(argv)
 	if err != nil {
 		if err == jtypes.ErrUndefined {
 			err = nil
@@ -224,17 +249,33 @@ func (c *goCallable) Call(argv []reflect.Value) (reflect.Value, error) {
 		return undefined, err
 	}
 
-	argv, err = c.validateArgTypes(argv)
+	argv, err = c.validateArgTypes(argv, hasContext)
 	if err != nil {
 		return undefined, err
 	}
 
+	if c.hasCtx {
+		ctx := c.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		argv = append([]reflect.Value{reflect.ValueOf(ctx)}, argv...)
+	}
+
 	results := c.fn.Call(argv)
 
 	if len(results) == 2 && !results[1].IsNil() {
 		err := results[1].Interface().(error)
-		if err == jtypes.ErrUndefined {
+		switch {
+		case err == jtypes.ErrUndefined:
 			err = nil
+		case isContextError(err):
+			err = newCancelError(err)
+		case errorLocation(err) == nil:
+			// Errors from JSONata functions called by fn
+			// already have a location. Other errors are
+			// located at the call to fn.
+			err = newCallError(c.Name(), err)
 		}
 		return undefined, err
 	}
@@ -242,13 +283,16 @@ func (c *goCallable) Call(argv []reflect.Value) (reflect.Value, error) {
 	return results[0], nil
 }
 
-func (c *goCallable) validateArgCount(argv []reflect.Value) ([]reflect.Value, error) {
+// validateArgCount returns the arguments to pass to the
+// function, including the evaluation context if the function's
+// EvalContextHandler asks for it. The boolean return value is
+// true if the context was added as the first argument.
+func (c *goCallable) validateArgCount(argv []reflect.Value) ([]reflect.Value, bool, error) {
 
 	argc := len(argv)
 
-	if c.contextHandler != nil && c.contextHandler(argv) {
-		// TODO: Return an error if the evaluation context
-		// is not the correct type.
+	hasContext := c.contextHandler != nil && c.contextHandler(argv)
+	if hasContext {
 		newargv := make([]reflect.Value, 1, len(argv)+1)
 		newargv[0] = c.context
 		argv = append(newargv, argv...)
@@ -258,7 +302,7 @@ func (c *goCallable) validateArgCount(argv []reflect.Value) ([]reflect.Value, er
 		// TODO: Validate the other arguments before doing
 		// this. Otherwise we mask errors with the other
 		// arguments.
-		return nil, jtypes.ErrUndefined
+		return nil, false, jtypes.ErrUndefined
 	}
 
 	paramCount := len(c.params)
@@ -271,17 +315,17 @@ func (c *goCallable) validateArgCount(argv []reflect.Value) ([]reflect.Value, er
 	}
 
 	if c.isVariadic && len(argv) < paramCount-1 {
-		return nil, newArgCountError(c, argc)
+		return nil, false, newArgCountError(c, argc)
 	}
 
 	if !c.isVariadic && len(argv) != paramCount {
-		return nil, newArgCountError(c, argc)
+		return nil, false, newArgCountError(c, argc)
 	}
 
-	return argv, nil
+	return argv, hasContext, nil
 }
 
-func (c *goCallable) validateArgTypes(argv []reflect.Value) ([]reflect.Value, error) {
+func (c *goCallable) validateArgTypes(argv []reflect.Value, hasContext bool) ([]reflect.Value, error) {
 
 	var ok bool
 	paramCount := len(c.params)
@@ -310,7 +354,10 @@ func (c *goCallable) validateArgTypes(argv []reflect.Value) ([]reflect.Value, er
 
 		v, ok = processGoCallableArg(v, c.params[j])
 		if !ok {
-			return nil, newArgTypeError(c, i+1)
+			err := newArgTypeError(c, i+1)
+			err.Context = hasContext && i == 0
+			err.Array = c.params[j].isArray() && jtypes.IsArray(v)
+			return nil, err
 		}
 
 		argv[i] = v
@@ -322,6 +369,7 @@ func (c *goCallable) validateArgTypes(argv []reflect.Value) ([]reflect.Value, er
 var (
 	typeString    = reflect.TypeOf((*string)(nil)).Elem()
 	typeByteSlice = reflect.TypeOf((*[]byte)(nil)).Elem()
+	typeBigRatPtr = reflect.TypeOf((*big.Rat)(nil))
 )
 
 func processGoCallableArg(arg reflect.Value, param goCallableParam) (reflect.Value, bool) {
@@ -348,6 +396,8 @@ func processGoCallableArg(arg reflect.Value, param goCallableParam) (reflect.Val
 		return arg, true
 	case paramType == jtypes.TypeValue:
 		return reflect.ValueOf(arg), true
+	case jtypes.IsJSONNumber(arg), jtypes.IsDecimal(arg), paramType == typeBigRatPtr:
+		return processNumberArg(arg, paramType)
 	case argType.ConvertibleTo(paramType):
 		// Only allow conversion to a string if the source type
 		// is a byte slice. Go can convert other types (such as
@@ -366,6 +416,35 @@ func processGoCallableArg(arg reflect.Value, param goCallableParam) (reflect.Val
 	return undefined, false
 }
 
+// processNumberArg converts a json.Number or a decimal to a
+// numeric parameter type, or any number to a *big.Rat. Integer
+// parameters receive the exact value of the number, if it has
+// one.
+func processNumberArg(arg reflect.Value, paramType reflect.Type) (reflect.Value, bool) {
+
+	if paramType == typeBigRatPtr {
+		if r, ok := jtypes.AsDecimal(arg); ok {
+			return reflect.ValueOf(r), true
+		}
+		return undefined, false
+	}
+
+	switch paramType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := jtypes.AsInteger(arg); ok {
+			return reflect.ValueOf(n).Convert(paramType), true
+		}
+		fallthrough
+	case reflect.Float32, reflect.Float64:
+		if n, ok := jtypes.AsNumber(arg); ok {
+			return reflect.ValueOf(n).Convert(paramType), true
+		}
+	}
+
+	return undefined, false
+}
+
 func processUndefinedArg(param goCallableParam) (reflect.Value, bool) {
 
 	switch {
@@ -419,9 +498,52 @@ func (f *lambdaCallable) ParamCount() int {
 
 func (f *lambdaCallable) Call(argv []reflect.Value) (reflect.Value, error) {
 
+	var state *evalState
+	if f.env != nil {
+		state = f.env.state
+	}
+
+	if err := state.enter(f.Name()); err != nil {
+		return undefined, err
+	}
+	defer state.exit()
+
+	profiling := state.profiler() != nil
+
+	// Calls to other lambdas in tail position are returned
+	// by f.call rather than made recursively. Make them here
+	// instead, so that tail recursion does not grow the stack.
+	for {
+		var start time.Time
+		if profiling {
+			start = state.profileCallStart(f.Name())
+		}
+
+		v, tc, err := f.call(argv)
+
+		if profiling {
+			state.profileCall(f.Name(), start, v)
+		}
+
+		if err != nil || tc == nil {
+			return v, err
+		}
+
+		f, argv = tc.fn, tc.argv
+	}
+}
+
+func (f *lambdaCallable) call(argv []reflect.Value) (reflect.Value, *tailCall, error) {
+
 	argv, err := f.validateArgs(argv)
 	if err != nil {
-		return undefined, err
+		return undefined, nil, err
+	}
+
+	if f.env != nil {
+		if err := f.env.state.checkCancel(); err != nil {
+			return undefined, nil, err
+		}
 	}
 
 	// Create a local scope for this function's arguments.
@@ -443,8 +565,16 @@ func (f *lambdaCallable) Call(argv []reflect.Value) (reflect.Value, error) {
 		env.bind(name, v)
 	}
 
-	// Evaluate the function body.
-	return eval(f.body, f.context, env)
+	// Evaluate the function body. Tail calls are disabled
+	// when tracing, so that every node is exited after the
+	// nodes it contains, and when profiling, so that every
+	// node goes through eval and is counted.
+	if evalTracer(env) != nil || env.state.profiler() != nil {
+		v, err := eval(f.body, f.context, env)
+		return v, nil, err
+	}
+
+	return evalTail(f.body, f.context, env)
 }
 
 func (f *lambdaCallable) validateArgs(argv []reflect.Value) ([]reflect.Value, error) {
@@ -455,20 +585,19 @@ func (f *lambdaCallable) validateArgs(argv []reflect.Value) ([]reflect.Value, er
 		return argv, nil
 	}
 
-	var err error
-
-	if argv, err = f.validateArgCount(argv); err != nil {
+	argv, hasContext, err := f.validateArgCount(argv)
+	if err != nil {
 		return nil, err
 	}
 
-	if argv, err = f.validateArgTypes(argv); err != nil {
+	if argv, err = f.validateArgTypes(argv, hasContext); err != nil {
 		return nil, err
 	}
 
 	return f.wrapVariadicArgs(argv), nil
 }
 
-func (f *lambdaCallable) validateArgCount(argv []reflect.Value) ([]reflect.Value, error) {
+func (f *lambdaCallable) validateArgCount(argv []reflect.Value) ([]reflect.Value, bool, error) {
 
 	// argc is the number of arguments originally passed to
 	// the function.
@@ -481,7 +610,8 @@ func (f *lambdaCallable) validateArgCount(argv []reflect.Value) ([]reflect.Value
 	// If there are fewer arguments than parameters and the
 	// first parameter is contextable, insert the evaluation
 	// context into the argument list.
-	if argc < paramCount && f.params[0].Option == jparse.ParamContextable {
+	hasContext := argc < paramCount && f.params[0].Option == jparse.ParamContextable
+	if hasContext {
 		argv = append([]reflect.Value{f.context}, argv...)
 	}
 
@@ -507,13 +637,13 @@ func (f *lambdaCallable) validateArgCount(argv []reflect.Value) ([]reflect.Value
 	// extra arguments on a non-variadic function, return an
 	// error.
 	if argCount < paramCount || (argCount > paramCount && !isVar) {
-		return nil, newArgCountError(f, argc)
+		return nil, false, newArgCountError(f, argc)
 	}
 
-	return argv, nil
+	return argv, hasContext, nil
 }
 
-func (f *lambdaCallable) validateArgTypes(argv []reflect.Value) ([]reflect.Value, error) {
+func (f *lambdaCallable) validateArgTypes(argv []reflect.Value, hasContext bool) ([]reflect.Value, error) {
 
 	paramCount := len(f.params)
 
@@ -539,7 +669,10 @@ func (f *lambdaCallable) validateArgTypes(argv []reflect.Value) ([]reflect.Value
 		}
 
 		if !f.validArgType(arg, param) {
-			return nil, newArgTypeError(f, i+1)
+			err := newArgTypeError(f, i+1)
+			err.Context = hasContext && i == 0
+			err.Array = param.Type&jparse.ParamTypeArray != 0 && jtypes.IsArray(arg)
+			return nil, err
 		}
 	}
 
@@ -930,6 +1063,91 @@ func (*undefinedCallable) ParamCount() int {
 	return 0
 }
 
+var typeEvalCallablePtr = reflect.TypeOf((*evalCallable)(nil))
+
+// An evalCallable implements the $eval function, which parses
+// a string and evaluates it as a JSONata expression. The
+// expression is evaluated in a child of the environment that
+// $eval is called from, so it has access to the same functions
+// and variables as the caller. It is also subject to the same
+// limits (see EvalOptions).
+type evalCallable struct {
+	callableName
+	callableMarshaler
+	env     *environment
+	context reflect.Value
+
+	// restricted is true if some functions are forbidden
+	// (see CompileOptions), in which case expressions must
+	// be checked before they are evaluated.
+	restricted bool
+}
+
+func newEvalCallable(env *environment, restricted bool) *evalCallable {
+	return &evalCallable{
+		callableName: callableName{
+			name: "eval",
+		},
+		env:        env,
+		restricted: restricted,
+	}
+}
+
+func (f *evalCallable) ParamCount() int {
+	return 2
+}
+
+func (f *evalCallable) Call(argv []reflect.Value) (reflect.Value, error) {
+
+	if len(argv) < 1 || len(argv) > 2 {
+		return undefined, newArgCountError(f, len(argv))
+	}
+
+	state := f.env.state
+	if state != nil && state.opts.DisableEval {
+		return undefined, newEvalError(ErrEvalDisabled, f.Name(), nil)
+	}
+
+	if argv[0] == undefined {
+		return undefined, nil
+	}
+
+	s, ok := jtypes.AsString(argv[0])
+	if !ok {
+		return undefined, newArgTypeError(f, 1)
+	}
+
+	node, err := defaultCache.Parse(s)
+	if err != nil {
+		return undefined, err
+	}
+
+	if f.restricted {
+		if err := checkEvalPolicy(node, s, f.env); err != nil {
+			return undefined, err
+		}
+	}
+
+	// The expression is evaluated against the context of
+	// the call, unless a different input is provided.
+	input := f.context
+	if len(argv) > 1 && argv[1].IsValid() {
+		input = argv[1]
+	}
+
+	// Count $eval as a function call, so that expressions
+	// that evaluate themselves cannot recurse forever.
+	if err := state.enter(f.Name()); err != nil {
+		return undefined, err
+	}
+	defer state.exit()
+
+	env := newEnvironment(f.env, 0)
+	env.src = s
+
+	return eval(node, input, env)
+}
+
 // A chainCallable provides function composition.
 type chainCallable struct {
 	callableName
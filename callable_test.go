@@ -5,6 +5,7 @@
 package jsonata
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -321,6 +322,39 @@ type goCallableTest struct {
 
 func TestGoCallable(t *testing.T) {
 	testGoCallable(t, []goCallableTest{
+		{
+			// A leading context.Context parameter is supplied
+			// by the evaluator and is not counted as an argument.
+			Name: "context",
+			Ext: Extension{
+				Func: func(ctx context.Context, s string) string {
+					if ctx == nil {
+						return ""
+					}
+					return s
+				},
+			},
+			Args: []interface{}{
+				"hello",
+			},
+			Output: "hello",
+		},
+		{
+			// Error: Too many arguments (context parameter)
+			Name: "contextArgCount",
+			Ext: Extension{
+				Func: func(context.Context, string) string { return "" },
+			},
+			Args: []interface{}{
+				"hello",
+				"world",
+			},
+			Error: &ArgCountError{
+				Func:     "contextArgCount",
+				Expected: 1,
+				Received: 2,
+			},
+		},
 		{
 			// Error: Not enough arguments
 			Name: "argCount1",
@@ -587,7 +621,7 @@ func testGoCallable(t *testing.T, tests []goCallableTest) {
 			}
 		}
 
-		if !reflect.DeepEqual(err, test.Error) {
+		if err := clearLocation(err); !reflect.DeepEqual(err, test.Error) {
 			t.Errorf("%s: expected error %v, got %v", test.Name, test.Error, err)
 		}
 	}
@@ -1568,6 +1602,7 @@ func TestLambdaCallable(t *testing.T) {
 			Error: &ArgTypeError{
 				Func:  "array4",
 				Which: 1,
+				Array: true,
 			},
 		},
 		{
@@ -1961,7 +1996,7 @@ func testPartialCallableTest(t *testing.T, tests []partialCallableTest) {
 			t.Errorf("partial %d: expected %v, got %v", i+1, test.Output, v)
 		}
 
-		if !reflect.DeepEqual(err, test.Error) {
+		if !reflect.DeepEqual(clearLocation(err), test.Error) {
 			t.Errorf("partial %d: expected error %v, got %v", i+1, test.Error, err)
 		}
 	}
@@ -2342,7 +2377,7 @@ func testTransformationCallable(t *testing.T, tests []transformationCallableTest
 			}
 		}
 
-		if !reflect.DeepEqual(err, test.Error) {
+		if !reflect.DeepEqual(clearLocation(err), test.Error) {
 			t.Errorf("transform %d: expected error %v, got %v", i+1, test.Error, err)
 		}
 	}
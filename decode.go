@@ -0,0 +1,592 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/stepzen-dev/jsonata-go/jtypes"
+)
+
+var (
+	typeTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	typeJSONNumber      = reflect.TypeOf((*json.Number)(nil)).Elem()
+)
+
+// A decoder copies the result of an evaluation into a Go
+// value. It follows the rules used by json.Unmarshal, as if
+// the result had been encoded as JSON and then decoded into
+// the target. Like json.Unmarshal, it skips values that do
+// not fit their target, carries on with the rest and reports
+// the first such error.
+type decoder struct {
+	fields []string
+	parent reflect.Type
+	err    error
+}
+
+// decodeResult stores the result of an evaluation in the
+// value pointed to by out.
+func decodeResult(result interface{}, out interface{}) error {
+
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &json.InvalidUnmarshalError{Type: reflect.TypeOf(out)}
+	}
+
+	var d decoder
+	if err := d.decode(reflect.ValueOf(result), rv.Elem()); err != nil {
+		return err
+	}
+
+	return d.err
+}
+
+// decode stores the value src in dst. It returns an error
+// only if decoding cannot continue. Type mismatches are
+// recorded in d.err.
+func (d *decoder) decode(src reflect.Value, dst reflect.Value) error {
+
+	src = jtypes.Resolve(src)
+
+	// A nil value, whether an untyped nil or a nil pointer,
+	// is a JSON null.
+	isNull := !src.IsValid() || (src.Kind() == reflect.Ptr && src.IsNil())
+
+	ju, tu, dst := indirect(dst, isNull)
+
+	if ju != nil {
+		return d.callUnmarshalJSON(src, ju)
+	}
+
+	if tu != nil {
+		if s, ok := jtypes.AsString(src); ok {
+			d.saveError(tu.UnmarshalText([]byte(s)))
+		} else {
+			d.saveTypeError(describe(src), dst.Type())
+		}
+		return nil
+	}
+
+	if isNull {
+		switch dst.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+		return nil
+	}
+
+	if jtypes.IsCallable(src) {
+		d.saveTypeError("function", dst.Type())
+		return nil
+	}
+
+	switch {
+	case jtypes.IsBool(src):
+		d.decodeBool(src, dst)
+	case jtypes.IsString(src):
+		d.decodeString(src, dst)
+	case jtypes.IsNumber(src):
+		d.decodeNumber(src, dst)
+	case jtypes.IsArray(src):
+		return d.decodeArray(src, dst)
+	case jtypes.IsMap(src), jtypes.IsStruct(src):
+		return d.decodeObject(src, dst)
+	default:
+		return fmt.Errorf("cannot decode value of type %s", src.Type())
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeBool(src reflect.Value, dst reflect.Value) {
+
+	b, _ := jtypes.AsBool(src)
+
+	switch {
+	case dst.Kind() == reflect.Bool:
+		dst.SetBool(b)
+	case dst.Kind() == reflect.Interface && dst.NumMethod() == 0:
+		dst.Set(reflect.ValueOf(b))
+	default:
+		d.saveTypeError("bool", dst.Type())
+	}
+}
+
+func (d *decoder) decodeString(src reflect.Value, dst reflect.Value) {
+
+	s, _ := jtypes.AsString(src)
+
+	switch {
+	case dst.Kind() == reflect.String:
+		dst.SetString(s)
+	case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+		// Like encoding/json, decode byte slices from
+		// base64 strings.
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			d.saveError(err)
+			return
+		}
+		dst.SetBytes(b)
+	case dst.Kind() == reflect.Interface && dst.NumMethod() == 0:
+		dst.Set(reflect.ValueOf(s))
+	default:
+		d.saveTypeError("string", dst.Type())
+	}
+}
+
+func (d *decoder) decodeNumber(src reflect.Value, dst reflect.Value) {
+
+	n, _ := jtypes.AsNumber(src)
+
+	// A json.Number may hold an integer that is too large
+	// to be represented exactly as a float64.
+	if jtypes.IsJSONNumber(src) {
+		s := jtypes.Resolve(src).String()
+		switch {
+		case dst.Type() == typeJSONNumber:
+			dst.SetString(s)
+			return
+		case dst.Kind() == reflect.Interface && dst.NumMethod() == 0:
+			dst.Set(reflect.ValueOf(json.Number(s)))
+			return
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := asInt64(src, n)
+		if !ok || dst.OverflowInt(i) {
+			d.saveTypeError("number "+formatNumber(n), dst.Type())
+			return
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, ok := asUint64(src, n)
+		if !ok || dst.OverflowUint(u) {
+			d.saveTypeError("number "+formatNumber(n), dst.Type())
+			return
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if dst.OverflowFloat(n) {
+			d.saveTypeError("number "+formatNumber(n), dst.Type())
+			return
+		}
+		dst.SetFloat(n)
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			d.saveTypeError("number", dst.Type())
+			return
+		}
+		dst.Set(reflect.ValueOf(n))
+	default:
+		d.saveTypeError("number", dst.Type())
+	}
+}
+
+func (d *decoder) decodeArray(src reflect.Value, dst reflect.Value) error {
+
+	n := src.Len()
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			d.saveTypeError("array", dst.Type())
+			return nil
+		}
+		results := make([]interface{}, n)
+		for i := range results {
+			if err := d.decode(src.Index(i), reflect.ValueOf(&results[i]).Elem()); err != nil {
+				return err
+			}
+		}
+		dst.Set(reflect.ValueOf(results))
+		return nil
+
+	case reflect.Slice:
+		results := reflect.MakeSlice(dst.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := d.decode(src.Index(i), results.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(results)
+		return nil
+
+	case reflect.Array:
+		for i := 0; i < dst.Len(); i++ {
+			if i < n {
+				if err := d.decode(src.Index(i), dst.Index(i)); err != nil {
+					return err
+				}
+			} else {
+				dst.Index(i).Set(reflect.Zero(dst.Type().Elem()))
+			}
+		}
+		return nil
+
+	default:
+		d.saveTypeError("array", dst.Type())
+		return nil
+	}
+}
+
+func (d *decoder) decodeObject(src reflect.Value, dst reflect.Value) error {
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			d.saveTypeError("object", dst.Type())
+			return nil
+		}
+		results := map[string]interface{}{}
+		err := eachEntry(src, func(key string, val reflect.Value) error {
+			var v interface{}
+			if err := d.decodeField(key, val, reflect.ValueOf(&v).Elem()); err != nil {
+				return err
+			}
+			results[key] = v
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(results))
+		return nil
+
+	case reflect.Map:
+		t := dst.Type()
+		if !isMapKeyType(t.Key()) {
+			d.saveTypeError("object", t)
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(t))
+		}
+		return eachEntry(src, func(key string, val reflect.Value) error {
+			k, err := mapKey(key, t.Key())
+			if err != nil {
+				d.saveTypeError("number "+key, t.Key())
+				return nil
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if err := d.decodeField(key, val, elem); err != nil {
+				return err
+			}
+			dst.SetMapIndex(k, elem)
+			return nil
+		})
+
+	case reflect.Struct:
+		fields := jtypes.StructFields(dst.Type())
+		return eachEntry(src, func(key string, val reflect.Value) error {
+			f, ok := findField(fields, key)
+			if !ok {
+				// Like encoding/json, ignore unknown keys.
+				return nil
+			}
+			fv, err := fieldByIndex(dst, f.Index)
+			if err != nil {
+				d.saveError(err)
+				return nil
+			}
+			parent := d.parent
+			d.parent = dst.Type()
+			err = d.decodeField(f.Name, val, fv)
+			d.parent = parent
+			return err
+		})
+
+	default:
+		d.saveTypeError("object", dst.Type())
+		return nil
+	}
+}
+
+// decodeField decodes the value of an object key, keeping
+// track of the key for use in error messages.
+func (d *decoder) decodeField(key string, src reflect.Value, dst reflect.Value) error {
+	d.fields = append(d.fields, key)
+	err := d.decode(src, dst)
+	d.fields = d.fields[:len(d.fields)-1]
+	return err
+}
+
+func (d *decoder) callUnmarshalJSON(src reflect.Value, u json.Unmarshaler) error {
+
+	var v interface{}
+	if src.IsValid() && src.CanInterface() {
+		v = src.Interface()
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	d.saveError(u.UnmarshalJSON(b))
+	return nil
+}
+
+func (d *decoder) saveTypeError(value string, typ reflect.Type) {
+	err := &json.UnmarshalTypeError{
+		Value: value,
+		Type:  typ,
+	}
+	if d.parent != nil {
+		err.Struct = d.parent.Name()
+		err.Field = strings.Join(d.fields, ".")
+	}
+	d.saveError(err)
+}
+
+func (d *decoder) saveError(err error) {
+	if d.err == nil && err != nil {
+		d.err = err
+	}
+}
+
+// indirect is a copy of the function of the same name in
+// encoding/json. It walks down v, allocating pointers as
+// needed, until it gets to a non-pointer. If it encounters
+// an Unmarshaler, indirect stops and returns that. If
+// decodingNull is true, indirect stops at the first settable
+// pointer so that it can be set to nil.
+func indirect(v reflect.Value, decodingNull bool) (json.Unmarshaler, encoding.TextUnmarshaler, reflect.Value) {
+
+	v0 := v
+	haveAddr := false
+
+	// If v is a named type and is addressable, start with
+	// its address, so that if the type has pointer methods,
+	// we find them.
+	if v.Kind() != reflect.Ptr && v.Type().Name() != "" && v.CanAddr() {
+		haveAddr = true
+		v = v.Addr()
+	}
+
+	for {
+		// Load value from interface, but only if the result
+		// will be usefully addressable.
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			e := v.Elem()
+			if e.Kind() == reflect.Ptr && !e.IsNil() && (!decodingNull || e.Elem().Kind() == reflect.Ptr) {
+				haveAddr = false
+				v = e
+				continue
+			}
+		}
+
+		if v.Kind() != reflect.Ptr {
+			break
+		}
+
+		if decodingNull && v.CanSet() {
+			break
+		}
+
+		// Prevent infinite loop if v is an interface pointing
+		// to its own address.
+		if v.Elem().Kind() == reflect.Interface && v.Elem().Elem() == v {
+			v = v.Elem()
+			break
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		if v.Type().NumMethod() > 0 && v.CanInterface() {
+			if u, ok := v.Interface().(json.Unmarshaler); ok {
+				return u, nil, reflect.Value{}
+			}
+			if !decodingNull {
+				if u, ok := v.Interface().(encoding.TextUnmarshaler); ok {
+					return nil, u, reflect.Value{}
+				}
+			}
+		}
+
+		if haveAddr {
+			v = v0 // restore original value after round-trip Value.Addr().Elem()
+			haveAddr = false
+		} else {
+			v = v.Elem()
+		}
+	}
+
+	return nil, nil, v
+}
+
+// eachEntry calls fn for each name/value pair in the map or
+// struct v.
+func eachEntry(v reflect.Value, fn func(string, reflect.Value) error) error {
+
+	if jtypes.IsStruct(v) {
+		for _, f := range jtypes.StructFields(v.Type()) {
+			if val := f.Value(v); val.IsValid() {
+				if err := fn(f.Name, val); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, k := range v.MapKeys() {
+		key, ok := jtypes.AsString(k)
+		if !ok {
+			return fmt.Errorf("object key must evaluate to a string, got %v (%s)", k, k.Kind())
+		}
+		if err := fn(key, v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findField returns the struct field with the given JSON name.
+// Like encoding/json, it prefers an exact match but accepts a
+// case-insensitive one.
+func findField(fields []jtypes.StructField, name string) (jtypes.StructField, bool) {
+
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+
+	return jtypes.StructField{}, false
+}
+
+// fieldByIndex returns the field of the struct v with the
+// given index sequence, allocating embedded struct pointers
+// as needed.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct: %v", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v, nil
+}
+
+func isMapKeyType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	default:
+		return reflect.PointerTo(t).Implements(typeTextUnmarshaler)
+	}
+}
+
+func mapKey(key string, t reflect.Type) (reflect.Value, error) {
+
+	if reflect.PointerTo(t).Implements(typeTextUnmarshaler) {
+		k := reflect.New(t)
+		if err := k.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(key)); err != nil {
+			return reflect.Value{}, err
+		}
+		return k.Elem(), nil
+	}
+
+	k := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.String:
+		k.SetString(key)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || k.OverflowInt(n) {
+			return reflect.Value{}, fmt.Errorf("invalid key %q", key)
+		}
+		k.SetInt(n)
+	default:
+		n, err := strconv.ParseUint(key, 10, 64)
+		if err != nil || k.OverflowUint(n) {
+			return reflect.Value{}, fmt.Errorf("invalid key %q", key)
+		}
+		k.SetUint(n)
+	}
+
+	return k, nil
+}
+
+// asInt64 returns the number v, whose float64 value is n, as
+// an int64. json.Numbers are parsed directly so that integers
+// above 2^53 keep their precision.
+func asInt64(v reflect.Value, n float64) (int64, bool) {
+	if jtypes.IsJSONNumber(v) {
+		if i, err := strconv.ParseInt(jtypes.Resolve(v).String(), 10, 64); err == nil {
+			return i, true
+		}
+	}
+	i := int64(n)
+	return i, float64(i) == n
+}
+
+// asUint64 is like asInt64 for unsigned integers.
+func asUint64(v reflect.Value, n float64) (uint64, bool) {
+	if jtypes.IsJSONNumber(v) {
+		if u, err := strconv.ParseUint(jtypes.Resolve(v).String(), 10, 64); err == nil {
+			return u, true
+		}
+	}
+	u := uint64(n)
+	return u, n >= 0 && float64(u) == n
+}
+
+// describe returns the JSON type of v for use in error
+// messages.
+func describe(v reflect.Value) string {
+	switch {
+	case !v.IsValid():
+		return "null"
+	case jtypes.IsBool(v):
+		return "bool"
+	case jtypes.IsString(v):
+		return "string"
+	case jtypes.IsNumber(v):
+		return "number"
+	case jtypes.IsArray(v):
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func formatNumber(n float64) string {
+	if math.IsInf(n, 0) || math.IsNaN(n) {
+		return fmt.Sprint(n)
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
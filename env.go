@@ -5,7 +5,6 @@
 package jsonata
 
 import (
-	"errors"
 	"math"
 	"reflect"
 	"strings"
@@ -19,13 +18,34 @@ import (
 type environment struct {
 	parent  *environment
 	symbols map[string]reflect.Value
+	state   *evalState
+
+	// src is the source text of the expression being
+	// evaluated in this environment. It is used to report
+	// the locations of errors.
+	src string
+
+	// parents holds the ancestry of the context value in
+	// paths that are evaluated as tuples (see pathItem). It
+	// is nil if the environment inherits its parent's ancestry.
+	parents *ancestry
 }
 
 func newEnvironment(parent *environment, size int) *environment {
-	return &environment{
+
+	env := &environment{
 		parent:  parent,
 		symbols: make(map[string]reflect.Value, size),
 	}
+
+	// Child environments share the evaluation state and
+	// the source text of their parent.
+	if parent != nil {
+		env.state = parent.state
+		env.src = parent.src
+	}
+
+	return env
 }
 
 func (s *environment) bind(name string, value reflect.Value) {
@@ -46,6 +66,29 @@ func (s *environment) bindAll(values map[string]reflect.Value) {
 	}
 }
 
+// ancestry returns the ancestry of the context value, or nil
+// if the context value is not part of a path that tracks its
+// parents.
+func (s *environment) ancestry() *ancestry {
+	for env := s; env != nil; env = env.parent {
+		if env.parents != nil {
+			return env.parents
+		}
+	}
+	return nil
+}
+
+// withAncestry returns a child environment in which the
+// context value has the given ancestry.
+func (s *environment) withAncestry(a *ancestry) *environment {
+	return &environment{
+		parent:  s,
+		state:   s.state,
+		src:     s.src,
+		parents: a,
+	}
+}
+
 func (s *environment) lookup(name string) reflect.Value {
 
 	if v, ok := s.symbols[name]; ok {
@@ -179,11 +222,6 @@ var standardFunctions = map[string]Extension{
 		UndefinedHandler:   defaultUndefinedHandler,
 		EvalContextHandler: defaultContextHandler,
 	},
-	"eval": {
-		Func:               DoEval,
-		UndefinedHandler:   nil,
-		EvalContextHandler: func([]reflect.Value) bool { return true },
-	},
 
 	// Number functions
 
@@ -307,22 +345,22 @@ var standardFunctions = map[string]Extension{
 		EvalContextHandler: nil,
 	},
 	"map": {
-		Func:               jlib.Map,
+		Func:               jlib.MapContext,
 		UndefinedHandler:   defaultUndefinedHandler,
 		EvalContextHandler: nil,
 	},
 	"filter": {
-		Func:               jlib.Filter,
+		Func:               jlib.FilterContext,
 		UndefinedHandler:   defaultUndefinedHandler,
 		EvalContextHandler: nil,
 	},
 	"reduce": {
-		Func:               jlib.Reduce,
+		Func:               jlib.ReduceContext,
 		UndefinedHandler:   defaultUndefinedHandler,
 		EvalContextHandler: nil,
 	},
 	"single": {
-		Func:               jlib.Single,
+		Func:               jlib.SingleContext,
 		UndefinedHandler:   defaultUndefinedHandler,
 		EvalContextHandler: nil,
 	},
@@ -392,12 +430,14 @@ var standardFunctions = map[string]Extension{
 	},
 }
 
-func initBaseEnv(exts map[string]Extension) *environment {
+func initBaseEnv(exts map[string]Extension, state *evalState) *environment {
 
 	env := newEnvironment(nil, len(exts))
+	env.state = state
 
 	for name, ext := range exts {
 		fn := mustGoCallable(name, ext)
+		fn.ctx = state.context()
 		env.bind(name, reflect.ValueOf(fn))
 	}
 
@@ -435,7 +475,7 @@ func lookup(v reflect.Value, name string) (interface{}, error) {
 }
 
 func throw(msg string) (interface{}, error) {
-	return nil, errors.New(msg)
+	return nil, newEvalError(ErrUserDefined, nil, msg)
 }
 
 // Undefined handlers
@@ -5,10 +5,14 @@
 package jsonata
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/stepzen-dev/jsonata-go/jparse"
 	"github.com/stepzen-dev/jsonata-go/jtypes"
 )
 
@@ -47,6 +51,14 @@ const (
 	ErrIllegalDelete
 	ErrNonSortable
 	ErrSortMismatch
+	ErrCanceled
+	ErrDeadlineExceeded
+	ErrMaxDepth
+	ErrMaxSteps
+	ErrMaxResultSize
+	ErrEvalDisabled
+	ErrNoParent
+	ErrUserDefined
 )
 
 var errmsgs = map[ErrType]string{
@@ -70,6 +82,56 @@ var errmsgs = map[ErrType]string{
 	ErrIllegalDelete:      `the delete clause of an object transformation must evaluate to an array of strings`,
 	ErrNonSortable:        `expressions in a sort term must evaluate to strings or numbers`,
 	ErrSortMismatch:       `expressions in a sort term must have the same type`,
+	ErrCanceled:           `evaluation was cancelled`,
+	ErrDeadlineExceeded:   `evaluation exceeded its deadline`,
+	ErrMaxDepth:           `cannot call {{token}}: function calls are nested more than {{value}} levels deep`,
+	ErrMaxSteps:           `evaluation exceeded the maximum of {{value}} steps`,
+	ErrMaxResultSize:      `result exceeded the maximum size of {{value}} items`,
+	ErrEvalDisabled:       `function {{token}} is disabled`,
+	ErrNoParent:           `the parent of the context value cannot be determined`,
+	ErrUserDefined:        `{{value}}`,
+}
+
+// errcodes maps error types to the codes used for the same
+// errors by the JavaScript implementation of JSONata. Errors
+// that have no exact equivalent use the code of the closest
+// JavaScript error.
+var errcodes = map[ErrType]string{
+	ErrNonIntegerLHS:      "T2003",
+	ErrNonIntegerRHS:      "T2004",
+	ErrNonNumberLHS:       "T2001",
+	ErrNonNumberRHS:       "T2002",
+	ErrNonComparableLHS:   "T2010",
+	ErrNonComparableRHS:   "T2010",
+	ErrTypeMismatch:       "T2009",
+	ErrNonCallable:        "T1006",
+	ErrNonCallableApply:   "T2006",
+	ErrNonCallablePartial: "T1008",
+	ErrNumberInf:          "D1001",
+	ErrNumberNaN:          "D1001",
+	ErrMaxRangeItems:      "D2014",
+	ErrIllegalKey:         "T1003",
+	ErrDuplicateKey:       "D1009",
+	ErrClone:              "T2013",
+	ErrIllegalUpdate:      "T2011",
+	ErrIllegalDelete:      "T2012",
+	ErrNonSortable:        "T2008",
+	ErrSortMismatch:       "T2007",
+	ErrDeadlineExceeded:   "U1001",
+	ErrMaxDepth:           "U1001",
+	ErrNoParent:           "S0217",
+	ErrUserDefined:        "D3137",
+}
+
+// goErrcodes maps error types that have no equivalent in the
+// JavaScript implementation of JSONata to codes that are only
+// used by this package. All such codes start with G. Codes for
+// evaluation errors start with G1.
+var goErrcodes = map[ErrType]string{
+	ErrCanceled:      "G1001",
+	ErrMaxSteps:      "G1002",
+	ErrMaxResultSize: "G1003",
+	ErrEvalDisabled:  "G1004",
 }
 
 var reErrMsg = regexp.MustCompile("{{(token|value)}}")
@@ -80,6 +142,10 @@ type EvalError struct {
 	Type  ErrType
 	Token string
 	Value string
+
+	// Location is the part of the expression where the
+	// error occurred, if known.
+	Location *Location
 }
 
 func newEvalError(typ ErrType, token interface{}, value interface{}) *EvalError {
@@ -109,7 +175,7 @@ func (e EvalError) Error() string {
 		return fmt.Sprintf("EvalError: unknown error type %d", e.Type)
 	}
 
-	return reErrMsg.ReplaceAllStringFunc(s, func(match string) string {
+	s = reErrMsg.ReplaceAllStringFunc(s, func(match string) string {
 		switch match {
 		case "{{token}}":
 			return e.Token
@@ -119,6 +185,35 @@ func (e EvalError) Error() string {
 			return match
 		}
 	})
+
+	return withLocation(s, e.Location)
+}
+
+// Code returns the JSONata error code for the error, e.g.
+// "T2001". Codes match those used by the JavaScript version
+// of JSONata, so they can be used to look up documentation
+// shared with JavaScript applications. Errors that have no
+// JavaScript equivalent have codes that start with G.
+func (e EvalError) Code() string {
+	if code, ok := errcodes[e.Type]; ok {
+		return code
+	}
+	return goErrcodes[e.Type]
+}
+
+// Unwrap returns the context error that corresponds to an
+// ErrCanceled or ErrDeadlineExceeded error. This allows callers
+// to test for cancellation with errors.Is. For all other error
+// types, Unwrap returns nil.
+func (e EvalError) Unwrap() error {
+	switch e.Type {
+	case ErrCanceled:
+		return context.Canceled
+	case ErrDeadlineExceeded:
+		return context.DeadlineExceeded
+	default:
+		return nil
+	}
 }
 
 // ArgCountError is returned by the evaluation methods when an
@@ -128,6 +223,10 @@ type ArgCountError struct {
 	Func     string
 	Expected int
 	Received int
+
+	// Location is the part of the expression where the
+	// error occurred, if known.
+	Location *Location
 }
 
 func newArgCountError(f jtypes.Callable, received int) *ArgCountError {
@@ -138,8 +237,14 @@ func newArgCountError(f jtypes.Callable, received int) *ArgCountError {
 	}
 }
 
+// Code returns the JSONata error code for the error.
+func (e ArgCountError) Code() string {
+	return "T0410"
+}
+
 func (e ArgCountError) Error() string {
-	return fmt.Sprintf("function %q takes %d argument(s), got %d", e.Func, e.Expected, e.Received)
+	s := fmt.Sprintf("function %q takes %d argument(s), got %d", e.Func, e.Expected, e.Received)
+	return withLocation(s, e.Location)
 }
 
 // ArgTypeError is returned by the evaluation methods when an
@@ -148,6 +253,19 @@ func (e ArgCountError) Error() string {
 type ArgTypeError struct {
 	Func  string
 	Which int
+
+	// Context is true if the argument is the context value,
+	// which some functions use in place of a missing first
+	// argument.
+	Context bool
+
+	// Array is true if the function takes an array and the
+	// argument is an array with elements of the wrong type.
+	Array bool
+
+	// Location is the part of the expression where the
+	// error occurred, if known.
+	Location *Location
 }
 
 func newArgTypeError(f jtypes.Callable, which int) *ArgTypeError {
@@ -157,6 +275,184 @@ func newArgTypeError(f jtypes.Callable, which int) *ArgTypeError {
 	}
 }
 
+// Code returns the JSONata error code for the error.
+func (e ArgTypeError) Code() string {
+	switch {
+	case e.Context:
+		return "T0411"
+	case e.Array:
+		return "T0412"
+	default:
+		return "T0410"
+	}
+}
+
 func (e ArgTypeError) Error() string {
-	return fmt.Sprintf("argument %d of function %q does not match function signature", e.Which, e.Func)
+	s := fmt.Sprintf("argument %d of function %q does not match function signature", e.Which, e.Func)
+	return withLocation(s, e.Location)
+}
+
+// A CallError is returned by the evaluation methods when a
+// Go function, such as a standard function or an extension,
+// returns an error. It records where the function was called.
+// The original error is available from the Err field. Use
+// errors.Is and errors.As rather than comparing or asserting
+// the error directly.
+type CallError struct {
+	Func string
+	Err  error
+
+	// Location is the part of the expression where the
+	// error occurred, if known.
+	Location *Location
+}
+
+func newCallError(name string, err error) *CallError {
+	return &CallError{
+		Func: name,
+		Err:  err,
+	}
+}
+
+func (e CallError) Error() string {
+	return withLocation(e.Err.Error(), e.Location)
+}
+
+// Code returns the JSONata error code of the error returned
+// by the function, or an empty string if it does not have one.
+func (e CallError) Code() string {
+	var c interface{ Code() string }
+	if errors.As(e.Err, &c) {
+		return c.Code()
+	}
+	return ""
+}
+
+// Unwrap returns the error returned by the function.
+func (e CallError) Unwrap() error {
+	return e.Err
+}
+
+// A Location identifies the part of an expression where an
+// error occurred.
+type Location struct {
+
+	// Expr is the source text of the expression.
+	Expr string
+
+	// Start and End are the byte offsets of the part of Expr
+	// where the error occurred.
+	Start int
+	End   int
+}
+
+// Line returns the line number of the start of the location.
+// Lines are numbered from 1.
+func (l Location) Line() int {
+	return strings.Count(l.Expr[:l.start()], "\n") + 1
+}
+
+// Column returns the column number of the start of the
+// location, counted in characters. Columns are numbered
+// from 1.
+func (l Location) Column() int {
+	start := l.start()
+	return utf8.RuneCountInString(l.Expr[l.lineStart():start]) + 1
+}
+
+// Snippet returns the line of the expression that contains
+// the start of the location, followed by a line of carets
+// that mark the location. Locations that span several lines
+// are marked up to the end of the first line.
+func (l Location) Snippet() string {
+
+	start, end := l.start(), l.end()
+	lineStart, lineEnd := l.lineStart(), l.lineEnd()
+	end = min(end, lineEnd)
+
+	var b strings.Builder
+
+	b.WriteString(strings.TrimSuffix(l.Expr[lineStart:lineEnd], "\r"))
+	b.WriteByte('\n')
+
+	// Keep tabs so that the carets line up with the text
+	// above them.
+	for _, r := range l.Expr[lineStart:start] {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+
+	b.WriteString(strings.Repeat("^", max(utf8.RuneCountInString(l.Expr[start:end]), 1)))
+
+	return b.String()
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("line %d, column %d", l.Line(), l.Column())
+}
+
+// start and end return the offsets of the location, limited
+// to the length of the expression.
+func (l Location) start() int {
+	return min(max(l.Start, 0), len(l.Expr))
+}
+
+func (l Location) end() int {
+	return min(max(l.End, l.start()), len(l.Expr))
+}
+
+func (l Location) lineStart() int {
+	return strings.LastIndexByte(l.Expr[:l.start()], '\n') + 1
+}
+
+func (l Location) lineEnd() int {
+	start := l.start()
+	if i := strings.IndexByte(l.Expr[start:], '\n'); i >= 0 {
+		return start + i
+	}
+	return len(l.Expr)
+}
+
+// withLocation adds a location, if any, to an error message.
+func withLocation(msg string, loc *Location) string {
+	if loc == nil || loc.Expr == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s at %s:\n%s", msg, loc, loc.Snippet())
+}
+
+// errorLocation returns a pointer to the Location field of
+// err, or nil if err does not have a location.
+func errorLocation(err error) **Location {
+	switch err := err.(type) {
+	case *EvalError:
+		return &err.Location
+	case *ArgCountError:
+		return &err.Location
+	case *ArgTypeError:
+		return &err.Location
+	case *CallError:
+		return &err.Location
+	case *FunctionPolicyError:
+		return &err.Location
+	default:
+		return nil
+	}
+}
+
+// setErrorLocation records the position of node in err, if
+// err does not already have a location. Node positions are
+// offsets into expr.
+func setErrorLocation(err error, node jparse.Node, expr string) {
+	if loc := errorLocation(err); loc != nil && *loc == nil {
+		pos := node.Position()
+		*loc = &Location{
+			Expr:  expr,
+			Start: pos.Start,
+			End:   pos.End,
+		}
+	}
 }
@@ -0,0 +1,269 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestErrorLocations(t *testing.T) {
+
+	tests := []struct {
+		Expression string
+		Location   Location
+		Line       int
+		Column     int
+		Snippet    string
+	}{
+		{
+			Expression: `1 + "a"`,
+			Location: Location{
+				Expr:  `1 + "a"`,
+				Start: 0,
+				End:   7,
+			},
+			Line:    1,
+			Column:  1,
+			Snippet: "1 + \"a\"\n^^^^^^^",
+		},
+		{
+			Expression: "{\n  \"a\": 1,\n  \"b\": $foo()\n}",
+			Location: Location{
+				Expr:  "{\n  \"a\": 1,\n  \"b\": $foo()\n}",
+				Start: 19,
+				End:   23,
+			},
+			Line:    3,
+			Column:  8,
+			Snippet: "  \"b\": $foo()\n       ^^^^",
+		},
+		{
+			// Errors returned by Go functions are located
+			// at the function call.
+			Expression: `1 + $sum("a")`,
+			Location: Location{
+				Expr:  `1 + $sum("a")`,
+				Start: 4,
+				End:   13,
+			},
+			Line:    1,
+			Column:  5,
+			Snippet: "1 + $sum(\"a\")\n    ^^^^^^^^^",
+		},
+		{
+			// Including calls in tail position.
+			Expression: `($f := function($x) { $x ? $error("failed") }; $f(true))`,
+			Location: Location{
+				Expr:  `($f := function($x) { $x ? $error("failed") }; $f(true))`,
+				Start: 27,
+				End:   43,
+			},
+			Line:    1,
+			Column:  28,
+			Snippet: "($f := function($x) { $x ? $error(\"failed\") }; $f(true))\n                           ^^^^^^^^^^^^^^^^",
+		},
+		{
+			// Columns are counted in characters, not bytes.
+			Expression: "(\n\t$x := \"é\"; $substring($x, \"1\")\n)",
+			Location: Location{
+				Expr:  "(\n\t$x := \"é\"; $substring($x, \"1\")\n)",
+				Start: 15,
+				End:   34,
+			},
+			Line:    2,
+			Column:  13,
+			Snippet: "\t$x := \"é\"; $substring($x, \"1\")\n\t           ^^^^^^^^^^^^^^^^^^^",
+		},
+		{
+			// Errors that span several lines are marked up
+			// to the end of the first line.
+			Expression: "$count(\n  1, 2, 3\n)",
+			Location: Location{
+				Expr:  "$count(\n  1, 2, 3\n)",
+				Start: 0,
+				End:   19,
+			},
+			Line:    1,
+			Column:  1,
+			Snippet: "$count(\n^^^^^^^",
+		},
+		{
+			// Errors in expressions evaluated by $eval are
+			// located in the evaluated expression.
+			Expression: `$eval("[1, 2] + 1")`,
+			Location: Location{
+				Expr:  "[1, 2] + 1",
+				Start: 0,
+				End:   10,
+			},
+			Line:    1,
+			Column:  1,
+			Snippet: "[1, 2] + 1\n^^^^^^^^^^",
+		},
+		{
+			Expression: `($f := $eval("function($x) { -$x }"); 1 + $f("a"))`,
+			Location: Location{
+				Expr:  "function($x) { -$x }",
+				Start: 15,
+				End:   18,
+			},
+			Line:    1,
+			Column:  16,
+			Snippet: "function($x) { -$x }\n               ^^^",
+		},
+	}
+
+	for _, test := range tests {
+
+		e := MustCompile(test.Expression)
+
+		_, err := e.Eval(nil)
+
+		p := errorLocation(err)
+		if p == nil || *p == nil {
+			t.Errorf("%s: expected an error with a location, got %v", test.Expression, err)
+			continue
+		}
+
+		loc := *p
+		if *loc != test.Location {
+			t.Errorf("%s: expected location %+v, got %+v", test.Expression, test.Location, *loc)
+		}
+		if got := loc.Line(); got != test.Line {
+			t.Errorf("%s: expected line %d, got %d", test.Expression, test.Line, got)
+		}
+		if got := loc.Column(); got != test.Column {
+			t.Errorf("%s: expected column %d, got %d", test.Expression, test.Column, got)
+		}
+		if got := loc.Snippet(); got != test.Snippet {
+			t.Errorf("%s: expected snippet\n%s\ngot\n%s", test.Expression, test.Snippet, got)
+		}
+	}
+}
+
+func TestErrorLocationMessage(t *testing.T) {
+
+	_, err := MustCompile("{\n  \"b\": $foo()\n}").Eval(nil)
+
+	exp := "cannot call non-function $foo at line 2, column 8:\n" +
+		"  \"b\": $foo()\n" +
+		"       ^^^^"
+
+	if err == nil || err.Error() != exp {
+		t.Errorf("expected error %q, got %v", exp, err)
+	}
+}
+
+func TestCallError(t *testing.T) {
+
+	errFailed := errors.New("failed")
+
+	e := MustCompile(`$fail()`)
+	err := e.RegisterExts(map[string]Extension{
+		"fail": {
+			Func: func() (interface{}, error) {
+				return nil, errFailed
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.Eval(nil)
+
+	var callErr *CallError
+	if !errors.As(err, &callErr) || callErr.Func != "fail" {
+		t.Fatalf("expected a CallError for function \"fail\", got %v", err)
+	}
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected error to wrap %v, got %v", errFailed, err)
+	}
+
+	exp := "failed at line 1, column 1:\n" +
+		"$fail()\n" +
+		"^^^^^^^"
+
+	if err.Error() != exp {
+		t.Errorf("expected error %q, got %q", exp, err.Error())
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+
+	tests := []struct {
+		Expression string
+		Code       string
+	}{
+		{`1 +`, "S0207"},
+		{`[1, 2`, "S0203"},
+		{`"hello`, "S0101"},
+		{`$x := 1 + `, "S0207"},
+		{`1 := 2`, "S0212"},
+		{`1 + "a"`, "T2002"},
+		{`"a" + 1`, "T2001"},
+		{`1 < "a"`, "T2009"},
+		{`[1..1.5]`, "T2004"},
+		{`$foo()`, "T1006"},
+		{`1 ~> 2`, "T2006"},
+		{`{"a": 1, "a": 2}`, "D1009"},
+		{`1 / 0`, "D1001"},
+		{`$uppercase(1)`, "T0410"},
+		{`$uppercase("a", "b")`, "T0410"},
+		{`[true].$uppercase()`, "T0411"},
+		{`λ($a)<a<n>>{$a}(["a"])`, "T0412"},
+		{`$sum("a")`, "T0412"},
+		{`$number("a")`, "D3030"},
+		{`$formatNumber(1, "#.#.#")`, "D3081"},
+		{`$error("failed")`, "D3137"},
+	}
+
+	for _, test := range tests {
+
+		e, err := Compile(test.Expression)
+		if err == nil {
+			_, err = e.Eval(nil)
+		}
+
+		c, ok := err.(interface{ Code() string })
+		if !ok {
+			t.Errorf("%s: expected an error with a code, got %v", test.Expression, err)
+			continue
+		}
+
+		if got := c.Code(); got != test.Code {
+			t.Errorf("%s: expected code %s, got %s (%v)", test.Expression, test.Code, got, err)
+		}
+	}
+
+	// Every error type must have a code.
+	for typ := range errmsgs {
+		if errcodes[typ] == "" && goErrcodes[typ] == "" {
+			t.Errorf("error type %d (%s) does not have a code", typ, errmsgs[typ])
+		}
+	}
+}
+
+func TestErrorCodesDeadline(t *testing.T) {
+
+	// jsonata-js reports timeouts with code U1001, the same
+	// code that it uses for stack overflows.
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	_, err := MustCompile(`[1..10000000]`).EvalContext(ctx, nil)
+
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) || evalErr.Type != ErrDeadlineExceeded {
+		t.Fatalf("expected an ErrDeadlineExceeded error, got %v", err)
+	}
+
+	if got := evalErr.Code(); got != "U1001" {
+		t.Errorf("expected code U1001, got %s", got)
+	}
+}
@@ -5,10 +5,13 @@
 package jsonata
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
+	"math/big"
 	"reflect"
 	"sort"
+	"strconv"
 
 	"github.com/stepzen-dev/jsonata-go/jlib"
 	"github.com/stepzen-dev/jsonata-go/jparse"
@@ -19,9 +22,25 @@ var undefined reflect.Value
 
 var typeInterfaceSlice = reflect.SliceOf(jtypes.TypeInterface)
 
-func eval(node jparse.Node, input reflect.Value, env *environment) (reflect.Value, error) {
-	var err error
-	var v reflect.Value
+func eval(node jparse.Node, input reflect.Value, env *environment) (v reflect.Value, err error) {
+
+	if t := evalTracer(env); t != nil {
+		t.Enter(node, input)
+		defer func() {
+			t.Exit(node, input, v, err)
+		}()
+	}
+
+	if env != nil && env.state.profiler() != nil {
+		env.state.profileEnter(node)
+		defer func() {
+			env.state.profileExit(v)
+		}()
+	}
+
+	if err = evalStep(env); err != nil {
+		return undefined, err
+	}
 
 	switch node := node.(type) {
 	case *jparse.StringNode:
@@ -58,6 +77,8 @@ func eval(node jparse.Node, input reflect.Value, env *environment) (reflect.Valu
 		v, err = evalWildcard(node, input, env)
 	case *jparse.DescendentNode:
 		v, err = evalDescendent(node, input, env)
+	case *jparse.ParentNode:
+		v, err = evalParent(node, input, env)
 	case *jparse.GroupNode:
 		v, err = evalGroup(node, input, env)
 	case *jparse.PredicateNode:
@@ -89,13 +110,54 @@ func eval(node jparse.Node, input reflect.Value, env *environment) (reflect.Valu
 	}
 
 	if err != nil {
+		setErrorLocation(err, node, evalSource(env))
 		return undefined, err
 	}
 
+	return evalResult(v, env)
+}
+
+// evalStep records the evaluation of a node. It returns an
+// error if the evaluation has taken too many steps.
+func evalStep(env *environment) error {
+	if env == nil {
+		return nil
+	}
+	return env.state.step()
+}
+
+// evalSource returns the source text of the expression being
+// evaluated, if known.
+func evalSource(env *environment) string {
+	if env == nil {
+		return ""
+	}
+	return env.src
+}
+
+// evalTracer returns the Tracer for the current evaluation,
+// if any.
+func evalTracer(env *environment) Tracer {
+	if env == nil {
+		return nil
+	}
+	return env.state.tracer()
+}
+
+// evalResult converts the result of evaluating a node into
+// its final form and checks that it does not exceed the
+// maximum result size.
+func evalResult(v reflect.Value, env *environment) (reflect.Value, error) {
 	if seq, ok := asSequence(v); ok {
 		v = seq.Value()
 	}
 
+	if env != nil {
+		if err := env.state.checkSize(v); err != nil {
+			return undefined, err
+		}
+	}
+
 	return v, nil
 }
 
@@ -128,7 +190,17 @@ func evalVariable(node *jparse.VariableNode, data reflect.Value, env *environmen
 	if node.Name == "" {
 		return data, nil
 	}
-	return env.lookup(node.Name), nil
+
+	v := env.lookup(node.Name)
+
+	// $eval needs the environment and input it is referenced
+	// from, whether it is called directly or passed to another
+	// function.
+	if v.IsValid() && v.Type() == typeEvalCallablePtr {
+		return reflect.ValueOf(callSite(v.Interface().(*evalCallable), "", data, env)), nil
+	}
+
+	return v, nil
 }
 
 func evalName(node *jparse.NameNode, data reflect.Value, env *environment) (reflect.Value, error) {
@@ -137,9 +209,16 @@ func evalName(node *jparse.NameNode, data reflect.Value, env *environment) (refl
 
 	data = jtypes.Resolve(data)
 
+	if m, ok := jtypes.AsInterfaceMap(data); ok {
+		if x, ok := m[node.Value]; ok {
+			return jtypes.ValueOf(x), nil
+		}
+		return undefined, nil
+	}
+
 	switch {
 	case jtypes.IsStruct(data):
-		v = data.FieldByName(node.Value)
+		v = jtypes.FieldByName(data, node.Value)
 	case jtypes.IsMap(data):
 		v = data.MapIndex(reflect.ValueOf(node.Value))
 	case jtypes.IsArray(data):
@@ -155,6 +234,27 @@ func evalNameArray(node *jparse.NameNode, data reflect.Value, env *environment)
 	n := data.Len()
 	results := newSequence(n)
 
+	if arr, ok := jtypes.AsInterfaceSlice(data); ok {
+		for _, item := range arr {
+			if m, ok := item.(map[string]interface{}); ok {
+				if x, ok := m[node.Value]; ok {
+					results.Append(x)
+				}
+				continue
+			}
+
+			v, err := evalName(node, jtypes.ValueOf(item), env)
+			if err != nil {
+				return undefined, err
+			}
+
+			if v.IsValid() && v.CanInterface() {
+				results.Append(v.Interface())
+			}
+		}
+		return reflect.ValueOf(results), nil
+	}
+
 	for i := 0; i < n; i++ {
 
 		v, err := evalName(node, data.Index(i), env)
@@ -175,26 +275,20 @@ func evalPath(node *jparse.PathNode, data reflect.Value, env *environment) (refl
 		return undefined, nil
 	}
 
-	var isVar bool
-	switch step0 := node.Steps[0].(type) {
-	case (*jparse.VariableNode):
-		isVar = true
-	case (*jparse.PredicateNode):
-		_, isVar = step0.Expr.(*jparse.VariableNode)
+	if node.Tuples {
+		return evalTuplePath(node, data, env)
 	}
 
-	output := data
-	if isVar || !jtypes.IsArray(data) {
-		output = reflect.MakeSlice(typeInterfaceSlice, 1, 1)
-		if data.IsValid() {
-			output.Index(0).Set(data)
-		}
-	}
+	output, _ := pathInput(node, data)
 
 	var err error
 	lastIndex := len(node.Steps) - 1
 	for i, step := range node.Steps {
 
+		if err = env.state.checkCancel(); err != nil {
+			return undefined, err
+		}
+
 		if step0, ok := step.(*jparse.ArrayNode); ok && i == 0 {
 			output, err = eval(step0, output, env)
 		} else {
@@ -220,6 +314,495 @@ func evalPath(node *jparse.PathNode, data reflect.Value, env *environment) (refl
 	return output, nil
 }
 
+// pathInput returns the array of values that the first step
+// of a path is evaluated against. It also reports whether the
+// path starts with a variable, in which case the values do not
+// come from the context.
+func pathInput(node *jparse.PathNode, data reflect.Value) (reflect.Value, bool) {
+
+	var isVar, isParent bool
+	switch step0 := node.Steps[0].(type) {
+	case (*jparse.VariableNode):
+		isVar = true
+	case (*jparse.PredicateNode):
+		_, isVar = step0.Expr.(*jparse.VariableNode)
+	case (*jparse.ParentNode):
+		// Like a variable, the parent operator yields the same
+		// value for every item in an array context, so it is
+		// evaluated only once.
+		isParent = true
+	}
+
+	if !isVar && !isParent && jtypes.IsArray(data) {
+		// Resolve the array in case it is held in an
+		// interface, e.g. as an item of another array.
+		return jtypes.Resolve(data), false
+	}
+
+	output := reflect.MakeSlice(typeInterfaceSlice, 1, 1)
+	if data.IsValid() {
+		output.Index(0).Set(data)
+	}
+
+	return output, isVar
+}
+
+// An ancestry is a list of the values from which a value in
+// a path was derived, starting with its parent. It is used to
+// evaluate the parent operator.
+type ancestry struct {
+	value  reflect.Value
+	parent *ancestry
+}
+
+// noAncestry is the ancestry of values whose parents are not
+// known, such as the values of variables.
+var noAncestry = &ancestry{}
+
+// A pathBinding is a list of the variables bound by the steps
+// of a path, newest first.
+type pathBinding struct {
+	name  string
+	value reflect.Value
+	next  *pathBinding
+}
+
+// A pathItem is a value in a path along with its ancestry and
+// the variables bound by the steps that led to it.
+type pathItem struct {
+	value    reflect.Value
+	parents  *ancestry
+	bindings *pathBinding
+}
+
+// bind returns a copy of the item with an extra variable.
+func (item pathItem) bind(name string, value reflect.Value) pathItem {
+	item.bindings = &pathBinding{
+		name:  name,
+		value: value,
+		next:  item.bindings,
+	}
+	return item
+}
+
+// env returns a child of env in which to evaluate expressions
+// against the item's value.
+func (item pathItem) env(env *environment) *environment {
+	env = env.withAncestry(item.parents)
+	bindPathVariables(env, item.bindings)
+	return env
+}
+
+// bindPathVariables adds a list of path bindings to env. If
+// a variable is bound more than once, the newest value wins.
+func bindPathVariables(env *environment, bindings *pathBinding) {
+	for b := bindings; b != nil; b = b.next {
+		if _, ok := env.symbols[b.name]; !ok {
+			env.bind(b.name, b.value)
+		}
+	}
+}
+
+// evalTuplePath is like evalPath but it evaluates the
+// path as a stream of pathItems. This keeps track of the
+// ancestry of each value and of the variables bound by the
+// path's steps. Each step is evaluated in an environment that
+// holds the ancestry and the variables of its context value.
+func evalTuplePath(node *jparse.PathNode, data reflect.Value, env *environment) (reflect.Value, error) {
+
+	items, output, err := evalPathItems(node, data, nil, env)
+	if err != nil || output.IsValid() || len(items) == 0 {
+		return output, err
+	}
+
+	seq := newSequence(len(items))
+	for _, item := range items {
+		seq.Append(item.value.Interface())
+	}
+
+	if node.KeepArrays {
+		seq.keepSingletons = true
+	}
+
+	return reflect.ValueOf(seq), nil
+}
+
+// evalPathItems evaluates a path and returns the values that
+// it yields along with their ancestries and bindings. The
+// bindings argument holds any variables already bound by an
+// enclosing path. If the path yields a single array that should
+// not be flattened, evalPathItems also returns the array, which
+// is the result of the path.
+func evalPathItems(node *jparse.PathNode, data reflect.Value, bindings *pathBinding, env *environment) ([]pathItem, reflect.Value, error) {
+
+	input, isVar := pathInput(node, data)
+
+	parents := env.ancestry()
+	if isVar || parents == nil {
+		parents = noAncestry
+	}
+
+	var items []pathItem
+	lastIndex := len(node.Steps) - 1
+
+	for i, step := range node.Steps {
+
+		if err := env.state.checkCancel(); err != nil {
+			return nil, undefined, err
+		}
+
+		if step0, ok := step.(*jparse.ArrayNode); ok && i == 0 {
+
+			output, err := eval(step0, input, env)
+			if err != nil || output == undefined {
+				return nil, undefined, err
+			}
+
+			if jtypes.IsArray(output) && jtypes.Resolve(output).Len() == 0 {
+				return nil, undefined, nil
+			}
+
+			items = appendPathItems(nil, output, pathItem{
+				parents:  parents,
+				bindings: bindings,
+			}, false)
+			if i == lastIndex {
+				return items, output, nil
+			}
+			continue
+		}
+
+		if i == 0 {
+			input = jtypes.Resolve(input)
+			arr, native := jtypes.AsInterfaceSlice(input)
+			for j, N := 0, input.Len(); j < N; j++ {
+				item := pathItem{
+					parents:  parents,
+					bindings: bindings,
+				}
+				if native {
+					item.value = jtypes.ValueOf(arr[j])
+				} else {
+					item.value = input.Index(j)
+				}
+				items = append(items, item)
+			}
+		}
+
+		next, single, err := evalTupleStep(step, items, env)
+		if err != nil {
+			return nil, undefined, err
+		}
+
+		if i == lastIndex && jtypes.IsArray(single) {
+			if jtypes.Resolve(single).Len() == 0 {
+				return nil, undefined, nil
+			}
+			return next, single, nil
+		}
+
+		if len(next) == 0 {
+			return nil, undefined, nil
+		}
+
+		items = next
+	}
+
+	return items, undefined, nil
+}
+
+// evalTupleStep evaluates a path step against a list of items
+// and returns the items that it yields. If the step does not
+// bind any variables and it yields a result for exactly one
+// of the input items, evalTupleStep also returns that result.
+func evalTupleStep(step jparse.Node, items []pathItem, env *environment) ([]pathItem, reflect.Value, error) {
+
+	switch step := step.(type) {
+	case *jparse.FocusNode:
+		next, err := evalFocusStep(step, items, env)
+		return next, undefined, err
+	case *jparse.IndexNode:
+		next, err := evalIndexStep(step, items, env)
+		return next, undefined, err
+	case *jparse.PredicateNode:
+		switch step.Expr.(type) {
+		case *jparse.FocusNode, *jparse.IndexNode:
+			next, err := evalTuplePredicate(step, items, env)
+			return next, undefined, err
+		}
+	case *jparse.SortNode:
+		if path, ok := step.Expr.(*jparse.PathNode); ok && path.Tuples {
+			next, err := evalSortStep(step, path, items, env)
+			return next, undefined, err
+		}
+	}
+
+	_, isCons := step.(*jparse.ArrayNode)
+	_, isParent := step.(*jparse.ParentNode)
+	_, isVar := step.(*jparse.VariableNode)
+
+	var next []pathItem
+	var first reflect.Value
+	var nResults int
+
+	for _, item := range items {
+
+		if err := env.state.checkCancel(); err != nil {
+			return nil, undefined, err
+		}
+
+		res, err := eval(step, item.value, item.env(env))
+		if err != nil {
+			return nil, undefined, err
+		}
+
+		if !res.IsValid() {
+			continue
+		}
+
+		if nResults == 0 {
+			first = res
+		}
+		nResults++
+
+		// The values yielded by a step are the children
+		// of the step's context value, except in the case
+		// of the parent operator, which goes the other way,
+		// and of variables (including $), whose parents are
+		// not known.
+		child := pathItem{
+			parents: &ancestry{
+				value:  item.value,
+				parent: item.parents,
+			},
+			bindings: item.bindings,
+		}
+		switch {
+		case isParent:
+			child.parents = item.parents.parent
+			if child.parents == nil {
+				child.parents = noAncestry
+			}
+		case isVar:
+			child.parents = noAncestry
+		}
+
+		next = appendPathItems(next, res, child, isCons)
+	}
+
+	if nResults != 1 {
+		first = undefined
+	}
+
+	return next, first, nil
+}
+
+// evalFocusStep evaluates a step with a context variable
+// binding. Each value yielded by the step is bound to the
+// variable, and the context value is passed on unchanged.
+// The step may itself bind variables, e.g. a#$i@$v. If it
+// is another focus binding, e.g. a@$u@$v, both variables
+// are bound to the same values.
+func evalFocusStep(node *jparse.FocusNode, items []pathItem, env *environment) ([]pathItem, error) {
+
+	_, isFocus := node.Expr.(*jparse.FocusNode)
+
+	var next []pathItem
+
+	for _, item := range items {
+
+		results, err := evalBindingStep(node.Expr, item, env)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, res := range results {
+			v := res.value
+			if isFocus {
+				v = res.bindings.value
+			}
+			child := item
+			child.bindings = res.bindings
+			next = append(next, child.bind(node.Name, v))
+		}
+	}
+
+	return next, nil
+}
+
+// evalIndexStep evaluates a step with a positional variable
+// binding. Each item yielded by the step is bound to its
+// position in the results for its context value.
+func evalIndexStep(node *jparse.IndexNode, items []pathItem, env *environment) ([]pathItem, error) {
+
+	var next []pathItem
+
+	for _, item := range items {
+
+		results, err := evalBindingStep(node.Expr, item, env)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, res := range results {
+			next = append(next, res.bind(node.Name, reflect.ValueOf(float64(i))))
+		}
+	}
+
+	return next, nil
+}
+
+// evalBindingStep evaluates the step of a variable binding
+// against a single item. Unlike other steps, an array
+// constructor yields its members one at a time, so that
+// each one is bound separately, e.g. in [1, 2]#$i.
+func evalBindingStep(step jparse.Node, item pathItem, env *environment) ([]pathItem, error) {
+
+	results, _, err := evalTupleStep(step, []pathItem{item}, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := step.(*jparse.ArrayNode); !ok {
+		return results, nil
+	}
+
+	var next []pathItem
+	for _, res := range results {
+		next = appendPathItems(next, res.value, res, false)
+	}
+
+	return next, nil
+}
+
+// evalSortStep evaluates a step that sorts a path with variable
+// bindings. The bindings are carried over to the sorted items
+// so that later steps can use them.
+func evalSortStep(node *jparse.SortNode, path *jparse.PathNode, items []pathItem, env *environment) ([]pathItem, error) {
+
+	var next []pathItem
+
+	for _, item := range items {
+
+		tuples, _, err := evalPathItems(path, item.value, item.bindings, item.env(env))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tuples) == 0 {
+			continue
+		}
+
+		values := make([]interface{}, len(tuples))
+		for i, t := range tuples {
+			values[i] = t.value.Interface()
+		}
+
+		info, err := buildSortInfo(reflect.ValueOf(values), tuples, node.Terms, env)
+		if err != nil {
+			return nil, err
+		}
+
+		sort.SliceStable(info, makeLessFunc(info, node.Terms))
+
+		for _, si := range info {
+			next = append(next, tuples[si.index])
+		}
+	}
+
+	return next, nil
+}
+
+// evalTuplePredicate evaluates a predicate on a step that binds
+// variables. Unlike an ordinary predicate, the filters apply to
+// all of the items yielded by the step, so that they can refer
+// to the bound variables.
+func evalTuplePredicate(node *jparse.PredicateNode, items []pathItem, env *environment) ([]pathItem, error) {
+
+	items, _, err := evalTupleStep(node.Expr, items, env)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filter := range node.Filters {
+
+		if len(items) == 0 {
+			break
+		}
+
+		items, err = filterPathItems(filter, items, env)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+// filterPathItems is the equivalent of applyFilter for
+// pathItems.
+func filterPathItems(filter jparse.Node, items []pathItem, env *environment) ([]pathItem, error) {
+
+	nItems := len(items)
+	var results []pathItem
+
+	for i, item := range items {
+
+		res, err := eval(filter, item.value, item.env(env))
+		if err != nil {
+			return nil, err
+		}
+
+		if jtypes.IsNumber(res) {
+			res = arrayify(res)
+		}
+
+		switch {
+		case jtypes.IsArrayOf(res, jtypes.IsNumber):
+			for j, N := 0, res.Len(); j < N; j++ {
+
+				n, _ := jtypes.AsNumber(res.Index(j))
+				index := int(math.Floor(n))
+				if index < 0 {
+					index += nItems
+				}
+
+				if index == i {
+					results = append(results, item)
+				}
+			}
+		case jlib.Boolean(res):
+			results = append(results, item)
+		}
+	}
+
+	return results, nil
+}
+
+// appendPathItems adds the values yielded by a path step to
+// items. Each new item is a copy of tmpl with one of the values.
+// Arrays are flattened unless keepArray is true.
+func appendPathItems(items []pathItem, v reflect.Value, tmpl pathItem, keepArray bool) []pathItem {
+
+	if keepArray || !jtypes.IsArray(v) {
+		if v.IsValid() && v.CanInterface() {
+			tmpl.value = jtypes.ValueOf(v.Interface())
+			items = append(items, tmpl)
+		}
+		return items
+	}
+
+	v = arrayify(v)
+	for i, N := 0, v.Len(); i < N; i++ {
+		if vi := v.Index(i); vi.IsValid() && vi.CanInterface() {
+			tmpl.value = jtypes.ValueOf(vi.Interface())
+			items = append(items, tmpl)
+		}
+	}
+
+	return items
+}
+
 func evalPathStep(step jparse.Node, data reflect.Value, env *environment, lastStep bool) (reflect.Value, error) {
 	var err error
 	var results []reflect.Value
@@ -251,6 +834,11 @@ func evalPathStep(step jparse.Node, data reflect.Value, env *environment, lastSt
 		}
 
 		v = arrayify(v)
+		if arr, ok := jtypes.AsInterfaceSlice(v); ok {
+			resultSequence.values = append(resultSequence.values, arr...)
+			continue
+		}
+
 		for i, N := 0, v.Len(); i < N; i++ {
 			if vi := v.Index(i); vi.IsValid() && vi.CanInterface() {
 				resultSequence.Append(vi.Interface())
@@ -268,9 +856,32 @@ func evalPathStep(step jparse.Node, data reflect.Value, env *environment, lastSt
 func evalOverArray(node jparse.Node, data reflect.Value, env *environment) ([]reflect.Value, error) {
 	var results []reflect.Value
 
+	arr, native := jtypes.AsInterfaceSlice(data)
+
+	if workers := parallelWorkers(node, data.Len(), env); workers > 0 {
+		defer env.state.endParallel()
+		return evalParallel(node, data.Len(), workers, func(i int) reflect.Value {
+			if native {
+				return jtypes.ValueOf(arr[i])
+			}
+			return data.Index(i)
+		}, env)
+	}
+
 	for i, N := 0, data.Len(); i < N; i++ {
 
-		res, err := eval(node, data.Index(i), env)
+		if err := env.state.checkCancel(); err != nil {
+			return nil, err
+		}
+
+		var item reflect.Value
+		if native {
+			item = jtypes.ValueOf(arr[i])
+		} else {
+			item = data.Index(i)
+		}
+
+		res, err := eval(node, item, env)
 		if err != nil {
 			return nil, err
 		}
@@ -289,8 +900,17 @@ func evalOverArray(node jparse.Node, data reflect.Value, env *environment) ([]re
 func evalOverSequence(node jparse.Node, seq *sequence, env *environment) ([]reflect.Value, error) {
 	var results []reflect.Value
 
+	if workers := parallelWorkers(node, len(seq.values), env); workers > 0 {
+		defer env.state.endParallel()
+		return evalParallel(node, len(seq.values), workers, seq.valueAt, env)
+	}
+
 	for i, N := 0, len(seq.values); i < N; i++ {
 
+		if err := env.state.checkCancel(); err != nil {
+			return nil, err
+		}
+
 		res, err := eval(node, seq.valueAt(i), env)
 		if err != nil {
 			return nil, err
@@ -313,6 +933,17 @@ func evalNegation(node *jparse.NegationNode, data reflect.Value, env *environmen
 		return undefined, err
 	}
 
+	if jtypes.IsDecimal(rhs) {
+		n, _ := jtypes.AsDecimal(rhs)
+		return reflect.ValueOf(new(big.Rat).Neg(n)), nil
+	}
+
+	if jtypes.IsJSONNumber(rhs) {
+		if n, ok := jtypes.AsInteger(rhs); ok && n != math.MinInt64 {
+			return reflect.ValueOf(json.Number(strconv.FormatInt(-n, 10))), nil
+		}
+	}
+
 	n, ok := jtypes.AsNumber(rhs)
 	if !ok {
 		return undefined, newEvalError(ErrNonNumberRHS, node.RHS, "-")
@@ -327,6 +958,10 @@ func evalNegation(node *jparse.NegationNode, data reflect.Value, env *environmen
 // We use the maximum value allowed by the jsonata-js library
 const maxRangeItems = 10000000
 
+// rangeCheckInterval is the number of items evalRange creates
+// between checks for cancellation.
+const rangeCheckInterval = 1 << 16
+
 func isInteger(x float64) bool {
 	return x == math.Trunc(x)
 }
@@ -376,9 +1011,18 @@ func evalRange(node *jparse.RangeNode, data reflect.Value, env *environment) (re
 		return undefined, newEvalError(ErrMaxRangeItems, "..", nil)
 	}
 
+	if err := env.state.checkLen(size); err != nil {
+		return undefined, err
+	}
+
 	results := reflect.MakeSlice(typeInterfaceSlice, size, size)
 
 	for i := 0; i < size; i++ {
+		if i%rangeCheckInterval == 0 {
+			if err := env.state.checkCancel(); err != nil {
+				return undefined, err
+			}
+		}
 		results.Index(i).Set(reflect.ValueOf(lhs))
 		lhs++
 	}
@@ -428,9 +1072,18 @@ func evalArray(node *jparse.ArrayNode, data reflect.Value, env *environment) (re
 }
 
 func evalObject(node *jparse.ObjectNode, data reflect.Value, env *environment) (reflect.Value, error) {
+	return evalObjectWithTuples(node, data, nil, env)
+}
+
+// evalObjectWithTuples is like evalObject but it also takes
+// the pathItem for each item in data. If tuples is not nil,
+// the object's keys and values are evaluated in environments
+// that hold the ancestries and bindings of the items they are
+// evaluated against.
+func evalObjectWithTuples(node *jparse.ObjectNode, data reflect.Value, tuples []pathItem, env *environment) (reflect.Value, error) {
 	data = makeArray(data)
 
-	keys, err := groupItemsByKey(node, data, env)
+	keys, err := groupItemsByKey(node, data, tuples, env)
 	if err != nil {
 		return undefined, err
 	}
@@ -448,7 +1101,12 @@ func evalObject(node *jparse.ObjectNode, data reflect.Value, env *environment) (
 			}
 		}
 
-		value, err := eval(node.Pairs[idx.pair][1], items, env)
+		valueEnv := env
+		if tuples != nil {
+			valueEnv = groupEnv(env, tuples, idx.items)
+		}
+
+		value, err := eval(node.Pairs[idx.pair][1], items, valueEnv)
 		if err != nil {
 			return undefined, err
 		}
@@ -461,12 +1119,97 @@ func evalObject(node *jparse.ObjectNode, data reflect.Value, env *environment) (
 	return reflect.ValueOf(results), nil
 }
 
+// groupEnv returns the environment in which to evaluate the
+// value of a group of items, given the pathItems for all the
+// items and the indexes of the items in the group. An empty
+// list of indexes means all of the items. If the group has
+// more than one item, each variable bound by the items is
+// an array of the values bound by each item.
+func groupEnv(env *environment, tuples []pathItem, indexes []int) *environment {
+
+	if len(indexes) == 0 {
+		indexes = make([]int, len(tuples))
+		for i := range indexes {
+			indexes[i] = i
+		}
+	}
+
+	if len(indexes) == 1 {
+		return tuples[indexes[0]].env(env)
+	}
+
+	parents := make([]*ancestry, len(indexes))
+	for i, j := range indexes {
+		parents[i] = tuples[j].parents
+	}
+
+	env = env.withAncestry(groupAncestry(parents))
+
+	var names []string
+	values := map[string][]interface{}{}
+
+	for _, j := range indexes {
+		seen := map[string]bool{}
+		for b := tuples[j].bindings; b != nil; b = b.next {
+			if seen[b.name] {
+				continue
+			}
+			seen[b.name] = true
+			if _, ok := values[b.name]; !ok {
+				names = append(names, b.name)
+				values[b.name] = nil
+			}
+			if b.value.IsValid() && b.value.CanInterface() {
+				values[b.name] = append(values[b.name], b.value.Interface())
+			}
+		}
+	}
+
+	for _, name := range names {
+		env.bind(name, reflect.ValueOf(values[name]))
+	}
+
+	return env
+}
+
+// groupAncestry returns the ancestry of a group of items, given
+// the ancestries of the items in the group. If the items have
+// different parents, the parent of the group is an array of
+// those parents.
+func groupAncestry(parents []*ancestry) *ancestry {
+
+	var values []interface{}
+	seen := map[*ancestry]bool{}
+
+	for _, a := range parents {
+		if seen[a] {
+			continue
+		}
+		seen[a] = true
+		if a.value.IsValid() && a.value.CanInterface() {
+			values = append(values, a.value.Interface())
+		}
+	}
+
+	switch {
+	case len(seen) == 1:
+		return parents[0]
+	case len(values) == 0:
+		return noAncestry
+	default:
+		return &ancestry{
+			value:  reflect.ValueOf(values),
+			parent: noAncestry,
+		}
+	}
+}
+
 type keyIndexes struct {
 	pair  int
 	items []int
 }
 
-func groupItemsByKey(obj *jparse.ObjectNode, items reflect.Value, env *environment) (map[string]keyIndexes, error) {
+func groupItemsByKey(obj *jparse.ObjectNode, items reflect.Value, tuples []pathItem, env *environment) (map[string]keyIndexes, error) {
 	nItems := items.Len()
 	results := make(map[string]keyIndexes, len(obj.Pairs))
 
@@ -489,7 +1232,12 @@ func groupItemsByKey(obj *jparse.ObjectNode, items reflect.Value, env *environme
 
 		for j := 0; j < nItems; j++ {
 
-			v, err := eval(keyNode, items.Index(j), env)
+			keyEnv := env
+			if tuples != nil {
+				keyEnv = tuples[j].env(env)
+			}
+
+			v, err := eval(keyNode, items.Index(j), keyEnv)
 			if err != nil {
 				return nil, err
 			}
@@ -614,7 +1362,23 @@ func recurseDescendents(seq *sequence, v reflect.Value) {
 	})
 }
 
+func evalParent(node *jparse.ParentNode, data reflect.Value, env *environment) (reflect.Value, error) {
+	parents := env.ancestry()
+	if parents == nil || parents == noAncestry {
+		return undefined, newEvalError(ErrNoParent, node, nil)
+	}
+	return parents.value, nil
+}
+
 func evalGroup(node *jparse.GroupNode, data reflect.Value, env *environment) (reflect.Value, error) {
+	if path, ok := node.Expr.(*jparse.PathNode); ok && path.Tuples {
+		items, tuples, err := evalPathArray(path, data, env)
+		if err != nil {
+			return undefined, err
+		}
+		return evalObjectWithTuples(node.ObjectNode, items, tuples, env)
+	}
+
 	items, err := eval(node.Expr, data, env)
 	if err != nil {
 		return undefined, err
@@ -623,12 +1387,41 @@ func evalGroup(node *jparse.GroupNode, data reflect.Value, env *environment) (re
 	return evalObject(node.ObjectNode, items, env)
 }
 
+// evalPathArray evaluates a tuple path for a sort or a group.
+// It returns the values yielded by the path as an array, along
+// with the pathItem for each value.
+func evalPathArray(node *jparse.PathNode, data reflect.Value, env *environment) (reflect.Value, []pathItem, error) {
+
+	items, _, err := evalPathItems(node, data, nil, env)
+	if err != nil || len(items) == 0 {
+		return undefined, nil, err
+	}
+
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		values[i] = item.value.Interface()
+	}
+
+	return reflect.ValueOf(values), items, nil
+}
+
 func evalPredicate(node *jparse.PredicateNode, data reflect.Value, env *environment) (reflect.Value, error) {
 	items, err := eval(node.Expr, data, env)
 	if err != nil || items == undefined {
 		return undefined, err
 	}
 
+	// When tracking parents, the filters are evaluated against
+	// the children of the context value.
+	if parents := env.ancestry(); parents != nil {
+		if _, isVar := node.Expr.(*jparse.VariableNode); !isVar {
+			env = env.withAncestry(&ancestry{
+				value:  data,
+				parent: parents,
+			})
+		}
+	}
+
 	for _, filter := range node.Filters {
 
 		// TODO: If this filter is of type *jparse.NumberNode,
@@ -693,7 +1486,7 @@ type sortinfo struct {
 	values []reflect.Value
 }
 
-func buildSortInfo(items reflect.Value, terms []jparse.SortTerm, env *environment) ([]*sortinfo, error) {
+func buildSortInfo(items reflect.Value, tuples []pathItem, terms []jparse.SortTerm, env *environment) ([]*sortinfo, error) {
 	info := make([]*sortinfo, items.Len())
 
 	isNumberTerm := make([]bool, len(terms))
@@ -704,9 +1497,14 @@ func buildSortInfo(items reflect.Value, terms []jparse.SortTerm, env *environmen
 		item := items.Index(i)
 		values := make([]reflect.Value, len(terms))
 
+		itemEnv := env
+		if tuples != nil {
+			itemEnv = tuples[i].env(env)
+		}
+
 		for j, term := range terms {
 
-			v, err := eval(term.Expr, item, env)
+			v, err := eval(term.Expr, item, itemEnv)
 			if err != nil {
 				return nil, err
 			}
@@ -776,14 +1574,23 @@ func makeLessFunc(info []*sortinfo, terms []jparse.SortTerm) func(int, int) bool
 }
 
 func evalSort(node *jparse.SortNode, data reflect.Value, env *environment) (reflect.Value, error) {
-	items, err := eval(node.Expr, data, env)
+	var items reflect.Value
+	var tuples []pathItem
+	var err error
+
+	if path, ok := node.Expr.(*jparse.PathNode); ok && path.Tuples {
+		items, tuples, err = evalPathArray(path, data, env)
+	} else {
+		items, err = eval(node.Expr, data, env)
+	}
+
 	if err != nil || items == undefined {
 		return undefined, err
 	}
 
 	items = arrayify(items)
 
-	info, err := buildSortInfo(items, node.Terms, env)
+	info, err := buildSortInfo(items, tuples, node.Terms, env)
 	if err != nil {
 		return undefined, err
 	}
@@ -851,7 +1658,9 @@ func evalPartial(node *jparse.PartialNode, data reflect.Value, env *environment)
 
 	fn, ok := jtypes.AsCallable(v)
 	if !ok {
-		return undefined, newEvalError(ErrNonCallablePartial, node.Func, nil)
+		err := newEvalError(ErrNonCallablePartial, node.Func, nil)
+		setErrorLocation(err, node.Func, evalSource(env))
+		return undefined, err
 	}
 
 	f := &partialCallable{
@@ -867,47 +1676,237 @@ func evalPartial(node *jparse.PartialNode, data reflect.Value, env *environment)
 	return reflect.ValueOf(f), nil
 }
 
-type nameSetter interface {
-	SetName(string)
+func evalFunctionCall(node *jparse.FunctionCallNode, data reflect.Value, env *environment) (reflect.Value, error) {
+	return callFunction(node.Func, node.Args, data, env)
 }
 
-type contextSetter interface {
-	SetContext(reflect.Value)
+func callFunction(fnNode jparse.Node, args []jparse.Node, data reflect.Value, env *environment) (reflect.Value, error) {
+	fn, argv, err := evalCall(fnNode, args, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	return callProfiled(fn, argv, env)
 }
 
-func evalFunctionCall(node *jparse.FunctionCallNode, data reflect.Value, env *environment) (reflect.Value, error) {
-	v, err := eval(node.Func, data, env)
+// callProfiled calls fn, recording the call if the evaluation
+// is being profiled. Lambdas record their own calls (see
+// lambdaCallable.Call) so they are not recorded here.
+func callProfiled(fn jtypes.Callable, argv []reflect.Value, env *environment) (reflect.Value, error) {
+
+	if _, ok := fn.(*lambdaCallable); ok || env.state.profiler() == nil {
+		return fn.Call(argv)
+	}
+
+	start := env.state.profileCallStart(fn.Name())
+	v, err := fn.Call(argv)
+	env.state.profileCall(fn.Name(), start, v)
+
+	return v, err
+}
+
+// evalCall evaluates the function and arguments of a function
+// call. It returns the Callable and the argument values.
+func evalCall(fnNode jparse.Node, args []jparse.Node, data reflect.Value, env *environment) (jtypes.Callable, []reflect.Value, error) {
+	v, err := eval(fnNode, data, env)
 	if err != nil {
-		return undefined, err
+		return nil, nil, err
 	}
 
 	fn, ok := jtypes.AsCallable(v)
 	if !ok {
-		return undefined, newEvalError(ErrNonCallable, node.Func, nil)
+		err := newEvalError(ErrNonCallable, fnNode, nil)
+		setErrorLocation(err, fnNode, evalSource(env))
+		return nil, nil, err
 	}
 
-	if setter, ok := fn.(nameSetter); ok {
-		if sym, ok := node.Func.(*jparse.VariableNode); ok {
-			setter.SetName(sym.Name)
-		}
+	var name string
+	if sym, ok := fnNode.(*jparse.VariableNode); ok {
+		name = sym.Name
 	}
 
-	if setter, ok := fn.(contextSetter); ok {
-		setter.SetContext(data)
-	}
+	fn = callSite(fn, name, data, env)
 
-	argv := make([]reflect.Value, len(node.Args))
-	for i, arg := range node.Args {
+	argv := make([]reflect.Value, len(args))
+	for i, arg := range args {
 
 		v, err := eval(arg, data, env)
 		if err != nil {
-			return undefined, err
+			return nil, nil, err
 		}
 
 		argv[i] = v
 	}
 
-	return fn.Call(argv)
+	return fn, argv, nil
+}
+
+// A tailCall is a call to a lambda in tail position, i.e. a
+// call whose result is the result of the calling lambda.
+type tailCall struct {
+	fn   *lambdaCallable
+	argv []reflect.Value
+}
+
+// evalTail evaluates the body of a lambda. It is like eval
+// except that, instead of calling a lambda in tail position,
+// it returns the call to lambdaCallable.Call, which makes it
+// in a loop. This means that tail-recursive functions run in
+// constant stack space. Function calls are in tail position
+// if they are the whole body, the last expression in a block
+// or a branch of a conditional in tail position.
+func evalTail(node jparse.Node, data reflect.Value, env *environment) (reflect.Value, *tailCall, error) {
+
+	switch node := node.(type) {
+	case *jparse.FunctionCallNode:
+		v, tc, err := evalTailCall(node.Func, node.Args, data, env)
+		if err != nil {
+			// See eval.
+			setErrorLocation(err, node, evalSource(env))
+		}
+		return v, tc, err
+
+	case *jparse.FunctionApplicationNode:
+		if f, ok := node.RHS.(*jparse.FunctionCallNode); ok {
+			args := make([]jparse.Node, 0, len(f.Args)+1)
+			args = append(args, node.LHS)
+			args = append(args, f.Args...)
+			v, tc, err := evalTailCall(f.Func, args, data, env)
+			if err != nil {
+				setErrorLocation(err, node, evalSource(env))
+			}
+			return v, tc, err
+		}
+
+	case *jparse.ConditionalNode:
+		if err := evalStep(env); err != nil {
+			return undefined, nil, err
+		}
+
+		v, err := eval(node.If, data, env)
+		if err != nil {
+			return undefined, nil, err
+		}
+
+		if jlib.Boolean(v) {
+			return evalTail(node.Then, data, env)
+		}
+
+		if node.Else != nil {
+			return evalTail(node.Else, data, env)
+		}
+
+		return undefined, nil, nil
+
+	case *jparse.BlockNode:
+		if len(node.Exprs) == 0 {
+			break
+		}
+
+		if err := evalStep(env); err != nil {
+			return undefined, nil, err
+		}
+
+		// See evalBlock.
+		env = newEnvironment(env, 0)
+
+		last := len(node.Exprs) - 1
+		for _, node := range node.Exprs[:last] {
+			if _, err := eval(node, data, env); err != nil {
+				return undefined, nil, err
+			}
+		}
+
+		return evalTail(node.Exprs[last], data, env)
+	}
+
+	v, err := eval(node, data, env)
+	return v, nil, err
+}
+
+func evalTailCall(fnNode jparse.Node, args []jparse.Node, data reflect.Value, env *environment) (reflect.Value, *tailCall, error) {
+	if err := evalStep(env); err != nil {
+		return undefined, nil, err
+	}
+
+	fn, argv, err := evalCall(fnNode, args, data, env)
+	if err != nil {
+		return undefined, nil, err
+	}
+
+	if f, ok := fn.(*lambdaCallable); ok {
+		return undefined, &tailCall{
+			fn:   f,
+			argv: argv,
+		}, nil
+	}
+
+	v, err := callProfiled(fn, argv, env)
+	if err != nil {
+		return undefined, nil, err
+	}
+
+	v, err = evalResult(v, env)
+	return v, nil, err
+}
+
+// callSite returns the Callable to use for a function call.
+// Some callables report errors using the name they were called
+// by, and Go functions can receive the input at the point of
+// call as an argument. Callables can be shared by concurrent
+// evaluations, so instead of modifying fn, callSite returns a
+// copy with the given name and input. The $eval function also
+// needs the environment it is called from.
+func callSite(fn jtypes.Callable, name string, data reflect.Value, env *environment) jtypes.Callable {
+
+	rename := name != "" && name != fn.Name()
+
+	switch f := fn.(type) {
+	case *goCallable:
+		if !rename && f.contextHandler == nil {
+			return f
+		}
+		c := *f
+		c.context = data
+		if rename {
+			c.name = name
+		}
+		return &c
+	case *lambdaCallable:
+		if rename {
+			c := *f
+			c.name = name
+			return &c
+		}
+	case *partialCallable:
+		if rename {
+			c := *f
+			c.name = name
+			return &c
+		}
+	case *transformationCallable:
+		if rename {
+			c := *f
+			c.name = name
+			return &c
+		}
+	case *regexCallable:
+		if rename {
+			c := *f
+			c.name = name
+			return &c
+		}
+	case *evalCallable:
+		c := *f
+		c.env = env
+		c.context = data
+		if rename {
+			c.name = name
+		}
+		return &c
+	}
+
+	return fn
 }
 
 func evalFunctionApplication(node *jparse.FunctionApplicationNode, data reflect.Value, env *environment) (reflect.Value, error) {
@@ -916,8 +1915,10 @@ func evalFunctionApplication(node *jparse.FunctionApplicationNode, data reflect.
 	// evaluate it.
 	if f, ok := node.RHS.(*jparse.FunctionCallNode); ok {
 
-		f.Args = append([]jparse.Node{node.LHS}, f.Args...)
-		return evalFunctionCall(f, data, env)
+		args := make([]jparse.Node, 0, len(f.Args)+1)
+		args = append(args, node.LHS)
+		args = append(args, f.Args...)
+		return callFunction(f.Func, args, data, env)
 	}
 
 	// Evaluate both sides and return any errors.
@@ -934,7 +1935,9 @@ func evalFunctionApplication(node *jparse.FunctionApplicationNode, data reflect.
 	// Check that the right hand side is callable.
 	f2, ok := jtypes.AsCallable(rhs)
 	if !ok {
-		return undefined, newEvalError(ErrNonCallableApply, node.RHS, "~>")
+		err := newEvalError(ErrNonCallableApply, node.RHS, "~>")
+		setErrorLocation(err, node.RHS, evalSource(env))
+		return undefined, err
 	}
 
 	// If the left hand side is not callable, call the right
@@ -957,24 +1960,24 @@ func evalFunctionApplication(node *jparse.FunctionApplicationNode, data reflect.
 }
 
 func evalNumericOperator(node *jparse.NumericOperatorNode, data reflect.Value, env *environment) (reflect.Value, error) {
-	evaluate := func(node jparse.Node) (float64, bool, bool, error) {
+	evaluate := func(node jparse.Node) (reflect.Value, float64, bool, bool, error) {
 
 		v, err := eval(node, data, env)
 		if err != nil || v == undefined {
-			return 0, false, false, err
+			return undefined, 0, false, false, err
 		}
 
 		n, isNum := jtypes.AsNumber(v)
-		return n, true, isNum, nil
+		return v, n, true, isNum, nil
 	}
 
 	// Evaluate both sides and return any errors.
-	lhs, lhsOK, lhsNumber, err := evaluate(node.LHS)
+	lhsV, lhs, lhsOK, lhsNumber, err := evaluate(node.LHS)
 	if err != nil {
 		return undefined, err
 	}
 
-	rhs, rhsOK, rhsNumber, err := evaluate(node.RHS)
+	rhsV, rhs, rhsOK, rhsNumber, err := evaluate(node.RHS)
 	if err != nil {
 		return undefined, err
 	}
@@ -993,6 +1996,16 @@ func evalNumericOperator(node *jparse.NumericOperatorNode, data reflect.Value, e
 		return undefined, nil
 	}
 
+	if env.state.decimal() {
+		return evalDecimalOperator(node, lhsV, rhsV)
+	}
+
+	// Use integer arithmetic on json.Numbers where possible
+	// so that large integers do not lose precision.
+	if v, ok := evalIntegerOperator(node.Type, lhsV, rhsV); ok {
+		return v, nil
+	}
+
 	var x float64
 
 	switch node.Type {
@@ -1021,6 +2034,97 @@ func evalNumericOperator(node *jparse.NumericOperatorNode, data reflect.Value, e
 	return reflect.ValueOf(x), nil
 }
 
+// evalIntegerOperator applies a numeric operator to two
+// integers, at least one of which is a json.Number, and
+// returns the result as a json.Number. The second return
+// value is false if the operands are not integers or if
+// the result cannot be represented exactly as an integer
+// (e.g. it overflows), in which case the caller should
+// fall back to floating point arithmetic.
+func evalIntegerOperator(op jparse.NumericOperator, lhs, rhs reflect.Value) (reflect.Value, bool) {
+
+	x, y, ok := asIntegers(lhs, rhs)
+	if !ok {
+		return undefined, false
+	}
+
+	var z int64
+
+	switch op {
+	case jparse.NumericAdd:
+		z = x + y
+		if (z > x) != (y > 0) {
+			return undefined, false
+		}
+	case jparse.NumericSubtract:
+		z = x - y
+		if (z < x) != (y > 0) {
+			return undefined, false
+		}
+	case jparse.NumericMultiply:
+		z = x * y
+		if x != 0 && (z/x != y || (x == -1 && y == math.MinInt64)) {
+			return undefined, false
+		}
+	case jparse.NumericModulo:
+		if y == 0 {
+			return undefined, false
+		}
+		z = x % y
+	default:
+		return undefined, false
+	}
+
+	return reflect.ValueOf(json.Number(strconv.FormatInt(z, 10))), true
+}
+
+// evalDecimalOperator applies a numeric operator to two
+// numbers using exact rational arithmetic. It is used in
+// decimal mode.
+func evalDecimalOperator(node *jparse.NumericOperatorNode, lhs, rhs reflect.Value) (reflect.Value, error) {
+
+	x, ok := jtypes.AsDecimal(lhs)
+	if !ok {
+		return undefined, newEvalError(ErrNonNumberLHS, node.LHS, node.Type)
+	}
+
+	y, ok := jtypes.AsDecimal(rhs)
+	if !ok {
+		return undefined, newEvalError(ErrNonNumberRHS, node.RHS, node.Type)
+	}
+
+	z := new(big.Rat)
+
+	switch node.Type {
+	case jparse.NumericAdd:
+		z.Add(x, y)
+	case jparse.NumericSubtract:
+		z.Sub(x, y)
+	case jparse.NumericMultiply:
+		z.Mul(x, y)
+	case jparse.NumericDivide:
+		if y.Sign() == 0 {
+			if x.Sign() == 0 {
+				return undefined, newEvalError(ErrNumberNaN, nil, node.Type)
+			}
+			return undefined, newEvalError(ErrNumberInf, nil, node.Type)
+		}
+		z.Quo(x, y)
+	case jparse.NumericModulo:
+		if y.Sign() == 0 {
+			return undefined, newEvalError(ErrNumberNaN, nil, node.Type)
+		}
+		// Like math.Mod, the result has the sign of x.
+		z.Quo(x, y)
+		z.SetInt(new(big.Int).Quo(z.Num(), z.Denom()))
+		z.Sub(x, z.Mul(z, y))
+	default:
+		panicf("unrecognised numeric operator %q", node.Type)
+	}
+
+	return reflect.ValueOf(z), nil
+}
+
 // See https://docs.jsonata.org/expressions#comparison-expressions
 func evalComparisonOperator(node *jparse.ComparisonOperatorNode, data reflect.Value, env *environment) (reflect.Value, error) {
 	evaluate := func(node jparse.Node) (reflect.Value, bool, bool, error) {
@@ -1107,6 +2211,10 @@ func eq(lhs, rhs reflect.Value) bool {
 	// they're still considered equal if they have the
 	// same value.
 
+	if c, ok := compareExact(lhs, rhs); ok {
+		return c == 0
+	}
+
 	if v1, ok := jtypes.AsNumber(lhs); ok {
 		v2, ok := jtypes.AsNumber(rhs)
 		return ok && v1 == v2
@@ -1147,6 +2255,10 @@ func eq(lhs, rhs reflect.Value) bool {
 }
 
 func lt(lhs, rhs reflect.Value) bool {
+	if c, ok := compareExact(lhs, rhs); ok {
+		return c < 0
+	}
+
 	if v1, ok := jtypes.AsNumber(lhs); ok {
 		if v2, ok := jtypes.AsNumber(rhs); ok {
 			return v1 < v2
@@ -1163,6 +2275,54 @@ func lt(lhs, rhs reflect.Value) bool {
 	return false
 }
 
+// compareExact compares two numbers without converting them
+// to float64, which would lose precision. It is used when at
+// least one of the numbers is a json.Number or a decimal. The
+// result is -1, 0 or +1 depending on whether lhs is less than,
+// equal to or greater than rhs. The second return value is
+// false if the numbers cannot be compared exactly.
+func compareExact(lhs, rhs reflect.Value) (int, bool) {
+
+	if !jtypes.IsJSONNumber(lhs) && !jtypes.IsJSONNumber(rhs) &&
+		!jtypes.IsDecimal(lhs) && !jtypes.IsDecimal(rhs) {
+		return 0, false
+	}
+
+	x, ok := jtypes.AsDecimal(lhs)
+	if !ok {
+		return 0, false
+	}
+
+	y, ok := jtypes.AsDecimal(rhs)
+	if !ok {
+		return 0, false
+	}
+
+	return x.Cmp(y), true
+}
+
+// asIntegers returns the values of lhs and rhs as int64s if
+// at least one of them is a json.Number and both of them are
+// integers.
+func asIntegers(lhs, rhs reflect.Value) (int64, int64, bool) {
+
+	if !jtypes.IsJSONNumber(lhs) && !jtypes.IsJSONNumber(rhs) {
+		return 0, 0, false
+	}
+
+	i1, ok := jtypes.AsInteger(lhs)
+	if !ok {
+		return 0, 0, false
+	}
+
+	i2, ok := jtypes.AsInteger(rhs)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return i1, i2, true
+}
+
 func lte(lhs, rhs reflect.Value) bool {
 	return lt(lhs, rhs) || eq(lhs, rhs)
 }
@@ -1246,7 +2406,23 @@ func evalStringConcatenation(node *jparse.StringConcatenationNode, data reflect.
 // Helper functions
 
 func walkObjectValues(v reflect.Value, fn func(reflect.Value)) {
-	switch v := jtypes.Resolve(v); {
+	v = jtypes.Resolve(v)
+
+	if arr, ok := jtypes.AsInterfaceSlice(v); ok {
+		for _, x := range arr {
+			fn(jtypes.ValueOf(x))
+		}
+		return
+	}
+
+	if m, ok := jtypes.AsInterfaceMap(v); ok {
+		for _, x := range m {
+			fn(jtypes.ValueOf(x))
+		}
+		return
+	}
+
+	switch {
 	case jtypes.IsArray(v):
 		for i, N := 0, v.Len(); i < N; i++ {
 			fn(v.Index(i))
@@ -1256,8 +2432,10 @@ func walkObjectValues(v reflect.Value, fn func(reflect.Value)) {
 			fn(v.MapIndex(k))
 		}
 	case jtypes.IsStruct(v):
-		for i, N := 0, v.NumField(); i < N; i++ {
-			fn(v.Field(i))
+		for _, f := range jtypes.StructFields(v.Type()) {
+			if v := f.Value(v); v.IsValid() {
+				fn(v)
+			}
 		}
 	}
 }
@@ -1271,20 +2449,30 @@ func normalizeArray(v reflect.Value) reflect.Value {
 }
 
 func flattenArray(v reflect.Value) reflect.Value {
-	results := reflect.MakeSlice(typeInterfaceSlice, 0, 0)
+	return reflect.ValueOf(appendFlattened([]interface{}{}, v))
+}
 
+func appendFlattened(results []interface{}, v reflect.Value) []interface{} {
 	switch {
 	case jtypes.IsArray(v):
 		v = jtypes.Resolve(v)
-		for i, N := 0, v.Len(); i < N; i++ {
-			vi := flattenArray(v.Index(i))
-			if vi.IsValid() {
-				results = reflect.AppendSlice(results, vi)
+		if arr, ok := jtypes.AsInterfaceSlice(v); ok {
+			for _, x := range arr {
+				switch x.(type) {
+				case nil, bool, float64, string, map[string]interface{}:
+					results = append(results, x)
+				default:
+					results = appendFlattened(results, reflect.ValueOf(x))
+				}
 			}
+			return results
+		}
+		for i, N := 0, v.Len(); i < N; i++ {
+			results = appendFlattened(results, v.Index(i))
 		}
 	default:
 		if v.IsValid() {
-			results = reflect.Append(results, v)
+			results = append(results, v.Interface())
 		}
 	}
 
@@ -1352,11 +2540,7 @@ func (s sequence) Value() reflect.Value {
 }
 
 func (s sequence) valueAt(idx int) reflect.Value {
-	v := s.values[idx]
-	if v == nil {
-		return nullValue()
-	}
-	return reflect.ValueOf(v)
+	return jtypes.ValueOf(s.values[idx])
 }
 
 var (
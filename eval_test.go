@@ -4312,7 +4312,7 @@ func testEvalTestCases(t *testing.T, tests []evalTestCase) {
 			t.Errorf("%s: Expected %v, got %v", test.Input, test.Output, output)
 		}
 
-		if !reflect.DeepEqual(err, test.Error) {
+		if !reflect.DeepEqual(clearLocation(err), test.Error) {
 			t.Errorf("%s: Expected error %v, got %v", test.Input, test.Error, err)
 		}
 	}
@@ -52,3 +52,33 @@ func ExampleExpr_RegisterExts() {
 	fmt.Println(res)
 	// Output: Beneath The Underdog
 }
+
+func ExampleCompileWith() {
+
+	// Create a registry containing the titlecase function.
+	// Freezing the registry prevents further changes, which
+	// allows expressions to share it without copying.
+	r := jsonata.NewRegistry()
+
+	err := r.RegisterExts(exts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r.Freeze()
+
+	// Create an expression that uses the titlecase function.
+	e, err := jsonata.CompileWith(`$titlecase("beneath the underdog")`, r)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Evaluate.
+	res, err := e.Eval(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(res)
+	// Output: Beneath The Underdog
+}
@@ -5,7 +5,6 @@
 package jlib
 
 import (
-	"fmt"
 	"reflect"
 
 	"github.com/stepzen-dev/jsonata-go/jtypes"
@@ -19,19 +18,18 @@ func Sum(v reflect.Value) (float64, error) {
 		if n, ok := jtypes.AsNumber(v); ok {
 			return n, nil
 		}
-		return 0, fmt.Errorf("cannot call sum on a non-array type")
+		return 0, newError("sum", ErrNonNumberArray)
 	}
 
 	v = jtypes.Resolve(v)
 
 	var sum float64
 
-	for i := 0; i < v.Len(); i++ {
-		n, ok := jtypes.AsNumber(v.Index(i))
-		if !ok {
-			return 0, fmt.Errorf("cannot call sum on an array with non-number types")
-		}
+	ok := eachNumber(v, func(_ int, n float64) {
 		sum += n
+	})
+	if !ok {
+		return 0, newError("sum", ErrNonNumberArray)
 	}
 
 	return sum, nil
@@ -45,7 +43,7 @@ func Max(v reflect.Value) (float64, error) {
 		if n, ok := jtypes.AsNumber(v); ok {
 			return n, nil
 		}
-		return 0, fmt.Errorf("cannot call max on a non-array type")
+		return 0, newError("max", ErrNonNumberArray)
 	}
 
 	v = jtypes.Resolve(v)
@@ -55,14 +53,13 @@ func Max(v reflect.Value) (float64, error) {
 
 	var max float64
 
-	for i := 0; i < v.Len(); i++ {
-		n, ok := jtypes.AsNumber(v.Index(i))
-		if !ok {
-			return 0, fmt.Errorf("cannot call max on an array with non-number types")
-		}
+	ok := eachNumber(v, func(i int, n float64) {
 		if i == 0 || n > max {
 			max = n
 		}
+	})
+	if !ok {
+		return 0, newError("max", ErrNonNumberArray)
 	}
 
 	return max, nil
@@ -76,7 +73,7 @@ func Min(v reflect.Value) (float64, error) {
 		if n, ok := jtypes.AsNumber(v); ok {
 			return n, nil
 		}
-		return 0, fmt.Errorf("cannot call min on a non-array type")
+		return 0, newError("min", ErrNonNumberArray)
 	}
 
 	v = jtypes.Resolve(v)
@@ -86,14 +83,13 @@ func Min(v reflect.Value) (float64, error) {
 
 	var min float64
 
-	for i := 0; i < v.Len(); i++ {
-		n, ok := jtypes.AsNumber(v.Index(i))
-		if !ok {
-			return 0, fmt.Errorf("cannot call min on an array with non-number types")
-		}
+	ok := eachNumber(v, func(i int, n float64) {
 		if i == 0 || n < min {
 			min = n
 		}
+	})
+	if !ok {
+		return 0, newError("min", ErrNonNumberArray)
 	}
 
 	return min, nil
@@ -107,7 +103,7 @@ func Average(v reflect.Value) (float64, error) {
 		if n, ok := jtypes.AsNumber(v); ok {
 			return n, nil
 		}
-		return 0, fmt.Errorf("cannot call average on a non-array type")
+		return 0, newError("average", ErrNonNumberArray)
 	}
 
 	v = jtypes.Resolve(v)
@@ -117,13 +113,41 @@ func Average(v reflect.Value) (float64, error) {
 
 	var sum float64
 
-	for i := 0; i < v.Len(); i++ {
+	ok := eachNumber(v, func(_ int, n float64) {
+		sum += n
+	})
+	if !ok {
+		return 0, newError("average", ErrNonNumberArray)
+	}
+
+	return sum / float64(v.Len()), nil
+}
+
+// eachNumber calls fn with the index and value of each element
+// of the array v. It stops and returns false if an element is
+// not a number.
+func eachNumber(v reflect.Value, fn func(int, float64)) bool {
+
+	if arr, ok := jtypes.AsInterfaceSlice(v); ok {
+		for i, x := range arr {
+			n, ok := x.(float64)
+			if !ok {
+				if n, ok = jtypes.AsNumber(reflect.ValueOf(x)); !ok {
+					return false
+				}
+			}
+			fn(i, n)
+		}
+		return true
+	}
+
+	for i, N := 0, v.Len(); i < N; i++ {
 		n, ok := jtypes.AsNumber(v.Index(i))
 		if !ok {
-			return 0, fmt.Errorf("cannot call average on an array with non-number types")
+			return false
 		}
-		sum += n
+		fn(i, n)
 	}
 
-	return sum / float64(v.Len()), nil
+	return true
 }
@@ -6,6 +6,7 @@ package jlib
 
 import (
 	"fmt"
+	"math/big"
 	"math/rand"
 	"reflect"
 	"sort"
@@ -27,6 +28,23 @@ func Count(v reflect.Value) int {
 	return v.Len()
 }
 
+// ratKey is the type used by Distinct to identify decimals
+// that are not equal to any float64. It is distinct from string
+// so that a decimal never matches a string with the same text.
+type ratKey string
+
+// decimalKey returns a hashable value that identifies a decimal.
+// Decimals with the same value as a float64 (converted from its
+// shortest decimal representation, as in jtypes.AsDecimal) are
+// identified by that float64, so that they match it.
+func decimalKey(r *big.Rat) interface{} {
+	f, _ := r.Float64()
+	if d, ok := jtypes.AsDecimal(reflect.ValueOf(f)); ok && d.Cmp(r) == 0 {
+		return f
+	}
+	return ratKey(r.RatString())
+}
+
 // Distinct returns the values passed in with any duplicates removed.
 func Distinct(v reflect.Value) interface{} {
 	v = jtypes.Resolve(v)
@@ -58,11 +76,21 @@ func Distinct(v reflect.Value) interface{} {
 				continue
 			}
 
-			if _, ok := visited[item.Interface()]; ok {
+			// Decimals are not hashable either, so use their
+			// exact string representation. Keep the pointer to
+			// the decimal rather than a copy of it.
+			var key interface{} = item.Interface()
+			if jtypes.IsDecimal(item) {
+				r, _ := jtypes.AsDecimal(item)
+				key = decimalKey(r)
+				item = reflect.ValueOf(r)
+			}
+
+			if _, ok := visited[key]; ok {
 				continue
 			}
 
-			visited[item.Interface()] = struct{}{}
+			visited[key] = struct{}{}
 			distinctValues = reflect.Append(distinctValues, item)
 		}
 		return distinctValues.Interface()
@@ -138,7 +166,7 @@ func Sort(v reflect.Value, swap jtypes.OptionalCallable) (interface{}, error) {
 		return sortStringArray(v), nil
 	}
 
-	return nil, fmt.Errorf("argument 1 of function sort must be an array of strings or numbers")
+	return nil, newError("sort", ErrNonSortable)
 }
 
 func sortNumberArray(v reflect.Value) []interface{} {
@@ -199,7 +227,7 @@ func sortArrayFunc(v reflect.Value, fn jtypes.Callable) (interface{}, error) {
 
 		b, ok := jtypes.AsBool(v)
 		if !ok {
-			return false, fmt.Errorf("argument 2 of function sort must be a function that returns a boolean, got %v (%s)", v, v.Kind())
+			return false, newErrorValue("sort", ErrNonBooleanComparator, fmt.Sprintf("%v (%s)", v, v.Kind()))
 		}
 
 		return b, nil
@@ -261,6 +289,16 @@ func merge(lhs, rhs []interface{}, swapFunc func(interface{}, interface{}) (bool
 
 // Shuffle (golint)
 func Shuffle(v reflect.Value) interface{} {
+	return shuffle(v, rand.Intn)
+}
+
+// ShuffleWith is like Shuffle but it takes its random numbers
+// from r instead of the default source.
+func ShuffleWith(r *rand.Rand, v reflect.Value) interface{} {
+	return shuffle(v, r.Intn)
+}
+
+func shuffle(v reflect.Value, intn func(int) int) interface{} {
 	v = forceArray(jtypes.Resolve(v))
 
 	length := arrayLen(v)
@@ -268,7 +306,7 @@ func Shuffle(v reflect.Value) interface{} {
 
 	for i := 0; i < length; i++ {
 
-		j := rand.Intn(i + 1)
+		j := intn(i + 1)
 
 		if i != j {
 			results[i] = results[j]
@@ -288,7 +326,7 @@ func Zip(vs ...reflect.Value) (interface{}, error) {
 	var size int
 
 	if len(vs) == 0 {
-		return nil, fmt.Errorf("cannot call zip with no arguments")
+		return nil, newError("zip", ErrZipArgs)
 	}
 
 	for i := 0; i < len(vs); i++ {
@@ -54,7 +54,7 @@ func FromMillis(ms int64, picture jtypes.OptionalString, tz jtypes.OptionalStrin
 func parseTimeZone(tz string) (*time.Location, error) {
 	// must be exactly 5 characters
 	if len(tz) != 5 {
-		return nil, fmt.Errorf("invalid timezone")
+		return nil, newErrorValue("fromMillis", ErrInvalidTimezone, tz)
 	}
 
 	plusOrMinus := string(tz[0])
@@ -68,19 +68,19 @@ func parseTimeZone(tz string) (*time.Location, error) {
 	case "+":
 		offsetMultiplier = 1
 	default:
-		return nil, fmt.Errorf("invalid timezone")
+		return nil, newErrorValue("fromMillis", ErrInvalidTimezone, tz)
 	}
 
 	// take the first two digits as "HH"
 	hours, err := strconv.Atoi(tz[1:3])
 	if err != nil {
-		return nil, fmt.Errorf("invalid timezone")
+		return nil, newErrorValue("fromMillis", ErrInvalidTimezone, tz)
 	}
 
 	// take the last two digits as "MM"
 	minutes, err := strconv.Atoi(tz[3:5])
 	if err != nil {
-		return nil, fmt.Errorf("invalid timezone")
+		return nil, newErrorValue("fromMillis", ErrInvalidTimezone, tz)
 	}
 
 	// convert to seconds
@@ -107,7 +107,7 @@ func ToMillis(s string, picture jtypes.OptionalString, tz jtypes.OptionalString)
 		}
 	}
 
-	return 0, fmt.Errorf("could not parse time %q", s)
+	return 0, newErrorValue("toMillis", ErrInvalidTimestamp, s)
 }
 
 var reMinus7 = regexp.MustCompile("-(0*7)")
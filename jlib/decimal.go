@@ -0,0 +1,134 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlib
+
+import (
+	"math/big"
+	"reflect"
+
+	"github.com/stepzen-dev/jsonata-go/jlib/jxpath"
+	"github.com/stepzen-dev/jsonata-go/jtypes"
+)
+
+// The functions in this file are versions of the standard
+// numeric functions that operate on exact rational numbers
+// instead of float64s. They are used in decimal mode, where
+// floating point rounding errors are not acceptable (e.g.
+// when calculating monetary amounts).
+
+// SumDecimal is like Sum but it adds the numbers exactly.
+func SumDecimal(v reflect.Value) (*big.Rat, error) {
+
+	if !jtypes.IsArray(v) {
+		if n, ok := jtypes.AsDecimal(v); ok {
+			return n, nil
+		}
+		return nil, newError("sum", ErrNonNumberArray)
+	}
+
+	v = jtypes.Resolve(v)
+
+	sum := new(big.Rat)
+
+	for i := 0; i < v.Len(); i++ {
+		n, ok := jtypes.AsDecimal(v.Index(i))
+		if !ok {
+			return nil, newError("sum", ErrNonNumberArray)
+		}
+		sum.Add(sum, n)
+	}
+
+	return sum, nil
+}
+
+// AverageDecimal is like Average but it calculates the mean
+// exactly.
+func AverageDecimal(v reflect.Value) (*big.Rat, error) {
+
+	if !jtypes.IsArray(v) {
+		if n, ok := jtypes.AsDecimal(v); ok {
+			return n, nil
+		}
+		return nil, newError("average", ErrNonNumberArray)
+	}
+
+	v = jtypes.Resolve(v)
+	if v.Len() == 0 {
+		return nil, jtypes.ErrUndefined
+	}
+
+	sum := new(big.Rat)
+
+	for i := 0; i < v.Len(); i++ {
+		n, ok := jtypes.AsDecimal(v.Index(i))
+		if !ok {
+			return nil, newError("average", ErrNonNumberArray)
+		}
+		sum.Add(sum, n)
+	}
+
+	return sum.Quo(sum, big.NewRat(int64(v.Len()), 1)), nil
+}
+
+// RoundDecimal is like Round but it rounds an exact number,
+// so halfway values such as 2.675 are always detected.
+func RoundDecimal(x *big.Rat, prec jtypes.OptionalInt) *big.Rat {
+
+	scale := pow10Rat(prec.Int)
+
+	y := new(big.Rat).Mul(x, scale)
+	if y.IsInt() {
+		return x
+	}
+
+	// Truncate towards zero, then adjust based on the
+	// size of the remainder. Halfway values are rounded
+	// to the nearest even number.
+	q, r := new(big.Int).QuoRem(y.Num(), y.Denom(), new(big.Int))
+
+	r.Abs(r).Lsh(r, 1)
+	if c := r.Cmp(y.Denom()); c > 0 || (c == 0 && q.Bit(0) == 1) {
+		q.Add(q, big.NewInt(int64(y.Sign())))
+	}
+
+	return y.SetInt(q).Quo(y, scale)
+}
+
+// FormatNumberDecimal is like FormatNumber but it formats an
+// exact number.
+func FormatNumberDecimal(value *big.Rat, picture string, options jtypes.OptionalValue) (string, error) {
+
+	if !options.IsSet() {
+		return jxpath.FormatDecimal(value, picture, defaultDecimalFormat)
+	}
+
+	opts := jtypes.Resolve(options.Value)
+	if !jtypes.IsMap(opts) {
+		return "", newError("formatNumber", ErrNonObjectOptions)
+	}
+
+	format, err := newDecimalFormat(opts)
+	if err != nil {
+		return "", err
+	}
+
+	return jxpath.FormatDecimal(value, picture, format)
+}
+
+// pow10Rat returns 10 to the power of n.
+func pow10Rat(n int) *big.Rat {
+
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	if neg {
+		return new(big.Rat).SetFrac(big.NewInt(1), p)
+	}
+
+	return new(big.Rat).SetInt(p)
+}
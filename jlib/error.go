@@ -4,41 +4,181 @@
 
 package jlib
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // ErrType (golint)
 type ErrType uint
 
-// ErrNanInf (golint)
+// Error types returned by the functions in this package.
 const (
 	_ ErrType = iota
 	ErrNaNInf
+	ErrNonNumberArray
+	ErrNonStringArray
+	ErrNonObjectArray
+	ErrNonObject
+	ErrNonObjectOptions
+	ErrNonStringOption
+	ErrInvalidOption
+	ErrUnknownOption
+	ErrNonSortable
+	ErrNonBooleanComparator
+	ErrZipArgs
+	ErrReduceArgs
+	ErrCallbackArgs
+	ErrSingleNone
+	ErrSingleMany
+	ErrNumberCast
+	ErrPowerRange
+	ErrSqrtNegative
+	ErrRadix
+	ErrNonStringKey
+	ErrPatternType
+	ErrEmptyPattern
+	ErrReplacementType
+	ErrNonStringReplacement
+	ErrReplacementResult
+	ErrSplitLimit
+	ErrMatchLimit
+	ErrReplaceLimit
+	ErrMatcherResult
+	ErrMalformedURL
+	ErrInvalidTimestamp
+	ErrInvalidTimezone
+	ErrInvalidBase64
+	ErrUnknownType
 )
 
+var errmsgs = map[ErrType]string{
+	ErrNaNInf:               "cannot convert NaN/Infinity to string",
+	ErrNonNumberArray:       "argument must be an array of numbers",
+	ErrNonStringArray:       "argument must be an array of strings",
+	ErrNonObjectArray:       "argument must be an object or an array of objects",
+	ErrNonObject:            "argument must be an object",
+	ErrNonObjectOptions:     "decimal format options must be an object",
+	ErrNonStringOption:      "decimal format options must be strings",
+	ErrInvalidOption:        `invalid value for decimal format option "{{value}}"`,
+	ErrUnknownOption:        `unknown decimal format option "{{value}}"`,
+	ErrNonSortable:          "argument 1 must be an array of strings or an array of numbers, or a comparison function must be provided",
+	ErrNonBooleanComparator: "comparison function must return a boolean, got {{value}}",
+	ErrZipArgs:              "at least one argument is required",
+	ErrReduceArgs:           "argument 2 must be a function that takes at least two arguments",
+	ErrCallbackArgs:         "function must take 1, 2 or 3 arguments",
+	ErrSingleNone:           "expected exactly 1 matching value, got 0",
+	ErrSingleMany:           "expected exactly 1 matching value, got {{value}}",
+	ErrNumberCast:           `unable to cast "{{value}}" to a number`,
+	ErrPowerRange:           "result cannot be represented as a JSON number",
+	ErrSqrtNegative:         "cannot be applied to a negative number",
+	ErrRadix:                "radix must be between 2 and 36, got {{value}}",
+	ErrNonStringKey:         "object key must evaluate to a string, got {{value}}",
+	ErrPatternType:          "pattern must be a string or a regex",
+	ErrEmptyPattern:         "pattern cannot be an empty string",
+	ErrReplacementType:      "replacement must be a string or a function",
+	ErrNonStringReplacement: "replacement must be a string when the pattern is a string",
+	ErrReplacementResult:    "replacement function must return a string",
+	ErrSplitLimit:           "limit must be a positive number",
+	ErrMatchLimit:           "limit must be a positive number",
+	ErrReplaceLimit:         "limit must be a positive number",
+	ErrMatcherResult:        "matcher function must return {{value}}",
+	ErrMalformedURL:         `malformed URL "{{value}}"`,
+	ErrInvalidTimestamp:     `could not parse time "{{value}}"`,
+	ErrInvalidTimezone:      `invalid timezone "{{value}}"`,
+	ErrInvalidBase64:        `invalid base 64 string "{{value}}"`,
+	ErrUnknownType:          "unknown type {{value}}",
+}
+
+// errcodes maps error types to the codes used for the same
+// errors by the JavaScript implementation of JSONata.
+var errcodes = map[ErrType]string{
+	ErrNaNInf:               "D3001",
+	ErrNonNumberArray:       "T0412",
+	ErrNonStringArray:       "T0412",
+	ErrNonObjectArray:       "T0412",
+	ErrNonObject:            "T0410",
+	ErrNonObjectOptions:     "T0410",
+	ErrNonSortable:          "D3070",
+	ErrZipArgs:              "T0410",
+	ErrReduceArgs:           "D3050",
+	ErrSingleNone:           "D3139",
+	ErrSingleMany:           "D3138",
+	ErrNumberCast:           "D3030",
+	ErrPowerRange:           "D3061",
+	ErrSqrtNegative:         "D3060",
+	ErrRadix:                "D3100",
+	ErrNonStringKey:         "T1003",
+	ErrPatternType:          "T0410",
+	ErrEmptyPattern:         "D3010",
+	ErrReplacementType:      "T0410",
+	ErrNonStringReplacement: "T0410",
+	ErrReplacementResult:    "D3012",
+	ErrSplitLimit:           "D3020",
+	ErrMatchLimit:           "D3040",
+	ErrReplaceLimit:         "D3011",
+	ErrMatcherResult:        "T1010",
+	ErrMalformedURL:         "D3140",
+	ErrInvalidTimestamp:     "D3110",
+}
+
+// goErrcodes maps error types that have no equivalent in the
+// JavaScript implementation of JSONata to codes that are only
+// used by this implementation. All such codes start with G.
+// Codes for errors returned by functions start with G2.
+var goErrcodes = map[ErrType]string{
+	ErrNonStringOption:      "G2001",
+	ErrInvalidOption:        "G2002",
+	ErrUnknownOption:        "G2003",
+	ErrNonBooleanComparator: "G2004",
+	ErrCallbackArgs:         "G2005",
+	ErrInvalidTimezone:      "G2006",
+	ErrInvalidBase64:        "G2007",
+	ErrUnknownType:          "G2008",
+}
+
 // Error (golint)
 type Error struct {
-	Type ErrType
-	Func string
+	Type  ErrType
+	Func  string
+	Value string
 }
 
 // Error (golint)
 func (e Error) Error() string {
 
-	var msg string
-
-	switch e.Type {
-	case ErrNaNInf:
-		msg = "cannot convert NaN/Infinity to string"
-	default:
+	msg := errmsgs[e.Type]
+	if msg == "" {
 		msg = "unknown error"
 	}
 
+	msg = strings.ReplaceAll(msg, "{{value}}", e.Value)
+
 	return fmt.Sprintf("%s: %s", e.Func, msg)
 }
 
+// Code returns the JSONata error code for the error, e.g.
+// "D3001". Codes match those used by the JavaScript version
+// of JSONata. Errors that have no JavaScript equivalent have
+// codes that start with G.
+func (e Error) Code() string {
+	if code, ok := errcodes[e.Type]; ok {
+		return code
+	}
+	return goErrcodes[e.Type]
+}
+
 func newError(name string, typ ErrType) *Error {
 	return &Error{
 		Func: name,
 		Type: typ,
 	}
 }
+
+func newErrorValue(name string, typ ErrType, value interface{}) *Error {
+	return &Error{
+		Func:  name,
+		Type:  typ,
+		Value: fmt.Sprint(value),
+	}
+}
@@ -5,7 +5,7 @@
 package jlib
 
 import (
-	"fmt"
+	"context"
 	"reflect"
 
 	"github.com/stepzen-dev/jsonata-go/jtypes"
@@ -13,6 +13,13 @@ import (
 
 // Map (golint)
 func Map(v reflect.Value, f jtypes.Callable) (interface{}, error) {
+	return MapContext(context.Background(), v, f)
+}
+
+// MapContext is like Map but it checks ctx before each call
+// to f and returns the context's error if it has been cancelled
+// or its deadline has passed.
+func MapContext(ctx context.Context, v reflect.Value, f jtypes.Callable) (interface{}, error) {
 
 	v = forceArray(jtypes.Resolve(v))
 
@@ -22,6 +29,10 @@ func Map(v reflect.Value, f jtypes.Callable) (interface{}, error) {
 
 	for i := 0; i < arrayLen(v); i++ {
 
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+
 		argv := []reflect.Value{v.Index(i), reflect.ValueOf(i), v}
 
 		res, err := f.Call(argv[:argc])
@@ -38,6 +49,12 @@ func Map(v reflect.Value, f jtypes.Callable) (interface{}, error) {
 
 // Filter (golint)
 func Filter(v reflect.Value, f jtypes.Callable) (interface{}, error) {
+	return FilterContext(context.Background(), v, f)
+}
+
+// FilterContext is like Filter but it checks ctx before each
+// call to f (see MapContext).
+func FilterContext(ctx context.Context, v reflect.Value, f jtypes.Callable) (interface{}, error) {
 
 	v = forceArray(jtypes.Resolve(v))
 
@@ -47,6 +64,10 @@ func Filter(v reflect.Value, f jtypes.Callable) (interface{}, error) {
 
 	for i := 0; i < arrayLen(v); i++ {
 
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+
 		item := v.Index(i)
 		argv := []reflect.Value{item, reflect.ValueOf(i), v}
 
@@ -64,13 +85,19 @@ func Filter(v reflect.Value, f jtypes.Callable) (interface{}, error) {
 
 // Reduce (golint)
 func Reduce(v reflect.Value, f jtypes.Callable, init jtypes.OptionalValue) (interface{}, error) {
+	return ReduceContext(context.Background(), v, f, init)
+}
+
+// ReduceContext is like Reduce but it checks ctx before each
+// call to f (see MapContext).
+func ReduceContext(ctx context.Context, v reflect.Value, f jtypes.Callable, init jtypes.OptionalValue) (interface{}, error) {
 
 	v = forceArray(jtypes.Resolve(v))
 
 	var res reflect.Value
 
 	if f.ParamCount() != 2 {
-		return nil, fmt.Errorf("second argument of function \"reduce\" must be a function that takes two arguments")
+		return nil, newError("reduce", ErrReduceArgs)
 	}
 
 	i := 0
@@ -84,6 +111,9 @@ func Reduce(v reflect.Value, f jtypes.Callable, init jtypes.OptionalValue) (inte
 
 	var err error
 	for ; i < arrayLen(v); i++ {
+		if err = checkContext(ctx); err != nil {
+			return nil, err
+		}
 		res, err = f.Call([]reflect.Value{res, v.Index(i)})
 		if err != nil {
 			return nil, err
@@ -103,7 +133,13 @@ func Reduce(v reflect.Value, f jtypes.Callable, init jtypes.OptionalValue) (inte
 // one.
 // https://docs.jsonata.org/higher-order-functions#single
 func Single(v reflect.Value, f jtypes.Callable) (interface{}, error) {
-	filteredValue, err := Filter(v, f)
+	return SingleContext(context.Background(), v, f)
+}
+
+// SingleContext is like Single but it checks ctx before each
+// call to f (see MapContext).
+func SingleContext(ctx context.Context, v reflect.Value, f jtypes.Callable) (interface{}, error) {
+	filteredValue, err := FilterContext(ctx, v, f)
 	if err != nil {
 		return nil, err
 	}
@@ -114,8 +150,12 @@ func Single(v reflect.Value, f jtypes.Callable) (interface{}, error) {
 		// more than one item in the slice, return a error, otherwise
 		// return the item
 		s := reflect.ValueOf(filteredValue)
-		if s.Len() != 1 {
-			return nil, fmt.Errorf("number of matching values returned by single() must be 1, got: %d", s.Len())
+		switch s.Len() {
+		case 0:
+			return nil, newError("single", ErrSingleNone)
+		case 1:
+		default:
+			return nil, newErrorValue("single", ErrSingleMany, s.Len())
 		}
 		return s.Index(0).Interface(), nil
 
@@ -125,6 +165,17 @@ func Single(v reflect.Value, f jtypes.Callable) (interface{}, error) {
 	}
 }
 
+// checkContext returns the context's error if it has been
+// cancelled or its deadline has passed, and nil otherwise.
+func checkContext(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
 func clamp(n, min, max int) int {
 	switch {
 	case n < min:
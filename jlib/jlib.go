@@ -6,7 +6,6 @@
 package jlib
 
 import (
-	"fmt"
 	"reflect"
 
 	"github.com/stepzen-dev/jsonata-go/jtypes"
@@ -69,7 +68,7 @@ func TypeOf(x interface{}) (string, error) {
 	if jtypes.IsBool(v) {
 		return "boolean", nil
 	}
-	if jtypes.IsMap(v) {
+	if jtypes.IsMap(v) || jtypes.IsStruct(v) {
 		return "object", nil
 	}
 
@@ -79,5 +78,5 @@ func TypeOf(x interface{}) (string, error) {
 	}
 
 	xType := reflect.TypeOf(x).String()
-	return "", fmt.Errorf("unknown type %s", xType)
+	return "", newErrorValue("type", ErrUnknownType, xType)
 }
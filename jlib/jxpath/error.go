@@ -0,0 +1,152 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jxpath
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrType describes the type of an error.
+type ErrType uint
+
+// Error types returned by the formatting functions.
+const (
+	_ ErrType = iota
+
+	// Number pictures.
+	ErrEmptyPicture
+	ErrSubpictureCount
+	ErrDecimalSeparators
+	ErrPercents
+	ErrPerMilles
+	ErrPercentPerMille
+	ErrMantissaDigits
+	ErrPassiveCharacter
+	ErrGroupSeparatorAdjacent
+	ErrGroupSeparatorEnd
+	ErrGroupSeparators
+	ErrIntegerDigits
+	ErrFractionalDigits
+	ErrExponentSeparators
+	ErrPercentExponent
+	ErrExponentDigits
+
+	// Date pictures.
+	ErrUnsupportedFormat
+	ErrUnknownComponent
+	ErrUnterminatedMarker
+	ErrNestedMarker
+	ErrEmptyMarker
+	ErrUnmatchedBracket
+	ErrNoMarkers
+	ErrInvalidWidth
+	ErrNameWidth
+)
+
+var errmsgs = map[ErrType]string{
+	ErrEmptyPicture:           "picture string cannot be empty",
+	ErrSubpictureCount:        "picture string must contain 1 or 2 subpictures",
+	ErrDecimalSeparators:      "a subpicture cannot contain more than one decimal separator",
+	ErrPercents:               "a subpicture cannot contain more than one percent character",
+	ErrPerMilles:              "a subpicture cannot contain more than one per-mille character",
+	ErrPercentPerMille:        "a subpicture cannot contain both percent and per-mille characters",
+	ErrMantissaDigits:         "a mantissa part must contain at least one decimal or optional digit",
+	ErrPassiveCharacter:       "a subpicture cannot contain a passive character that is both preceded by and followed by an active character",
+	ErrGroupSeparatorAdjacent: "a group separator cannot be adjacent to a decimal separator",
+	ErrGroupSeparatorEnd:      "an integer part cannot end with a group separator",
+	ErrGroupSeparators:        "a subpicture cannot contain adjacent group separators",
+	ErrIntegerDigits:          "an integer part cannot contain a decimal digit followed by an optional digit",
+	ErrFractionalDigits:       "a fractional part cannot contain an optional digit followed by a decimal digit",
+	ErrExponentSeparators:     "a subpicture cannot contain more than one exponent separator",
+	ErrPercentExponent:        "a subpicture cannot contain a percent/per-mille character and an exponent separator",
+	ErrExponentDigits:         "an exponent part must consist solely of one or more decimal digits",
+	ErrUnsupportedFormat:      "unsupported date format",
+	ErrUnknownComponent:       "unknown component specifier {{value}}",
+	ErrUnterminatedMarker:     "unterminated variable marker",
+	ErrNestedMarker:           "open bracket inside variable marker",
+	ErrEmptyMarker:            "empty variable marker",
+	ErrUnmatchedBracket:       "closing bracket outside variable marker",
+	ErrNoMarkers:              "no variable markers found",
+	ErrInvalidWidth:           `invalid width modifier "{{value}}"`,
+	ErrNameWidth:              "no name exists for max length {{value}}",
+}
+
+// errcodes maps error types to the codes used for the same
+// errors by the JavaScript implementation of JSONata.
+var errcodes = map[ErrType]string{
+	ErrEmptyPicture:           "D3085",
+	ErrSubpictureCount:        "D3080",
+	ErrDecimalSeparators:      "D3081",
+	ErrPercents:               "D3082",
+	ErrPerMilles:              "D3083",
+	ErrPercentPerMille:        "D3084",
+	ErrMantissaDigits:         "D3085",
+	ErrPassiveCharacter:       "D3086",
+	ErrGroupSeparatorAdjacent: "D3087",
+	ErrGroupSeparatorEnd:      "D3088",
+	ErrGroupSeparators:        "D3089",
+	ErrIntegerDigits:          "D3090",
+	ErrFractionalDigits:       "D3091",
+	ErrPercentExponent:        "D3092",
+	ErrExponentDigits:         "D3093",
+	ErrUnsupportedFormat:      "D3130",
+	ErrUnknownComponent:       "D3132",
+	ErrUnterminatedMarker:     "D3135",
+}
+
+// goErrcodes maps error types that have no equivalent in the
+// JavaScript implementation of JSONata to codes that are only
+// used by this implementation. All such codes start with G.
+// Codes for formatting errors start with G3.
+var goErrcodes = map[ErrType]string{
+	ErrExponentSeparators: "G3001",
+	ErrNestedMarker:       "G3002",
+	ErrEmptyMarker:        "G3003",
+	ErrUnmatchedBracket:   "G3004",
+	ErrNoMarkers:          "G3005",
+	ErrInvalidWidth:       "G3006",
+	ErrNameWidth:          "G3007",
+}
+
+// Error describes an error in a picture string.
+type Error struct {
+	Type  ErrType
+	Value string
+}
+
+func newError(typ ErrType) *Error {
+	return &Error{
+		Type: typ,
+	}
+}
+
+func newErrorValue(typ ErrType, value interface{}) *Error {
+	return &Error{
+		Type:  typ,
+		Value: fmt.Sprint(value),
+	}
+}
+
+func (e Error) Error() string {
+
+	s := errmsgs[e.Type]
+	if s == "" {
+		return fmt.Sprintf("jxpath.Error: unknown error type %d", e.Type)
+	}
+
+	return strings.ReplaceAll(s, "{{value}}", e.Value)
+}
+
+// Code returns the JSONata error code for the error, e.g.
+// "D3081". Codes match those used by the JavaScript version
+// of JSONata. Errors that have no JavaScript equivalent have
+// codes that start with G.
+func (e Error) Code() string {
+	if code, ok := errcodes[e.Type]; ok {
+		return code
+	}
+	return goErrcodes[e.Type]
+}
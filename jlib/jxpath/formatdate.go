@@ -5,7 +5,6 @@
 package jxpath
 
 import (
-	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -74,7 +73,7 @@ type variableMarker struct {
 	maxWidth int
 }
 
-var errUnsupported = errors.New("unsupported date format")
+var errUnsupported = newError(ErrUnsupportedFormat)
 
 // FormatTime converts a time to a string, formatted according
 // to the given picture string.
@@ -93,7 +92,7 @@ func FormatTime(t time.Time, picture string) (string, error) {
 		if r == '[' {
 			if inMarker {
 				if current != start {
-					return "", fmt.Errorf("open bracket inside variable marker")
+					return "", newError(ErrNestedMarker)
 				}
 				inMarker = false
 			} else {
@@ -108,7 +107,7 @@ func FormatTime(t time.Time, picture string) (string, error) {
 		if r == ']' {
 			if inMarker {
 				if current == start {
-					return "", fmt.Errorf("empty variable marker")
+					return "", newError(ErrEmptyMarker)
 				}
 				s, err := expandVariableMarker(t, picture[start:current])
 				if err != nil {
@@ -125,7 +124,7 @@ func FormatTime(t time.Time, picture string) (string, error) {
 				}
 				next := current + 1
 				if next >= len(picture) || picture[next] != ']' {
-					return "", fmt.Errorf("closing bracket outside variable marker")
+					return "", newError(ErrUnmatchedBracket)
 				}
 				doubleClosingBracket = true
 				result = append(result, picture[start:current]...)
@@ -137,11 +136,11 @@ func FormatTime(t time.Time, picture string) (string, error) {
 	}
 
 	if inMarker {
-		return "", fmt.Errorf("unterminated variable marker")
+		return "", newError(ErrUnterminatedMarker)
 	}
 
 	if !expanded {
-		return "", fmt.Errorf("no variable markers found")
+		return "", newError(ErrNoMarkers)
 	}
 
 	result = append(result, picture[start:]...)
@@ -184,7 +183,7 @@ func parseVariableMarker(s string) (dateComponent, variableMarker, error) {
 
 	s = stripSpace(s)
 	if s == "" {
-		return 0, zeroVariableMarker, fmt.Errorf("empty variable marker")
+		return 0, zeroVariableMarker, newError(ErrEmptyMarker)
 	}
 
 	if len(s) == 1 {
@@ -226,7 +225,7 @@ func parseVariableMarkerModifiers(s string) (string, string, error) {
 	widthModifier := s[pos+1:]
 
 	if widthModifier == "" {
-		return "", "", fmt.Errorf("empty width modifier")
+		return "", "", newErrorValue(ErrInvalidWidth, widthModifier)
 	}
 
 	return presentationModifiers, widthModifier, nil
@@ -263,55 +262,46 @@ func parsePresentationModifiers(s string) (string, formatModifier) {
 
 func parseWidthModifier(s string) (int, int, error) {
 
-	var err error
 	var min, max int
+	var ok bool
 
 	parts := strings.Split(s, "-")
 	switch len(parts) {
 	case 1:
-		min, err = parseWidth(parts[0])
-		if err != nil {
-			return 0, 0, fmt.Errorf("invalid width %q: %s", parts[0], err)
-		}
+		min, ok = parseWidth(parts[0])
 	case 2:
-		min, err = parseWidth(parts[0])
-		if err != nil {
-			return 0, 0, fmt.Errorf("invalid minimum width %q: %s", parts[0], err)
-		}
-		max, err = parseWidth(parts[1])
-		if err != nil {
-			return 0, 0, fmt.Errorf("invalid maximum width %q: %s", parts[1], err)
-		}
-		if max < min {
-			return 0, 0, fmt.Errorf("invalid width modifier %q: maximum width cannot be less than minimum width", s)
+		min, ok = parseWidth(parts[0])
+		if ok {
+			max, ok = parseWidth(parts[1])
 		}
-	default:
-		return 0, 0, fmt.Errorf("invalid width modifier %q", s)
+		ok = ok && max >= min
+	}
+
+	if !ok {
+		return 0, 0, newErrorValue(ErrInvalidWidth, s)
 	}
 
 	return min, max, nil
 }
 
-func parseWidth(s string) (int, error) {
+// parseWidth parses a minimum or maximum width, which must be
+// a positive integer or "*".
+func parseWidth(s string) (int, bool) {
 
 	if s == "*" {
-		return 0, nil
+		return 0, true
 	}
 
 	if !isAllDigits(s) {
-		return 0, fmt.Errorf("width contains illegal characters")
+		return 0, false
 	}
 
 	n, err := strconv.Atoi(s)
-	if err != nil {
-		return 0, fmt.Errorf("width is not an integer")
-	}
-
-	if n < 1 {
-		return 0, fmt.Errorf("width cannot be less than 1")
+	if err != nil || n < 1 {
+		return 0, false
 	}
 
-	return n, nil
+	return n, true
 }
 
 func expandDateComponent(t time.Time, component dateComponent, marker *variableMarker) (string, error) {
@@ -351,7 +341,7 @@ func expandDateComponent(t time.Time, component dateComponent, marker *variableM
 	case dateEra:
 		return formatEra(t, marker)
 	default:
-		return "", fmt.Errorf("unknown component specifier %c", component)
+		return "", newErrorValue(ErrUnknownComponent, string(component))
 	}
 }
 
@@ -765,7 +755,7 @@ func formatNameComponent(names []string, marker *variableMarker) (string, error)
 
 	s := bestFittingString(names, marker.maxWidth)
 	if s == "" {
-		return "", fmt.Errorf("no name exists for max length %d", marker.maxWidth)
+		return "", newErrorValue(ErrNameWidth, marker.maxWidth)
 	}
 
 	switch marker.format {
@@ -81,6 +81,71 @@ func TestFormatYear(t *testing.T) {
 	}
 }
 
+func TestFormatTimeErrors(t *testing.T) {
+
+	input := time.Date(2018, time.April, 1, 12, 0, 0, 0, time.UTC)
+
+	data := []struct {
+		Picture string
+		Error   error
+	}{
+		{
+			Picture: "[Y",
+			Error:   &Error{Type: ErrUnterminatedMarker},
+		},
+		{
+			Picture: "[Y[M]",
+			Error:   &Error{Type: ErrNestedMarker},
+		},
+		{
+			Picture: "[]",
+			Error:   &Error{Type: ErrEmptyMarker},
+		},
+		{
+			Picture: "[Y]]",
+			Error:   &Error{Type: ErrUnmatchedBracket},
+		},
+		{
+			Picture: "Y",
+			Error:   &Error{Type: ErrNoMarkers},
+		},
+		{
+			Picture: "[Q]",
+			Error: &Error{
+				Type:  ErrUnknownComponent,
+				Value: "Q",
+			},
+		},
+		{
+			Picture: "[Y,3-2]",
+			Error: &Error{
+				Type:  ErrInvalidWidth,
+				Value: "3-2",
+			},
+		},
+		{
+			Picture: "[Y,]",
+			Error: &Error{
+				Type:  ErrInvalidWidth,
+				Value: "",
+			},
+		},
+	}
+
+	for _, test := range data {
+
+		got, err := FormatTime(input, test.Picture)
+
+		if got != "" {
+			t.Errorf("%s: Expected empty string, got %q", test.Picture, got)
+		}
+
+		if !reflect.DeepEqual(err, test.Error) {
+			t.Errorf("%s: Expected error %v, got %v", test.Picture, test.Error, err)
+		}
+	}
+}
+
 func TestFormatTimezone(t *testing.T) {
 
 	const minutes = 60
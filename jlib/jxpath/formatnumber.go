@@ -6,8 +6,8 @@ package jxpath
 
 import (
 	"bytes"
-	"fmt"
 	"math"
+	"math/big"
 	"strconv"
 	"strings"
 	"unicode/utf8"
@@ -118,7 +118,7 @@ func (format *DecimalFormat) isActive(r rune) bool {
 // https://www.w3.org/TR/xpath-functions-31/#formatting-numbers
 func FormatNumber(value float64, picture string, format DecimalFormat) (string, error) {
 	if picture == "" {
-		return "", fmt.Errorf("picture string cannot be empty")
+		return "", newError(ErrEmptyPicture)
 	}
 
 	vars, err := processPicture(picture, &format, value < 0)
@@ -157,21 +157,76 @@ func FormatNumber(value float64, picture string, format DecimalFormat) (string,
 		}
 	}
 
-	var integerPart, fractionalPart, exponentPart string
-
 	value = round(value, vars.MaxFractionalSize)
 	s := makeNumberString(value, vars.MaxFractionalSize, &format)
+
+	return assembleNumber(s, exponent, &vars, &format), nil
+}
+
+// FormatDecimal is like FormatNumber but it formats an exact
+// rational number. Rounding is done on the exact value, so
+// there are no floating point rounding errors.
+func FormatDecimal(value *big.Rat, picture string, format DecimalFormat) (string, error) {
+	if picture == "" {
+		return "", newError(ErrEmptyPicture)
+	}
+
+	vars, err := processPicture(picture, &format, value.Sign() < 0)
+	if err != nil {
+		return "", err
+	}
+
+	value = new(big.Rat).Abs(value)
+
+	switch vars.NumberType {
+	case typePercent:
+		value.Mul(value, big.NewRat(100, 1))
+	case typePermille:
+		value.Mul(value, big.NewRat(1000, 1))
+	}
+
+	exponent := 0
+	if vars.MinExponentSize != 0 && value.Sign() != 0 {
+
+		ten := big.NewRat(10, 1)
+		maxMantissa := pow10Rat(vars.ScalingFactor)
+		minMantissa := pow10Rat(vars.ScalingFactor - 1)
+
+		for value.Cmp(minMantissa) < 0 {
+			value.Mul(value, ten)
+			exponent--
+		}
+
+		for value.Cmp(maxMantissa) > 0 {
+			value.Quo(value, ten)
+			exponent++
+		}
+	}
+
+	value = roundRat(value, vars.MaxFractionalSize)
+	s := mapDigits([]byte(value.FloatString(vars.MaxFractionalSize)), &format)
+
+	return assembleNumber(s, exponent, &vars, &format), nil
+}
+
+// assembleNumber builds a formatted number from the string s,
+// which holds the digits of the (positive) number to format,
+// and the exponent.
+func assembleNumber(s string, exponent int, vars *subpictureVariables, format *DecimalFormat) string {
+
+	var integerPart, fractionalPart, exponentPart string
+
 	sint, sfrac := splitStringAtByte(s, '.')
 	if sint != "" {
-		integerPart = formatIntegerPart(sint, &vars, &format)
+		integerPart = formatIntegerPart(sint, vars, format)
 	}
 	if sfrac != "" {
-		fractionalPart = formatFractionalPart(sfrac, &vars, &format)
+		fractionalPart = formatFractionalPart(sfrac, vars, format)
 	}
 
 	if vars.MinExponentSize != 0 {
-		s := makeNumberString(float64(exponent), 0, &format)
-		exponentPart = formatExponentPart(s, &vars, &format)
+		s := makeNumberString(float64(exponent), 0, format)
+		exponentPart = formatExponentPart(s, vars, format)
 	}
 
 	buf := make([]byte, 0, 128)
@@ -194,14 +249,14 @@ func FormatNumber(value float64, picture string, format DecimalFormat) (string,
 
 	buf = append(buf, vars.Suffix...)
 
-	return string(buf), nil
+	return string(buf)
 }
 
 func processPicture(picture string, format *DecimalFormat, isNegative bool) (subpictureVariables, error) {
 
 	pic1, pic2 := splitStringAtRune(picture, format.PatternSeparator)
 	if pic1 == "" {
-		return subpictureVariables{}, fmt.Errorf("picture string must contain 1 or 2 subpictures")
+		return subpictureVariables{}, newError(ErrSubpictureCount)
 	}
 
 	vars1, err := processSubpicture(pic1, format)
@@ -305,21 +360,21 @@ func extractSubpictureParts(subpicture string, format *DecimalFormat) subpicture
 func validateSubpictureParts(parts subpictureParts, format *DecimalFormat) error {
 
 	if strings.Count(parts.Picture, string(format.DecimalSeparator)) > 1 {
-		return fmt.Errorf("a subpicture cannot contain more than one decimal separator")
+		return newError(ErrDecimalSeparators)
 	}
 
 	percents := strings.Count(parts.Picture, format.Percent)
 	if percents > 1 {
-		return fmt.Errorf("a subpicture cannot contain more than one percent character")
+		return newError(ErrPercents)
 	}
 
 	permilles := strings.Count(parts.Picture, format.PerMille)
 	if permilles > 1 {
-		return fmt.Errorf("a subpicture cannot contain more than one per-mille character")
+		return newError(ErrPerMilles)
 	}
 
 	if percents > 0 && permilles > 0 {
-		return fmt.Errorf("a subpicture cannot contain both percent and per-mille characters")
+		return newError(ErrPercentPerMille)
 	}
 
 	// Passing an anonymous function to IndexFunc instead of
@@ -327,26 +382,26 @@ func validateSubpictureParts(parts subpictureParts, format *DecimalFormat) error
 	if strings.IndexFunc(parts.Mantissa, func(r rune) bool {
 		return format.isDigit(r)
 	}) == -1 {
-		return fmt.Errorf("a mantissa part must contain at least one decimal or optional digit")
+		return newError(ErrMantissaDigits)
 	}
 
 	isPassive := func(r rune) bool {
 		return !format.isActive(r)
 	}
 	if strings.IndexFunc(parts.Active, isPassive) != -1 {
-		return fmt.Errorf("a subpicture cannot contain a passive character that is both preceded by and followed by an active character")
+		return newError(ErrPassiveCharacter)
 	}
 
 	if lastRuneInString(parts.Integer) == format.GroupSeparator ||
 		firstRuneInString(parts.Fractional) == format.GroupSeparator {
 		if strings.ContainsRune(parts.Picture, format.DecimalSeparator) {
-			return fmt.Errorf("a group separator cannot be adjacent to a decimal separator")
+			return newError(ErrGroupSeparatorAdjacent)
 		}
-		return fmt.Errorf("an integer part cannot end with a group separator")
+		return newError(ErrGroupSeparatorEnd)
 	}
 
 	if strings.Contains(parts.Picture, doubleRune(format.GroupSeparator)) {
-		return fmt.Errorf("a subpicture cannot contain adjacent group separators")
+		return newError(ErrGroupSeparators)
 	}
 
 	// Passing this wrapper function to IndexFunc instead of
@@ -359,7 +414,7 @@ func validateSubpictureParts(parts subpictureParts, format *DecimalFormat) error
 	if pos != -1 {
 		pos += utf8.RuneLen(format.ZeroDigit)
 		if strings.ContainsRune(parts.Integer[pos:], format.OptionalDigit) {
-			return fmt.Errorf("an integer part cannot contain a decimal digit followed by an optional digit")
+			return newError(ErrIntegerDigits)
 		}
 	}
 
@@ -367,17 +422,17 @@ func validateSubpictureParts(parts subpictureParts, format *DecimalFormat) error
 	if pos != -1 {
 		pos += utf8.RuneLen(format.OptionalDigit)
 		if strings.IndexFunc(parts.Fractional[pos:], isDecimalDigit) != -1 {
-			return fmt.Errorf("a fractional part cannot contain an optional digit followed by a decimal digit")
+			return newError(ErrFractionalDigits)
 		}
 	}
 
 	exponents := strings.Count(parts.Picture, string(format.ExponentSeparator))
 	if exponents > 1 {
-		return fmt.Errorf("a subpicture cannot contain more than one exponent separator")
+		return newError(ErrExponentSeparators)
 	}
 
 	if exponents > 0 && (percents > 0 || permilles > 0) {
-		return fmt.Errorf("a subpicture cannot contain a percent/per-mille character and an exponent separator")
+		return newError(ErrPercentExponent)
 	}
 
 	if exponents > 0 {
@@ -385,7 +440,7 @@ func validateSubpictureParts(parts subpictureParts, format *DecimalFormat) error
 			return !format.isDecimalDigit(r)
 		}
 		if strings.IndexFunc(parts.Exponent, isNotDecimalDigit) != -1 {
-			return fmt.Errorf("an exponent part must consist solely of one or more decimal digits")
+			return newError(ErrExponentDigits)
 		}
 	}
 
@@ -596,6 +651,12 @@ func formatExponentPart(exponent string, vars *subpictureVariables, format *Deci
 func makeNumberString(value float64, dp int, format *DecimalFormat) string {
 
 	s := strconv.AppendFloat(make([]byte, 0, 24), math.Abs(value), 'f', dp, 64)
+	return mapDigits(s, format)
+}
+
+// mapDigits replaces the ASCII digits in s with the digits
+// of the given decimal format.
+func mapDigits(s []byte, format *DecimalFormat) string {
 
 	if format.ZeroDigit != '0' {
 		s = bytes.Map(func(r rune) rune {
@@ -781,6 +842,38 @@ func round(x float64, prec int) float64 {
 	return x / pow
 }
 
+// roundRat rounds x to prec decimal places, rounding halfway
+// values to the nearest even number.
+func roundRat(x *big.Rat, prec int) *big.Rat {
+
+	scale := pow10Rat(prec)
+
+	y := new(big.Rat).Mul(x, scale)
+	if y.IsInt() {
+		return x
+	}
+
+	// Truncate towards zero, then adjust based on the
+	// size of the remainder.
+	q, r := new(big.Int).QuoRem(y.Num(), y.Denom(), new(big.Int))
+
+	r.Abs(r).Lsh(r, 1)
+	if c := r.Cmp(y.Denom()); c > 0 || (c == 0 && q.Bit(0) == 1) {
+		q.Add(q, big.NewInt(int64(y.Sign())))
+	}
+
+	return y.SetInt(q).Quo(y, scale)
+}
+
+// pow10Rat returns 10 to the power of n.
+func pow10Rat(n int) *big.Rat {
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(n))), nil)
+	if n < 0 {
+		return new(big.Rat).SetFrac(big.NewInt(1), p)
+	}
+	return new(big.Rat).SetInt(p)
+}
+
 func isHalfway(x float64) bool {
 	_, frac := math.Modf(x)
 	frac = math.Abs(frac)
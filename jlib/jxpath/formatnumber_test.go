@@ -5,7 +5,9 @@
 package jxpath
 
 import (
+	"math/big"
 	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -77,6 +79,89 @@ func TestExamples(t *testing.T) {
 	}
 
 	testFormatNumber(t, tests)
+	testFormatDecimal(t, tests)
+}
+
+func TestFormatDecimal(t *testing.T) {
+
+	tests := []formatNumberTest{
+		{
+			// 2.675 is stored as 2.67499999999999982236431605997495353221893310546875
+			// in a float64 but is exact as a decimal.
+			Value:   2.675,
+			Picture: "0.00",
+			Output:  "2.68",
+		},
+		{
+			Value:   0.125,
+			Picture: "0.00",
+			Output:  "0.12",
+		},
+		{
+			Value:   -0.375,
+			Picture: "0.00",
+			Output:  "-0.38",
+		},
+		{
+			Value:   336.36,
+			Picture: "#,##0.00",
+			Output:  "336.36",
+		},
+		{
+			Value:   0,
+			Picture: "0.0e0",
+			Output:  "0.0e0",
+		},
+	}
+
+	testFormatDecimal(t, tests)
+}
+
+func TestFormatNumberErrors(t *testing.T) {
+
+	tests := []formatNumberTest{
+		{
+			Picture: "",
+			Error:   &Error{Type: ErrEmptyPicture},
+		},
+		{
+			Picture: "0;0;0",
+			Error:   &Error{Type: ErrSubpictureCount},
+		},
+		{
+			Picture: "0.0.0",
+			Error:   &Error{Type: ErrDecimalSeparators},
+		},
+		{
+			Picture: "0%%",
+			Error:   &Error{Type: ErrPercents},
+		},
+		{
+			Picture: "0,,0",
+			Error:   &Error{Type: ErrGroupSeparators},
+		},
+		{
+			Picture: "#0.0#0",
+			Error:   &Error{Type: ErrFractionalDigits},
+		},
+	}
+
+	testFormatNumber(t, tests)
+	testFormatDecimal(t, tests)
+
+	// Errors that are also reported by jsonata-js have the same
+	// codes. Those that are not have codes that start with G.
+	codes := map[ErrType]string{
+		ErrSubpictureCount:    "D3080",
+		ErrPercents:           "D3082",
+		ErrExponentSeparators: "G3001",
+	}
+
+	for typ, code := range codes {
+		if got := newError(typ).Code(); got != code {
+			t.Errorf("error type %d: expected code %s, got %s", typ, code, got)
+		}
+	}
 }
 
 func testFormatNumber(t *testing.T, tests []formatNumberTest) {
@@ -96,3 +181,22 @@ func testFormatNumber(t *testing.T, tests []formatNumberTest) {
 		}
 	}
 }
+
+func testFormatDecimal(t *testing.T, tests []formatNumberTest) {
+
+	df := NewDecimalFormat()
+
+	for i, test := range tests {
+
+		value, _ := new(big.Rat).SetString(strconv.FormatFloat(test.Value, 'g', -1, 64))
+		output, err := FormatDecimal(value, test.Picture, df)
+
+		if output != test.Output {
+			t.Errorf("%d. FormatDecimal(%v, %q): expected %s, got %s", i+1, test.Value, test.Picture, test.Output, output)
+		}
+
+		if !reflect.DeepEqual(err, test.Error) {
+			t.Errorf("%d. FormatDecimal(%v, %q): expected error %v, got %v", i+1, test.Value, test.Picture, test.Error, err)
+		}
+	}
+}
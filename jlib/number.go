@@ -42,7 +42,7 @@ func Number(value StringNumberBool) (float64, error) {
 		}
 	}
 
-	return 0, fmt.Errorf("unable to cast %q to a number", s)
+	return 0, newErrorValue("number", ErrNumberCast, s)
 }
 
 // Round rounds its input to the number of decimal places given
@@ -93,7 +93,7 @@ func Round(x float64, prec jtypes.OptionalInt) float64 {
 func Power(x, y float64) (float64, error) {
 	res := math.Pow(x, y)
 	if math.IsInf(res, 0) || math.IsNaN(res) {
-		return 0, fmt.Errorf("the power function has resulted in a value that cannot be represented as a JSON number")
+		return 0, newError("power", ErrPowerRange)
 	}
 	return res, nil
 }
@@ -102,7 +102,7 @@ func Power(x, y float64) (float64, error) {
 // if the number is less than zero.
 func Sqrt(x float64) (float64, error) {
 	if x < 0 {
-		return 0, fmt.Errorf("the sqrt function cannot be applied to a negative number")
+		return 0, newError("sqrt", ErrSqrtNegative)
 	}
 	return math.Sqrt(x), nil
 }
@@ -112,6 +112,12 @@ func Random() float64 {
 	return rand.Float64()
 }
 
+// RandomWith is like Random but it takes its random numbers
+// from r instead of the default source.
+func RandomWith(r *rand.Rand) float64 {
+	return r.Float64()
+}
+
 // multByPow10 multiplies a number by 10 to the power of n.
 // It does this by converting back and forth to strings to
 // avoid floating point rounding errors, e.g.
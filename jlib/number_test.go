@@ -6,6 +6,9 @@ package jlib_test
 
 import (
 	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/stepzen-dev/jsonata-go/jlib"
@@ -127,17 +130,55 @@ func TestRound(t *testing.T) {
 
 	for _, test := range data {
 
+		s := fmt.Sprintf("(%g", test.Value)
+		if test.Precision.IsSet() {
+			s += fmt.Sprintf(", %d", test.Precision.Int)
+		}
+		s += ")"
+
 		got := jlib.Round(test.Value, test.Precision)
 
 		if got != test.Output {
+			t.Errorf("round%s: Expected %g, got %g", s, test.Output, got)
+		}
 
-			s := fmt.Sprintf("round(%g", test.Value)
-			if test.Precision.IsSet() {
-				s += fmt.Sprintf(", %d", test.Precision.Int)
-			}
-			s += ")"
+		// RoundDecimal should give the same results.
+		r, _ := new(big.Rat).SetString(strconv.FormatFloat(test.Value, 'g', -1, 64))
+		got, _ = jlib.RoundDecimal(r, test.Precision).Float64()
 
-			t.Errorf("%s: Expected %g, got %g", s, test.Output, got)
+		if got != test.Output {
+			t.Errorf("roundDecimal%s: Expected %g, got %g", s, test.Output, got)
 		}
 	}
 }
+
+func BenchmarkAggregate(b *testing.B) {
+
+	nums := make([]interface{}, 1000)
+	for i := range nums {
+		nums[i] = float64(i)
+	}
+
+	fns := []struct {
+		Name string
+		Fn   func(reflect.Value) (float64, error)
+	}{
+		{"sum", jlib.Sum},
+		{"max", jlib.Max},
+		{"min", jlib.Min},
+		{"average", jlib.Average},
+	}
+
+	v := reflect.ValueOf(nums)
+
+	for _, fn := range fns {
+		b.Run(fn.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := fn.Fn(v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -11,23 +11,6 @@ import (
 	"github.com/stepzen-dev/jsonata-go/jtypes"
 )
 
-// typeInterfaceMap is the reflect.Type for map[string]interface{}.
-// Go uses this type (by default) when decoding JSON objects.
-// JSONata objects also use this type. As such it is a common
-// map type in JSONata expressions.
-var typeInterfaceMap = reflect.MapOf(typeString, jtypes.TypeInterface)
-
-// toInterfaceMap attempts to cast a reflect.Value to a
-// map[string]interface{}. This is useful for performance
-// because direct map access is significantly faster than
-// the reflect functions MapKeys and MapIndex.
-func toInterfaceMap(v reflect.Value) (map[string]interface{}, bool) {
-	if v.Type() == typeInterfaceMap && v.CanInterface() {
-		return v.Interface().(map[string]interface{}), true
-	}
-	return nil, false
-}
-
 // Each applies the function fn to each name/value pair in
 // the object obj and returns the results in an array. The
 // order of the items in the array is undefined.
@@ -51,11 +34,11 @@ func Each(obj reflect.Value, fn jtypes.Callable) (interface{}, error) {
 	case jtypes.IsStruct(obj) && !jtypes.IsCallable(obj):
 		each = eachStruct
 	default:
-		return nil, fmt.Errorf("argument must be an object")
+		return nil, newError("each", ErrNonObject)
 	}
 
 	if argc := fn.ParamCount(); argc < 1 || argc > 3 {
-		return nil, fmt.Errorf("function must take 1, 2 or 3 arguments")
+		return nil, newError("each", ErrCallbackArgs)
 	}
 
 	results, err := each(obj, fn)
@@ -80,6 +63,10 @@ func eachMap(v reflect.Value, fn jtypes.Callable) ([]interface{}, error) {
 		return nil, nil
 	}
 
+	if m, ok := jtypes.AsInterfaceMap(v); ok {
+		return eachMapFast(v, m, fn)
+	}
+
 	var results []interface{}
 
 	argv := make([]reflect.Value, fn.ParamCount())
@@ -113,30 +100,67 @@ func eachMap(v reflect.Value, fn jtypes.Callable) ([]interface{}, error) {
 	return results, nil
 }
 
+func eachMapFast(v reflect.Value, m map[string]interface{}, fn jtypes.Callable) ([]interface{}, error) {
+
+	var results []interface{}
+
+	argv := make([]reflect.Value, fn.ParamCount())
+
+	for key, val := range m {
+
+		for i := range argv {
+			switch i {
+			case 0:
+				argv[i] = jtypes.ValueOf(val)
+			case 1:
+				argv[i] = reflect.ValueOf(key)
+			case 2:
+				argv[i] = v
+			}
+		}
+
+		res, err := fn.Call(argv)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.IsValid() && res.CanInterface() {
+			if results == nil {
+				results = make([]interface{}, 0, len(m))
+			}
+			results = append(results, res.Interface())
+		}
+	}
+
+	return results, nil
+}
+
 func eachStruct(v reflect.Value, fn jtypes.Callable) ([]interface{}, error) {
 
-	size := v.NumField()
+	fields := jtypes.StructFields(v.Type())
+
+	size := len(fields)
 	if size == 0 {
 		return nil, nil
 	}
 
 	var results []interface{}
 
-	t := v.Type()
 	argv := make([]reflect.Value, fn.ParamCount())
 
-	for i := 0; i < size; i++ {
+	for _, field := range fields {
 
-		field := t.Field(i)
-		if field.PkgPath != "" {
-			// Skip unexported fields.
+		val := field.Value(v)
+		if !val.IsValid() {
+			// Skip fields that would be omitted from
+			// the JSON encoding.
 			continue
 		}
 
 		for j := range argv {
 			switch j {
 			case 0:
-				argv[j] = v.Field(i)
+				argv[j] = val
 			case 1:
 				argv[j] = reflect.ValueOf(field.Name)
 			case 2:
@@ -183,11 +207,11 @@ func Sift(obj reflect.Value, fn jtypes.Callable) (interface{}, error) {
 	case jtypes.IsStruct(obj) && !jtypes.IsCallable(obj):
 		sift = siftStruct
 	default:
-		return nil, fmt.Errorf("argument must be an object")
+		return nil, newError("sift", ErrNonObject)
 	}
 
 	if argc := fn.ParamCount(); argc < 1 || argc > 3 {
-		return nil, fmt.Errorf("function must take 1, 2 or 3 arguments")
+		return nil, newError("sift", ErrCallbackArgs)
 	}
 
 	results, err := sift(obj, fn)
@@ -209,6 +233,10 @@ func siftMap(v reflect.Value, fn jtypes.Callable) (map[string]interface{}, error
 		return nil, nil
 	}
 
+	if m, ok := jtypes.AsInterfaceMap(v); ok {
+		return siftMapFast(v, m, fn)
+	}
+
 	var results map[string]interface{}
 
 	argv := make([]reflect.Value, fn.ParamCount())
@@ -217,7 +245,7 @@ func siftMap(v reflect.Value, fn jtypes.Callable) (map[string]interface{}, error
 
 		key, ok := jtypes.AsString(k)
 		if !ok {
-			return nil, fmt.Errorf("object key must evaluate to a string, got %v (%s)", k, k.Kind())
+			return nil, newErrorValue("sift", ErrNonStringKey, fmt.Sprintf("%v (%s)", k, k.Kind()))
 		}
 
 		val := v.MapIndex(k)
@@ -255,28 +283,62 @@ func siftMap(v reflect.Value, fn jtypes.Callable) (map[string]interface{}, error
 	return results, nil
 }
 
+func siftMapFast(v reflect.Value, m map[string]interface{}, fn jtypes.Callable) (map[string]interface{}, error) {
+
+	var results map[string]interface{}
+
+	argv := make([]reflect.Value, fn.ParamCount())
+
+	for key, val := range m {
+
+		for i := range argv {
+			switch i {
+			case 0:
+				argv[i] = jtypes.ValueOf(val)
+			case 1:
+				argv[i] = reflect.ValueOf(key)
+			case 2:
+				argv[i] = v
+			}
+		}
+
+		res, err := fn.Call(argv)
+		if err != nil {
+			return nil, err
+		}
+
+		if Boolean(res) {
+			if results == nil {
+				results = make(map[string]interface{}, len(m))
+			}
+			results[key] = val
+		}
+	}
+
+	return results, nil
+}
+
 func siftStruct(v reflect.Value, fn jtypes.Callable) (map[string]interface{}, error) {
 
-	size := v.NumField()
+	fields := jtypes.StructFields(v.Type())
+
+	size := len(fields)
 	if size == 0 {
 		return nil, nil
 	}
 
 	var results map[string]interface{}
 
-	t := v.Type()
 	argv := make([]reflect.Value, fn.ParamCount())
 
-	for i := 0; i < size; i++ {
+	for _, field := range fields {
 
-		key := t.Field(i).Name
-		val := v.Field(i)
+		key := field.Name
+		val := field.Value(v)
 		if !val.IsValid() || !val.CanInterface() {
 			// Skip undefined or non-interfaceable values. We
 			// already know we don't want them in the results,
-			// so we can bypass the function call. This also
-			// filters out unexported fields (as they are
-			// non-interfaceable).
+			// so we can bypass the function call.
 			continue
 		}
 
@@ -354,7 +416,7 @@ func keysMap(v reflect.Value) ([]string, error) {
 		return nil, nil
 	}
 
-	if m, ok := toInterfaceMap(v); ok {
+	if m, ok := jtypes.AsInterfaceMap(v); ok {
 		return keysMapFast(m), nil
 	}
 
@@ -364,7 +426,7 @@ func keysMap(v reflect.Value) ([]string, error) {
 
 		key, ok := jtypes.AsString(k)
 		if !ok {
-			return nil, fmt.Errorf("object key must evaluate to a string, got %v (%s)", k, k.Kind())
+			return nil, newErrorValue("keys", ErrNonStringKey, fmt.Sprintf("%v (%s)", k, k.Kind()))
 		}
 
 		results[i] = key
@@ -385,19 +447,20 @@ func keysMapFast(m map[string]interface{}) []string {
 
 func keysStruct(v reflect.Value) ([]string, error) {
 
-	size := v.NumField()
+	fields := jtypes.StructFields(v.Type())
+
+	size := len(fields)
 	if size == 0 {
 		return nil, nil
 	}
 
 	var results []string
 
-	t := v.Type()
-	for i := 0; i < size; i++ {
+	for _, field := range fields {
 
-		field := t.Field(i)
-		if field.PkgPath != "" {
-			// Skip unexported fields.
+		if !field.Value(v).IsValid() {
+			// Skip fields that would be omitted from
+			// the JSON encoding.
 			continue
 		}
 
@@ -470,7 +533,7 @@ func Merge(objs reflect.Value) (interface{}, error) {
 		size = objs.Len()
 		merge = mergeMap
 	case jtypes.IsStruct(objs) && !jtypes.IsCallable(objs):
-		size = objs.NumField()
+		size = len(jtypes.StructFields(objs.Type()))
 		merge = mergeStruct
 	case jtypes.IsArray(objs):
 		for i := 0; i < objs.Len(); i++ {
@@ -479,14 +542,14 @@ func Merge(objs reflect.Value) (interface{}, error) {
 			case jtypes.IsMap(obj):
 				size += obj.Len()
 			case jtypes.IsStruct(obj):
-				size += obj.NumField()
+				size += len(jtypes.StructFields(obj.Type()))
 			default:
-				return nil, fmt.Errorf("argument must be an object or an array of objects")
+				return nil, newError("merge", ErrNonObjectArray)
 			}
 		}
 		merge = mergeArray
 	default:
-		return nil, fmt.Errorf("argument must be an object or an array of objects")
+		return nil, newError("merge", ErrNonObjectArray)
 	}
 
 	results := make(map[string]interface{}, size)
@@ -499,7 +562,7 @@ func Merge(objs reflect.Value) (interface{}, error) {
 
 func mergeMap(dest map[string]interface{}, src reflect.Value) error {
 
-	if m, ok := toInterfaceMap(src); ok {
+	if m, ok := jtypes.AsInterfaceMap(src); ok {
 		mergeMapFast(dest, m)
 		return nil
 	}
@@ -508,7 +571,7 @@ func mergeMap(dest map[string]interface{}, src reflect.Value) error {
 
 		key, ok := jtypes.AsString(k)
 		if !ok {
-			return fmt.Errorf("object key must evaluate to a string, got %v (%s)", k, k.Kind())
+			return newErrorValue("merge", ErrNonStringKey, fmt.Sprintf("%v (%s)", k, k.Kind()))
 		}
 
 		if val := src.MapIndex(k); val.IsValid() && val.CanInterface() {
@@ -529,17 +592,8 @@ func mergeMapFast(dest, src map[string]interface{}) {
 
 func mergeStruct(dest map[string]interface{}, src reflect.Value) error {
 
-	t := src.Type()
-
-	for i := 0; i < src.NumField(); i++ {
-
-		field := t.Field(i)
-		if field.PkgPath != "" {
-			// Skip unexported fields.
-			continue
-		}
-
-		if val := src.Field(i); val.IsValid() && val.CanInterface() {
+	for _, field := range jtypes.StructFields(src.Type()) {
+		if val := field.Value(src); val.IsValid() && val.CanInterface() {
 			dest[field.Name] = val.Interface()
 		}
 	}
@@ -580,10 +634,18 @@ func Spread(v reflect.Value) (interface{}, error) {
 	switch {
 	case jtypes.IsMap(v):
 		v = jtypes.Resolve(v)
+		if m, ok := jtypes.AsInterfaceMap(v); ok {
+			for key, val := range m {
+				results = append(results, map[string]interface{}{
+					key: val,
+				})
+			}
+			break
+		}
 		keys := v.MapKeys()
 		for _, k := range keys {
 			if k.Kind() != reflect.String {
-				return nil, fmt.Errorf("object key must evaluate to a string, got %v (%s)", k, k.Kind())
+				return nil, newErrorValue("spread", ErrNonStringKey, fmt.Sprintf("%v (%s)", k, k.Kind()))
 			}
 			if v := v.MapIndex(k); v.CanInterface() {
 				results = append(results, map[string]interface{}{
@@ -593,12 +655,10 @@ func Spread(v reflect.Value) (interface{}, error) {
 		}
 	case jtypes.IsStruct(v) && !jtypes.IsCallable(v):
 		v = jtypes.Resolve(v)
-		for i := 0; i < v.NumField(); i++ {
-			k := v.Type().Field(i).Name
-			v := v.FieldByIndex([]int{i})
-			if v.CanInterface() {
+		for _, field := range jtypes.StructFields(v.Type()) {
+			if v := field.Value(v); v.IsValid() && v.CanInterface() {
 				results = append(results, map[string]interface{}{
-					k: v.Interface(),
+					field.Name: v.Interface(),
 				})
 			}
 		}
@@ -16,6 +16,11 @@ import (
 	"github.com/stepzen-dev/jsonata-go/jtypes"
 )
 
+// Embedded is embedded in structs to test field promotion.
+type Embedded struct {
+	E string `json:"e"`
+}
+
 type eachTest struct {
 	Input    interface{}
 	Callable jtypes.Callable
@@ -242,19 +247,19 @@ func TestEach(t *testing.T) {
 			// Note that we don't even get as far as validating the
 			// Callable in this case.
 			Input: "hello",
-			Error: fmt.Errorf("argument must be an object"),
+			Error: &jlib.Error{Func: "each", Type: jlib.ErrNonObject},
 		},
 		{
 			// Callable has too few parameters.
 			Input:    map[string]interface{}{},
 			Callable: paramCountCallable(0),
-			Error:    fmt.Errorf("function must take 1, 2 or 3 arguments"),
+			Error:    &jlib.Error{Func: "each", Type: jlib.ErrCallbackArgs},
 		},
 		{
 			// Callable has too many parameters.
 			Input:    struct{}{},
 			Callable: paramCountCallable(4),
-			Error:    fmt.Errorf("function must take 1, 2 or 3 arguments"),
+			Error:    &jlib.Error{Func: "each", Type: jlib.ErrCallbackArgs},
 		},
 		{
 			// If the Callable returns an error, return the error.
@@ -438,7 +443,7 @@ func TestSift(t *testing.T) {
 			// Note that we don't even get as far as validating the
 			// Callable in this case.
 			Input: 3.141592,
-			Error: fmt.Errorf("argument must be an object"),
+			Error: &jlib.Error{Func: "sift", Type: jlib.ErrNonObject},
 		},
 		{
 			// Invalid key type.
@@ -446,19 +451,19 @@ func TestSift(t *testing.T) {
 				true: "true",
 			},
 			Callable: paramCountCallable(1),
-			Error:    fmt.Errorf("object key must evaluate to a string, got true (bool)"),
+			Error:    &jlib.Error{Func: "sift", Type: jlib.ErrNonStringKey, Value: "true (bool)"},
 		},
 		{
 			// Callable has too few parameters.
 			Input:    map[string]interface{}{},
 			Callable: paramCountCallable(0),
-			Error:    fmt.Errorf("function must take 1, 2 or 3 arguments"),
+			Error:    &jlib.Error{Func: "sift", Type: jlib.ErrCallbackArgs},
 		},
 		{
 			// Callable has too many parameters.
 			Input:    struct{}{},
 			Callable: paramCountCallable(4),
-			Error:    fmt.Errorf("function must take 1, 2 or 3 arguments"),
+			Error:    &jlib.Error{Func: "sift", Type: jlib.ErrCallbackArgs},
 		},
 		{
 			// If the Callable returns an error, return the error.
@@ -580,6 +585,23 @@ func TestKeys(t *testing.T) {
 				"C",
 			},
 		},
+		{
+			// Struct fields follow encoding/json rules.
+			Input: struct {
+				A int    `json:"a"`
+				B string `json:"b,omitempty"`
+				C bool   `json:"-"`
+				D bool   `json:",omitempty"`
+				Embedded
+			}{
+				D: true,
+			},
+			Output: []string{
+				"a",
+				"D",
+				"e",
+			},
+		},
 		{
 			Input: []interface{}{
 				map[string]interface{}{
@@ -619,7 +641,7 @@ func TestKeys(t *testing.T) {
 			Input: map[bool]string{
 				true: "true",
 			},
-			Error: fmt.Errorf("object key must evaluate to a string, got true (bool)"),
+			Error: &jlib.Error{Func: "keys", Type: jlib.ErrNonStringKey, Value: "true (bool)"},
 		},
 		{
 			Input: []interface{}{
@@ -627,7 +649,7 @@ func TestKeys(t *testing.T) {
 					false: "false",
 				},
 			},
-			Error: fmt.Errorf("object key must evaluate to a string, got false (bool)"),
+			Error: &jlib.Error{Func: "keys", Type: jlib.ErrNonStringKey, Value: "false (bool)"},
 		},
 	})
 }
@@ -696,6 +718,35 @@ func TestMerge(t *testing.T) {
 				"Pi": 3.141592,
 			},
 		},
+		{
+			Input: struct {
+				Pi     float64 `json:"pi"`
+				Tau    float64 `json:"tau,omitempty"`
+				Hidden float64 `json:"-"`
+				*Embedded
+			}{
+				Pi:     3.141592,
+				Hidden: 1,
+			},
+			Output: map[string]interface{}{
+				"pi": 3.141592,
+			},
+		},
+		{
+			Input: struct {
+				Pi float64 `json:"pi"`
+				*Embedded
+			}{
+				Pi: 3.141592,
+				Embedded: &Embedded{
+					E: "e",
+				},
+			},
+			Output: map[string]interface{}{
+				"pi": 3.141592,
+				"e":  "e",
+			},
+		},
 		{
 			Input: []interface{}{
 				map[string]int{
@@ -773,19 +824,19 @@ func TestMerge(t *testing.T) {
 		},
 		{
 			Input: "this isn't an object",
-			Error: fmt.Errorf("argument must be an object or an array of objects"),
+			Error: &jlib.Error{Func: "merge", Type: jlib.ErrNonObjectArray},
 		},
 		{
 			Input: []interface{}{
 				3.141592,
 			},
-			Error: fmt.Errorf("argument must be an object or an array of objects"),
+			Error: &jlib.Error{Func: "merge", Type: jlib.ErrNonObjectArray},
 		},
 		{
 			Input: map[bool]string{
 				true: "true",
 			},
-			Error: fmt.Errorf("object key must evaluate to a string, got true (bool)"),
+			Error: &jlib.Error{Func: "merge", Type: jlib.ErrNonStringKey, Value: "true (bool)"},
 		},
 		{
 			Input: []interface{}{
@@ -793,7 +844,7 @@ func TestMerge(t *testing.T) {
 					false: "false",
 				},
 			},
-			Error: fmt.Errorf("object key must evaluate to a string, got false (bool)"),
+			Error: &jlib.Error{Func: "merge", Type: jlib.ErrNonStringKey, Value: "false (bool)"},
 		},
 	})
 }
@@ -8,7 +8,6 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"math"
 	"net/url"
 	"reflect"
@@ -43,6 +42,12 @@ func String(value interface{}) (string, error) {
 		}
 	}
 
+	// Decimals are converted to float64 for output, including
+	// decimals inside arrays and objects.
+	if v, ok := jtypes.ConvertDecimals(reflect.ValueOf(value)); ok {
+		value = v.Interface()
+	}
+
 	// TODO: Round numbers to 13dps to match jsonata-js.
 	b := bytes.Buffer{}
 	e := json.NewEncoder(&b)
@@ -156,7 +161,7 @@ func Contains(s string, pattern StringCallable) (bool, error) {
 		}
 		return len(matches) > 0, nil
 	default:
-		return false, fmt.Errorf("function contains takes a string or a regex")
+		return false, newError("contains", ErrPatternType)
 	}
 }
 
@@ -174,7 +179,7 @@ func Contains(s string, pattern StringCallable) (bool, error) {
 func Split(s string, separator StringCallable, limit jtypes.OptionalInt) ([]string, error) {
 
 	if limit.Int < 0 {
-		return nil, fmt.Errorf("third argument of the split function must evaluate to a positive number")
+		return nil, newError("split", ErrSplitLimit)
 	}
 
 	var parts []string
@@ -194,7 +199,7 @@ func Split(s string, separator StringCallable, limit jtypes.OptionalInt) ([]stri
 		}
 		parts = append(parts, s[pos:])
 	default:
-		return nil, fmt.Errorf("function split takes a string or a regex")
+		return nil, newError("split", ErrPatternType)
 	}
 
 	if limit.IsSet() && limit.Int < len(parts) {
@@ -213,7 +218,7 @@ func Join(values reflect.Value, separator jtypes.OptionalString) (string, error)
 		if s, ok := jtypes.AsString(values); ok {
 			return s, nil
 		}
-		return "", fmt.Errorf("function join takes an array of strings")
+		return "", newError("join", ErrNonStringArray)
 	}
 
 	var vs []string
@@ -240,7 +245,7 @@ func Join(values reflect.Value, separator jtypes.OptionalString) (string, error)
 func Match(s string, pattern jtypes.Callable, limit jtypes.OptionalInt) ([]map[string]interface{}, error) {
 
 	if limit.Int < 0 {
-		return nil, fmt.Errorf("third argument of function match must evaluate to a positive number")
+		return nil, newError("match", ErrMatchLimit)
 	}
 
 	max := -1
@@ -287,7 +292,7 @@ func Match(s string, pattern jtypes.Callable, limit jtypes.OptionalInt) ([]map[s
 func Replace(src string, pattern StringCallable, repl StringCallable, limit jtypes.OptionalInt) (string, error) {
 
 	if limit.Int < 0 {
-		return "", fmt.Errorf("fourth argument of function replace must evaluate to a positive number")
+		return "", newError("replace", ErrReplaceLimit)
 	}
 
 	max := -1
@@ -301,19 +306,19 @@ func Replace(src string, pattern StringCallable, repl StringCallable, limit jtyp
 	case jtypes.Callable:
 		return replaceMatchFunc(src, pattern, repl, max)
 	default:
-		return "", fmt.Errorf("second argument of function replace must be a string or a regex")
+		return "", newError("replace", ErrPatternType)
 	}
 }
 
 func replaceString(src string, pattern string, repl StringCallable, limit int) (string, error) {
 
 	if pattern == "" {
-		return "", fmt.Errorf("second argument of function replace can't be an empty string")
+		return "", newError("replace", ErrEmptyPattern)
 	}
 
 	s, ok := repl.toInterface().(string)
 	if !ok {
-		return "", fmt.Errorf("third argument of function replace must be a string when pattern is a string")
+		return "", newError("replace", ErrNonStringReplacement)
 	}
 
 	return strings.Replace(src, pattern, s, limit), nil
@@ -332,7 +337,7 @@ func replaceMatchFunc(src string, fn jtypes.Callable, repl StringCallable, limit
 	case jtypes.Callable:
 		f = repl
 	default:
-		return "", fmt.Errorf("third argument of function replace must be a string or a function")
+		return "", newError("replace", ErrReplacementType)
 	}
 
 	matches, err := extractMatches(fn, src, limit)
@@ -383,7 +388,7 @@ func FormatNumber(value float64, picture string, options jtypes.OptionalValue) (
 
 	opts := jtypes.Resolve(options.Value)
 	if !jtypes.IsMap(opts) {
-		return "", fmt.Errorf("decimal format options must be a map")
+		return "", newError("formatNumber", ErrNonObjectOptions)
 	}
 
 	format, err := newDecimalFormat(opts)
@@ -402,12 +407,12 @@ func newDecimalFormat(opts reflect.Value) (jxpath.DecimalFormat, error) {
 
 		k, ok := jtypes.AsString(key)
 		if !ok {
-			return jxpath.DecimalFormat{}, fmt.Errorf("decimal format options must be a map of strings to strings")
+			return jxpath.DecimalFormat{}, newError("formatNumber", ErrNonStringOption)
 		}
 
 		v, ok := jtypes.AsString(opts.MapIndex(key))
 		if !ok {
-			return jxpath.DecimalFormat{}, fmt.Errorf("decimal format options must be a map of strings to strings")
+			return jxpath.DecimalFormat{}, newError("formatNumber", ErrNonStringOption)
 		}
 
 		if err := updateDecimalFormat(&format, k, v); err != nil {
@@ -432,7 +437,7 @@ func updateDecimalFormat(format *jxpath.DecimalFormat, key string, value string)
 	default:
 		r, w := utf8.DecodeRuneInString(value)
 		if r == utf8.RuneError || w != len(value) {
-			return fmt.Errorf("invalid value %q for option %q", value, key)
+			return newErrorValue("formatNumber", ErrInvalidOption, key)
 		}
 		switch key {
 		case "decimal-separator":
@@ -450,7 +455,7 @@ func updateDecimalFormat(format *jxpath.DecimalFormat, key string, value string)
 		case "pattern-separator":
 			format.PatternSeparator = r
 		default:
-			return fmt.Errorf("unknown option %q", key)
+			return newErrorValue("formatNumber", ErrUnknownOption, key)
 		}
 	}
 
@@ -468,7 +473,7 @@ func FormatBase(value float64, base jtypes.OptionalFloat64) (string, error) {
 	}
 
 	if radix < 2 || radix > 36 {
-		return "", fmt.Errorf("the second argument to formatBase must be between 2 and 36")
+		return "", newErrorValue("formatBase", ErrRadix, radix)
 	}
 
 	return strconv.FormatInt(int64(Round(value, jtypes.OptionalInt{})), radix), nil
@@ -484,7 +489,7 @@ func Base64Decode(s string) (string, error) {
 
 	b, err := base64.StdEncoding.DecodeString(s)
 	if err != nil {
-		return "", err
+		return "", newErrorValue("base64decode", ErrInvalidBase64, s)
 	}
 
 	return string(b), nil
@@ -496,7 +501,7 @@ func Base64Decode(s string) (string, error) {
 func DecodeURL(s string) (string, error) {
 	escaped, err := url.QueryUnescape(s)
 	if err != nil {
-		return "", err
+		return "", newErrorValue("decodeUrl", ErrMalformedURL, s)
 	}
 	return escaped, nil
 }
@@ -508,12 +513,12 @@ func EncodeURL(s string) (string, error) {
 	// but jsonata-js expects the operation to fail, so we'll
 	// provide the same behavior
 	if s == "�" {
-		return "", fmt.Errorf("invalid character")
+		return "", newErrorValue("encodeUrl", ErrMalformedURL, s)
 	}
 
 	baseURL, err := url.Parse(s)
 	if err != nil {
-		return "", err
+		return "", newErrorValue("encodeUrl", ErrMalformedURL, s)
 	}
 
 	baseURL.RawQuery = baseURL.Query().Encode()
@@ -527,7 +532,7 @@ func EncodeURLComponent(s string) (string, error) {
 	// but jsonata-js expects the operation to fail, so we'll
 	// provide the same behavior
 	if s == "�" {
-		return "", fmt.Errorf("invalid character")
+		return "", newErrorValue("encodeUrlComponent", ErrMalformedURL, s)
 	}
 
 	return url.QueryEscape(s), nil
@@ -565,7 +570,7 @@ func callMatchFunc(fn jtypes.Callable, argv []reflect.Value, matches []match) ([
 	}
 
 	if !jtypes.IsMap(res) {
-		return nil, fmt.Errorf("match function must return an object")
+		return nil, newErrorValue(fn.Name(), ErrMatcherResult, "an object")
 	}
 
 	res = jtypes.Resolve(res)
@@ -573,24 +578,24 @@ func callMatchFunc(fn jtypes.Callable, argv []reflect.Value, matches []match) ([
 	v := res.MapIndex(reflect.ValueOf("match"))
 	value, ok := jtypes.AsString(v)
 	if !ok {
-		return nil, fmt.Errorf("match function must return an object with a string value named 'match'")
+		return nil, newErrorValue(fn.Name(), ErrMatcherResult, "an object with a string value named 'match'")
 	}
 
 	v = res.MapIndex(reflect.ValueOf("start"))
 	start, ok := jtypes.AsNumber(v)
 	if !ok {
-		return nil, fmt.Errorf("match function must return an object with a number value named 'start'")
+		return nil, newErrorValue(fn.Name(), ErrMatcherResult, "an object with a number value named 'start'")
 	}
 
 	v = res.MapIndex(reflect.ValueOf("end"))
 	end, ok := jtypes.AsNumber(v)
 	if !ok {
-		return nil, fmt.Errorf("match function must return an object with a number value named 'end'")
+		return nil, newErrorValue(fn.Name(), ErrMatcherResult, "an object with a number value named 'end'")
 	}
 
 	v = res.MapIndex(reflect.ValueOf("groups"))
 	if !jtypes.IsArrayOf(v, jtypes.IsString) {
-		return nil, fmt.Errorf("match function must return an object with a string array value named 'groups'")
+		return nil, newErrorValue(fn.Name(), ErrMatcherResult, "an object with a string array value named 'groups'")
 	}
 
 	v = jtypes.Resolve(v)
@@ -603,7 +608,7 @@ func callMatchFunc(fn jtypes.Callable, argv []reflect.Value, matches []match) ([
 	v = res.MapIndex(reflect.ValueOf("next"))
 	next, ok := jtypes.AsCallable(v)
 	if !ok {
-		return nil, fmt.Errorf("match function must return an object with a Callable value named 'next'")
+		return nil, newErrorValue(fn.Name(), ErrMatcherResult, "an object with a function value named 'next'")
 	}
 
 	return callMatchFunc(next, nil, append(matches, match{
@@ -696,7 +701,7 @@ func callReplaceFunc(f jtypes.Callable, m match) (string, error) {
 
 	repl, ok := jtypes.AsString(v)
 	if !ok {
-		return "", fmt.Errorf("third argument of function replace must be a function that returns a string")
+		return "", newError("replace", ErrReplacementResult)
 	}
 
 	return repl, nil
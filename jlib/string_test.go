@@ -459,7 +459,7 @@ func TestContains(t *testing.T) {
 		{
 			// Invalid pattern.
 			Pattern: 100,
-			Error:   fmt.Errorf("function contains takes a string or a regex"),
+			Error:   &jlib.Error{Func: "contains", Type: jlib.ErrPatternType},
 		},
 	}
 
@@ -523,7 +523,7 @@ func TestSplit(t *testing.T) {
 		{
 			Separator: "",
 			Limit:     jtypes.NewOptionalInt(-1),
-			Error:     fmt.Errorf("third argument of the split function must evaluate to a positive number"),
+			Error:     &jlib.Error{Func: "split", Type: jlib.ErrSplitLimit},
 		},
 		{
 			Separator: "muji",
@@ -589,7 +589,7 @@ func TestSplit(t *testing.T) {
 		{
 			// Invalid separator.
 			Separator: 100,
-			Error:     fmt.Errorf("function split takes a string or a regex"),
+			Error:     &jlib.Error{Func: "split", Type: jlib.ErrPatternType},
 		},
 	}
 
@@ -660,7 +660,7 @@ func TestJoin(t *testing.T) {
 				"four",
 				5,
 			},
-			Error: fmt.Errorf("function join takes an array of strings"),
+			Error: &jlib.Error{Func: "join", Type: jlib.ErrNonStringArray},
 		},
 	}
 
@@ -816,7 +816,7 @@ func TestMatch(t *testing.T) {
 		{
 			Pattern: abracadabraMatches2(),
 			Limit:   jtypes.NewOptionalInt(-1),
-			Error:   fmt.Errorf("third argument of function match must evaluate to a positive number"),
+			Error:   &jlib.Error{Func: "match", Type: jlib.ErrMatchLimit},
 		},
 		{
 			Pattern: &matchCallable{
@@ -883,7 +883,7 @@ func TestReplace(t *testing.T) {
 			Pattern: "a",
 			Repl:    "å",
 			Limit:   jtypes.NewOptionalInt(-1),
-			Error:   fmt.Errorf("fourth argument of function replace must evaluate to a positive number"),
+			Error:   &jlib.Error{Func: "replace", Type: jlib.ErrReplaceLimit},
 		},
 		{
 			Pattern: "a",
@@ -899,13 +899,13 @@ func TestReplace(t *testing.T) {
 			Pattern: "",
 			Repl:    "å",
 			Limit:   jtypes.NewOptionalInt(0),
-			Error:   fmt.Errorf("second argument of function replace can't be an empty string"),
+			Error:   &jlib.Error{Func: "replace", Type: jlib.ErrEmptyPattern},
 		},
 		{
 			Pattern: "a",
 			Repl:    replaceCallable(nil),
 			Limit:   jtypes.NewOptionalInt(0),
-			Error:   fmt.Errorf("third argument of function replace must be a string when pattern is a string"),
+			Error:   &jlib.Error{Func: "replace", Type: jlib.ErrNonStringReplacement},
 		},
 
 		// Matching function patterns
@@ -932,7 +932,7 @@ func TestReplace(t *testing.T) {
 			Pattern: abracadabraMatches0(),
 			Repl:    "åå",
 			Limit:   jtypes.NewOptionalInt(-1),
-			Error:   fmt.Errorf("fourth argument of function replace must evaluate to a positive number"),
+			Error:   &jlib.Error{Func: "replace", Type: jlib.ErrReplaceLimit},
 		},
 		{
 			// $0 is replaced by the full matched string.
@@ -1062,7 +1062,7 @@ func TestReplace(t *testing.T) {
 			Repl: replaceCallable(func(m map[string]interface{}) (interface{}, error) {
 				return 100, nil
 			}),
-			Error: fmt.Errorf("third argument of function replace must be a function that returns a string"),
+			Error: &jlib.Error{Func: "replace", Type: jlib.ErrReplacementResult},
 		},
 		{
 			Pattern: abracadabraMatches2(),
@@ -1074,7 +1074,7 @@ func TestReplace(t *testing.T) {
 		{
 			Pattern: abracadabraMatches2(),
 			Repl:    100,
-			Error:   fmt.Errorf("third argument of function replace must be a string or a function"),
+			Error:   &jlib.Error{Func: "replace", Type: jlib.ErrReplacementType},
 		},
 	}
 
@@ -1106,7 +1106,7 @@ func TestReplace(t *testing.T) {
 func TestReplaceInvalidPattern(t *testing.T) {
 
 	_, got := jlib.Replace("abracadabra", newStringCallable(100), newStringCallable(""), jtypes.OptionalInt{})
-	exp := fmt.Errorf("second argument of function replace must be a string or a regex")
+	exp := &jlib.Error{Func: "replace", Type: jlib.ErrPatternType}
 
 	if !reflect.DeepEqual(exp, got) {
 		t.Errorf("Expected error %v, got %v", exp, got)
@@ -1289,11 +1289,11 @@ func TestFormatBase(t *testing.T) {
 		},
 		{
 			Base:  jtypes.NewOptionalFloat64(1),
-			Error: fmt.Errorf("the second argument to formatBase must be between 2 and 36"),
+			Error: &jlib.Error{Func: "formatBase", Type: jlib.ErrRadix, Value: "1"},
 		},
 		{
 			Base:  jtypes.NewOptionalFloat64(40),
-			Error: fmt.Errorf("the second argument to formatBase must be between 2 and 36"),
+			Error: &jlib.Error{Func: "formatBase", Type: jlib.ErrRadix, Value: "40"},
 		},
 	}
 
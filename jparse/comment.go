@@ -0,0 +1,138 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jparse
+
+import "strings"
+
+// A Comment represents a /* ... */ comment in a JSONata
+// expression. Comments are ignored by Parse but they can be
+// retrieved with ParseWithComments.
+type Comment struct {
+	Pos
+
+	// Text is the text of the comment, including the
+	// opening and closing delimiters.
+	Text string
+}
+
+// A CommentMap maps the nodes of a syntax tree to the comments
+// attached to them. A comment that follows a node on the same
+// line, separated from it only by spaces and other comments, is
+// attached to that node (the outermost one, if several nodes end
+// there). Any other comment is attached to the node that follows
+// it, which is the outermost node that starts after the comment
+// ends and before any other node does. Comments at the end of an
+// expression, with no node after them, are attached to the root
+// node. The comments for each node are in the order they appear
+// in the expression.
+type CommentMap map[Node][]Comment
+
+// ParseWithComments is like Parse but it also returns the
+// comments in the expression, mapped to the nodes of the
+// syntax tree. It is intended for tools such as formatters
+// that need to preserve comments.
+func ParseWithComments(expr string) (Node, CommentMap, error) {
+
+	root, comments, err := parse(expr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return root, newCommentMap(expr, root, comments), nil
+}
+
+func newCommentMap(expr string, root Node, comments []Comment) CommentMap {
+
+	if len(comments) == 0 {
+		return nil
+	}
+
+	var nodes []Node
+	Walk(root, func(node Node) bool {
+		nodes = append(nodes, node)
+		return true
+	})
+
+	m := CommentMap{}
+
+	for _, c := range comments {
+
+		node := precedingNode(expr, nodes, comments, c)
+		if node == nil {
+			node = followingNode(nodes, c)
+		}
+		if node == nil {
+			node = root
+		}
+
+		m[node] = append(m[node], c)
+	}
+
+	return m
+}
+
+// precedingNode returns the outermost node that ends before
+// comment c on the same line, with only spaces and comments in
+// between, or nil if there is no such node.
+func precedingNode(expr string, nodes []Node, comments []Comment, c Comment) Node {
+
+	var prev Node
+	for _, node := range nodes {
+		end := node.Position().End
+		if end <= c.Start && (prev == nil || end > prev.Position().End) {
+			prev = node
+		}
+	}
+
+	if prev == nil || !isBlank(expr, prev.Position().End, c.Start, comments) {
+		return nil
+	}
+
+	return prev
+}
+
+// followingNode returns the outermost node that starts after
+// comment c ends and before any other node does, or nil if
+// there is no such node.
+func followingNode(nodes []Node, c Comment) Node {
+
+	var next Node
+	for _, node := range nodes {
+		start := node.Position().Start
+		if start >= c.End && (next == nil || start < next.Position().Start) {
+			next = node
+		}
+	}
+
+	return next
+}
+
+// isBlank reports whether expr[start:end] contains nothing but
+// spaces, tabs and single-line comments.
+func isBlank(expr string, start, end int, comments []Comment) bool {
+
+	for i := start; i < end; i++ {
+
+		switch expr[i] {
+		case ' ', '\t':
+			continue
+		}
+
+		skipped := false
+		for _, c := range comments {
+			if c.Start == i && c.End <= end && !strings.Contains(c.Text, "\n") {
+				i = c.End - 1
+				skipped = true
+				break
+			}
+		}
+
+		if !skipped {
+			return false
+		}
+	}
+
+	return true
+}
@@ -11,4 +11,8 @@
 // Call the Parse function, passing a JSONata expression as
 // a string. If an error occurs, it will be of type Error.
 // Otherwise, Parse returns the root Node of the AST.
+//
+// Expressions may contain /* ... */ comments, which Parse
+// ignores. To get the comments along with the AST, call
+// ParseWithComments.
 package jparse
@@ -42,36 +42,85 @@ const (
 	ErrUnmatchedSubtype
 	ErrInvalidSubtype
 	ErrInvalidParamType
+	ErrUnterminatedComment
+	ErrBindingVariable
+	ErrBindingPredicate
+	ErrBindingSort
+	ErrNoParent
 )
 
 var errmsgs = map[ErrType]string{
-	ErrSyntaxError:        "syntax error: '{{token}}'",
-	ErrUnexpectedEOF:      "unexpected end of expression",
-	ErrUnexpectedToken:    "expected token '{{hint}}', got '{{token}}'",
-	ErrMissingToken:       "expected token '{{hint}}' before end of expression",
-	ErrPrefix:             "the symbol '{{token}}' cannot be used as a prefix operator",
-	ErrInfix:              "the symbol '{{token}}' cannot be used as an infix operator",
-	ErrUnterminatedString: "unterminated string literal (no closing '{{hint}}')",
-	ErrUnterminatedRegex:  "unterminated regular expression (no closing '{{hint}}')",
-	ErrUnterminatedName:   "unterminated name (no closing '{{hint}}')",
-	ErrIllegalEscape:      "illegal escape sequence \\{{hint}}",
-	ErrIllegalEscapeHex:   "illegal escape sequence \\{{hint}}: \\u must be followed by a 4-digit hexadecimal code point",
-	ErrInvalidNumber:      "invalid number literal {{token}}",
-	ErrNumberRange:        "invalid number literal {{token}}: value out of range",
-	ErrEmptyRegex:         "invalid regular expression: expression cannot be empty",
-	ErrInvalidRegex:       "invalid regular expression {{token}}: {{hint}}",
-	ErrGroupPredicate:     "a predicate cannot follow a grouping expression in a path step",
-	ErrGroupGroup:         "a path step can only have one grouping expression",
-	ErrPathLiteral:        "invalid path step {{hint}}: paths cannot contain nulls, strings, numbers or booleans",
-	ErrIllegalAssignment:  "illegal assignment: {{hint}} is not a variable",
-	ErrIllegalParam:       "illegal function parameter: {{token}} is not a variable",
-	ErrDuplicateParam:     "duplicate function parameter: {{token}}",
-	ErrParamCount:         "invalid type signature: number of types must match number of function parameters",
-	ErrInvalidUnionType:   "invalid type signature: unsupported union type '{{hint}}'",
-	ErrUnmatchedOption:    "invalid type signature: option '{{hint}}' must follow a parameter",
-	ErrUnmatchedSubtype:   "invalid type signature: subtypes must follow a parameter",
-	ErrInvalidSubtype:     "invalid type signature: parameter type {{hint}} does not support subtypes",
-	ErrInvalidParamType:   "invalid type signature: unknown parameter type '{{hint}}'",
+	ErrSyntaxError:         "syntax error: '{{token}}'",
+	ErrUnexpectedEOF:       "unexpected end of expression",
+	ErrUnexpectedToken:     "expected token '{{hint}}', got '{{token}}'",
+	ErrMissingToken:        "expected token '{{hint}}' before end of expression",
+	ErrPrefix:              "the symbol '{{token}}' cannot be used as a prefix operator",
+	ErrInfix:               "the symbol '{{token}}' cannot be used as an infix operator",
+	ErrUnterminatedString:  "unterminated string literal (no closing '{{hint}}')",
+	ErrUnterminatedRegex:   "unterminated regular expression (no closing '{{hint}}')",
+	ErrUnterminatedName:    "unterminated name (no closing '{{hint}}')",
+	ErrIllegalEscape:       "illegal escape sequence \\{{hint}}",
+	ErrIllegalEscapeHex:    "illegal escape sequence \\{{hint}}: \\u must be followed by a 4-digit hexadecimal code point",
+	ErrInvalidNumber:       "invalid number literal {{token}}",
+	ErrNumberRange:         "invalid number literal {{token}}: value out of range",
+	ErrEmptyRegex:          "invalid regular expression: expression cannot be empty",
+	ErrInvalidRegex:        "invalid regular expression {{token}}: {{hint}}",
+	ErrGroupPredicate:      "a predicate cannot follow a grouping expression in a path step",
+	ErrGroupGroup:          "a path step can only have one grouping expression",
+	ErrPathLiteral:         "invalid path step {{hint}}: paths cannot contain nulls, strings, numbers or booleans",
+	ErrIllegalAssignment:   "illegal assignment: {{hint}} is not a variable",
+	ErrIllegalParam:        "illegal function parameter: {{token}} is not a variable",
+	ErrDuplicateParam:      "duplicate function parameter: {{token}}",
+	ErrParamCount:          "invalid type signature: number of types must match number of function parameters",
+	ErrInvalidUnionType:    "invalid type signature: unsupported union type '{{hint}}'",
+	ErrUnmatchedOption:     "invalid type signature: option '{{hint}}' must follow a parameter",
+	ErrUnmatchedSubtype:    "invalid type signature: subtypes must follow a parameter",
+	ErrInvalidSubtype:      "invalid type signature: parameter type {{hint}} does not support subtypes",
+	ErrInvalidParamType:    "invalid type signature: unknown parameter type '{{hint}}'",
+	ErrUnterminatedComment: "unterminated comment (no closing '{{hint}}')",
+	ErrBindingVariable:     "the right side of '{{token}}' must be a variable name (start with $)",
+	ErrBindingPredicate:    "a context variable binding must precede any predicates on a step",
+	ErrBindingSort:         "a context variable binding must precede the order-by clause on a step",
+	ErrNoParent:            "the parent operator '{{token}}' refers to a value whose parent cannot be determined",
+}
+
+// errcodes maps error types to the codes used for the same
+// errors by the JavaScript implementation of JSONata. Errors
+// that have no exact equivalent use the code of the closest
+// JavaScript error.
+var errcodes = map[ErrType]string{
+	ErrSyntaxError:         "S0201",
+	ErrUnexpectedEOF:       "S0207",
+	ErrUnexpectedToken:     "S0202",
+	ErrMissingToken:        "S0203",
+	ErrPrefix:              "S0211",
+	ErrInfix:               "S0204",
+	ErrUnterminatedString:  "S0101",
+	ErrUnterminatedRegex:   "S0302",
+	ErrUnterminatedName:    "S0105",
+	ErrIllegalEscape:       "S0103",
+	ErrIllegalEscapeHex:    "S0104",
+	ErrInvalidNumber:       "S0201",
+	ErrNumberRange:         "S0102",
+	ErrEmptyRegex:          "S0301",
+	ErrInvalidRegex:        "S0201",
+	ErrGroupPredicate:      "S0209",
+	ErrGroupGroup:          "S0210",
+	ErrPathLiteral:         "S0213",
+	ErrIllegalAssignment:   "S0212",
+	ErrIllegalParam:        "S0208",
+	ErrDuplicateParam:      "S0208",
+	ErrParamCount:          "S0401",
+	ErrInvalidUnionType:    "S0402",
+	ErrUnmatchedOption:     "S0401",
+	ErrUnmatchedSubtype:    "S0401",
+	ErrInvalidSubtype:      "S0401",
+	ErrInvalidParamType:    "S0401",
+	ErrUnterminatedComment: "S0106",
+	ErrBindingVariable:     "S0214",
+	ErrBindingPredicate:    "S0215",
+	ErrBindingSort:         "S0216",
+	ErrNoParent:            "S0217",
 }
 
 var reErrMsg = regexp.MustCompile("{{(token|hint)}}")
@@ -116,6 +165,13 @@ func (e Error) Error() string {
 	})
 }
 
+// Code returns the JSONata error code for the error, e.g.
+// "S0202". Codes match those used by the JavaScript version
+// of JSONata.
+func (e Error) Code() string {
+	return errcodes[e.Type]
+}
+
 func panicf(format string, a ...interface{}) {
 	panic(fmt.Sprintf(format, a...))
 }
@@ -55,6 +55,7 @@ var nuds = [...]nud{
 	typeIn:          parseName,
 	typeAnd:         parseName,
 	typeOr:          parseName,
+	typeMod:         parseParent,
 }
 
 // leds defines led functions for token types that are valid
@@ -83,6 +84,8 @@ var leds = [...]led{
 	typeIn:           parseComparisonOperator,
 	typeAnd:          parseBooleanOperator,
 	typeOr:           parseBooleanOperator,
+	typeFocus:        parseFocus,
+	typeIndex:        parseIndex,
 }
 
 // bps defines binding powers for token types that are valid
@@ -98,6 +101,8 @@ var bps = initBindingPowers([][]tokenType{
 	{
 		typeParenOpen,
 		typeBracketOpen,
+		typeFocus,
+		typeIndex,
 	},
 	{
 		typeDot,
@@ -169,32 +174,71 @@ func lookupBp(tt tokenType) int {
 // Parse builds the abstract syntax tree for a JSONata expression
 // and returns the root node. If the provided expression is not
 // valid, Parse returns an error of type Error.
-func Parse(expr string) (root Node, err error) {
+func Parse(expr string) (Node, error) {
+	root, _, err := parse(expr)
+	return root, err
+}
+
+// parse does the work of Parse. It also returns the comments
+// in the expression.
+func parse(expr string) (root Node, comments []Comment, err error) {
 
 	// Handle panics from parseExpression.
 	defer func() {
 		if r := recover(); r != nil {
 			if e, ok := r.(*Error); ok {
-				root, err = nil, e
+				root, comments, err = nil, nil, e
 				return
 			}
 			panic(r)
 		}
 	}()
 
-	p := newParser(expr)
+	p := newParser(expr, nil)
 	node := p.parseExpression(0)
 
 	if p.token.Type != typeEOF {
-		return nil, newError(ErrSyntaxError, p.token)
+		return nil, nil, newError(ErrSyntaxError, p.token)
 	}
 
-	return node.optimize()
+	root, err = node.optimize()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.tuples {
+		if err := checkParents(root); err != nil {
+			return nil, nil, err
+		}
+		markTuplePaths(root)
+	}
+
+	return root, p.lexer.comments, nil
 }
 
 type parser struct {
 	lexer lexer
 	token token
+
+	// start and end are the offsets of the first character
+	// of the current token and of the character after the
+	// previous token. They are used to record the positions
+	// of nodes.
+	start int
+	end   int
+
+	// errs collects errors in tolerant mode (see ParseTolerant).
+	// It is nil when parsing with Parse. The recovering flag is
+	// set after an error and cleared when the parser next consumes
+	// a token. Errors found while recovering are not recorded,
+	// as they are usually knock-on effects of the first.
+	errs       *errorList
+	recovering bool
+
+	// tuples is set if the expression uses the parent
+	// operator or variable bindings (see markTuplePaths).
+	tuples bool
+
 	// The following function pointers are a workaround
 	// for an initialisation loop compile error. See the
 	// comment in newParser.
@@ -203,10 +247,11 @@ type parser struct {
 	lookupBp  func(tokenType) int
 }
 
-func newParser(input string) parser {
+func newParser(input string, errs *errorList) parser {
 
 	p := parser{
 		lexer: newLexer(input),
+		errs:  errs,
 
 		// Because the nuds/leds arrays refer to functions that
 		// call the parser methods, the parser methods cannot
@@ -242,24 +287,40 @@ func newParser(input string) parser {
 // by the top-level Parse function and returned to the
 // caller as errors. This makes the nud/led functions
 // nicer to write without sacrificing the public API.
-func (p *parser) parseExpression(rbp int) Node {
+//
+// In tolerant mode, parseExpression recovers from these panics
+// itself and returns an ErrorNode in place of the expression.
+func (p *parser) parseExpression(rbp int) (node Node) {
+
+	start := p.start
+
+	if p.errs != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				node = p.recoverExpression(r, start)
+			}
+		}()
+	}
 
 	if p.token.Type == typeEOF {
 		panic(newError(ErrUnexpectedEOF, p.token))
 	}
 
 	t := p.token
-	p.advance(false)
 
 	nud := p.lookupNud(t.Type)
 	if nud == nil {
 		panic(newError(ErrPrefix, t))
 	}
 
+	p.advance(false)
+	p.recovering = false
+
 	lhs, err := nud(p, t)
 	if err != nil {
 		panic(err)
 	}
+	lhs.setPosition(p.pos(start))
 
 	for rbp < p.lookupBp(p.token.Type) {
 
@@ -275,6 +336,7 @@ func (p *parser) parseExpression(rbp int) Node {
 		if err != nil {
 			panic(err)
 		}
+		lhs.setPosition(p.pos(start))
 	}
 
 	return lhs
@@ -282,17 +344,36 @@ func (p *parser) parseExpression(rbp int) Node {
 
 // advance requests the next token from the lexer and updates
 // the parser's current token pointer. It panics if the lexer
-// returns an error token.
+// returns an error token. In tolerant mode, it records the
+// error and moves on to the token after the bad one.
 func (p *parser) advance(allowRegex bool) {
+	p.end = p.lexer.current
 	p.token = p.lexer.next(allowRegex)
-	if p.token.Type == typeError {
-		panic(p.lexer.err)
+	for p.token.Type == typeError {
+		if p.errs == nil {
+			panic(p.lexer.err)
+		}
+		p.errs.add(p.lexer.err.(*Error))
+		p.recovering = true
+		p.lexer.err = nil
+		p.token = p.lexer.next(allowRegex)
+	}
+	p.start = p.lexer.offset
+}
+
+// pos returns the position of a node that starts at the
+// given offset and ends with the previous token.
+func (p *parser) pos(start int) Pos {
+	return Pos{
+		Start: start,
+		End:   p.end,
 	}
 }
 
 // consume is like advance except it first checks that the
 // current token is of the expected type. It panics if that
-// is not the case.
+// is not the case. In tolerant mode, it records the error
+// and tries to resynchronise with the input (see skipTo).
 func (p *parser) consume(expected tokenType, allowRegex bool) {
 
 	if p.token.Type != expected {
@@ -302,9 +383,18 @@ func (p *parser) consume(expected tokenType, allowRegex bool) {
 			typ = ErrMissingToken
 		}
 
-		panic(newErrorHint(typ, p.token, expected.String()))
+		err := newErrorHint(typ, p.token, expected.String())
+		if p.errs == nil {
+			panic(err)
+		}
+
+		p.error(err)
+		if !p.skipTo(expected) {
+			return
+		}
 	}
 
+	p.recovering = false
 	p.advance(allowRegex)
 }
 
@@ -5,6 +5,7 @@
 package jparse_test
 
 import (
+	"fmt"
 	"reflect"
 	"regexp"
 	"regexp/syntax"
@@ -1121,8 +1122,8 @@ func TestPredicateNode(t *testing.T) {
 		{
 			Input: `path{"one": 1}[0]`,
 			Error: &jparse.Error{
-				// TODO: Get position.
-				Type: jparse.ErrGroupPredicate,
+				Type:     jparse.ErrGroupPredicate,
+				Position: 15,
 			},
 		},
 	})
@@ -1426,8 +1427,8 @@ func TestGroupNode(t *testing.T) {
 		{
 			Input: `*{"one": 1}{"two": 2}`,
 			Error: &jparse.Error{
-				// TODO: Get position.
-				Type: jparse.ErrGroupGroup,
+				Type:     jparse.ErrGroupGroup,
+				Position: 11,
 			},
 		},
 	})
@@ -1539,9 +1540,39 @@ func TestNumericOperatorNode(t *testing.T) {
 			},
 		},
 		{
-			Input: "%",
+			// In the prefix position, % is the parent operator.
+			Input: "a.%",
+			Output: &jparse.PathNode{
+				Steps: []jparse.Node{
+					&jparse.NameNode{Value: "a"},
+					&jparse.ParentNode{},
+				},
+				Tuples: true,
+			},
+		},
+		{
+			Input: "a.(% % 2)",
+			Output: &jparse.PathNode{
+				Steps: []jparse.Node{
+					&jparse.NameNode{Value: "a"},
+					&jparse.BlockNode{
+						Exprs: []jparse.Node{
+							&jparse.NumericOperatorNode{
+								Type: jparse.NumericModulo,
+								LHS:  &jparse.ParentNode{},
+								RHS:  &jparse.NumberNode{Value: 2},
+							},
+						},
+					},
+				},
+				Tuples: true,
+			},
+		},
+		{
+			// The parent operator must refer to a path step.
+			Input: "% % 2",
 			Error: &jparse.Error{
-				Type:     jparse.ErrPrefix,
+				Type:     jparse.ErrNoParent,
 				Token:    "%",
 				Position: 0,
 			},
@@ -2016,18 +2047,18 @@ func TestPathNode(t *testing.T) {
 			// Literal on rhs of dot operator.
 			Input: "path.0",
 			Error: &jparse.Error{
-				// TODO: Need position info.
-				Type: jparse.ErrPathLiteral,
-				Hint: "0",
+				Type:     jparse.ErrPathLiteral,
+				Hint:     "0",
+				Position: 5,
 			},
 		},
 		{
 			// Literal on lhs of dot operator.
 			Input: `"Product Name".$uppercase()`,
 			Error: &jparse.Error{
-				// TODO: Need position info.
-				Type: jparse.ErrPathLiteral,
-				Hint: `"Product Name"`,
+				Type:     jparse.ErrPathLiteral,
+				Hint:     `"Product Name"`,
+				Position: 0,
 			},
 		},
 		/*
@@ -2046,6 +2077,783 @@ func TestPathNode(t *testing.T) {
 	})
 }
 
+func TestFocusNode(t *testing.T) {
+	testParser(t, []testCase{
+		{
+			Input: "a@$x",
+			Output: &jparse.PathNode{
+				Steps: []jparse.Node{
+					&jparse.FocusNode{
+						Expr: &jparse.NameNode{
+							Value: "a",
+						},
+						Name: "x",
+					},
+				},
+				Tuples: true,
+			},
+		},
+		{
+			Input: "a.b@$x.c",
+			Output: &jparse.PathNode{
+				Steps: []jparse.Node{
+					&jparse.NameNode{
+						Value: "a",
+					},
+					&jparse.FocusNode{
+						Expr: &jparse.NameNode{
+							Value: "b",
+						},
+						Name: "x",
+					},
+					&jparse.NameNode{
+						Value: "c",
+					},
+				},
+				Tuples: true,
+			},
+		},
+		{
+			// Predicates follow the binding.
+			Input: "a@$x[$x.b]",
+			Output: &jparse.PathNode{
+				Steps: []jparse.Node{
+					&jparse.PredicateNode{
+						Expr: &jparse.FocusNode{
+							Expr: &jparse.NameNode{
+								Value: "a",
+							},
+							Name: "x",
+						},
+						Filters: []jparse.Node{
+							&jparse.PathNode{
+								Steps: []jparse.Node{
+									&jparse.VariableNode{
+										Name: "x",
+									},
+									&jparse.NameNode{
+										Value: "b",
+									},
+								},
+							},
+						},
+					},
+				},
+				Tuples: true,
+			},
+		},
+		{
+			// Binding to something other than a variable.
+			Input: "a@x",
+			Error: &jparse.Error{
+				Type:     jparse.ErrBindingVariable,
+				Token:    "@",
+				Position: 1,
+			},
+		},
+		{
+			// Binding after a predicate.
+			Input: "a[0]@$x",
+			Error: &jparse.Error{
+				Type:     jparse.ErrBindingPredicate,
+				Token:    "@",
+				Position: 4,
+			},
+		},
+		{
+			// Binding after a sort.
+			Input: "a^(b)@$x",
+			Error: &jparse.Error{
+				Type:     jparse.ErrBindingSort,
+				Token:    "@",
+				Position: 5,
+			},
+		},
+	})
+}
+
+func TestIndexNode(t *testing.T) {
+	testParser(t, []testCase{
+		{
+			Input: "a.b#$i",
+			Output: &jparse.PathNode{
+				Steps: []jparse.Node{
+					&jparse.NameNode{
+						Value: "a",
+					},
+					&jparse.IndexNode{
+						Expr: &jparse.NameNode{
+							Value: "b",
+						},
+						Name: "i",
+					},
+				},
+				Tuples: true,
+			},
+		},
+		{
+			// Predicates before the binding are part of
+			// the indexed step.
+			Input: "a[0]#$i",
+			Output: &jparse.PathNode{
+				Steps: []jparse.Node{
+					&jparse.IndexNode{
+						Expr: &jparse.PredicateNode{
+							Expr: &jparse.NameNode{
+								Value: "a",
+							},
+							Filters: []jparse.Node{
+								&jparse.NumberNode{},
+							},
+						},
+						Name: "i",
+					},
+				},
+				Tuples: true,
+			},
+		},
+		{
+			Input: "a@$x#$i",
+			Output: &jparse.PathNode{
+				Steps: []jparse.Node{
+					&jparse.IndexNode{
+						Expr: &jparse.FocusNode{
+							Expr: &jparse.NameNode{
+								Value: "a",
+							},
+							Name: "x",
+						},
+						Name: "i",
+					},
+				},
+				Tuples: true,
+			},
+		},
+		{
+			// Binding to something other than a variable.
+			Input: "a#1",
+			Error: &jparse.Error{
+				Type:     jparse.ErrBindingVariable,
+				Token:    "#",
+				Position: 1,
+			},
+		},
+		{
+			// Missing variable.
+			Input: "a#",
+			Error: &jparse.Error{
+				Type:     jparse.ErrUnexpectedEOF,
+				Position: 2,
+			},
+		},
+	})
+}
+
+func TestWalk(t *testing.T) {
+
+	data := []struct {
+		Input     string
+		Variables []string
+		Positions []int
+	}{
+		{
+			Input:     `$x`,
+			Variables: []string{"x"},
+			Positions: []int{0},
+		},
+		{
+			Input:     `Account.Order[$i > 1].($x := $sum(Product.Price); $x)`,
+			Variables: []string{"i", "sum", "x"},
+			Positions: []int{14, 29, 50},
+		},
+		{
+			Input:     `{"a": $f($y)} ~> |$| {"b": $z}|`,
+			Variables: []string{"f", "y", "", "z"},
+			Positions: []int{6, 9, 18, 27},
+		},
+		{
+			Input:     `$ ? function($v) { $v } : $lookup($, "a")^(>$w)`,
+			Variables: []string{"", "v", "lookup", "", "w"},
+			Positions: []int{0, 19, 26, 34, 44},
+		},
+	}
+
+	for _, test := range data {
+
+		ast, err := jparse.Parse(test.Input)
+		if err != nil {
+			t.Errorf("%s: %s", test.Input, err)
+			continue
+		}
+
+		var names []string
+		var positions []int
+
+		jparse.Walk(ast, func(node jparse.Node) bool {
+			if v, ok := node.(*jparse.VariableNode); ok {
+				names = append(names, v.Name)
+				positions = append(positions, v.Start)
+			}
+			return true
+		})
+
+		if !reflect.DeepEqual(names, test.Variables) {
+			t.Errorf("%s: expected variables %q, got %q", test.Input, test.Variables, names)
+		}
+
+		if !reflect.DeepEqual(positions, test.Positions) {
+			t.Errorf("%s: expected positions %v, got %v", test.Input, test.Positions, positions)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+
+	data := []struct {
+		Input string
+		Nodes []string
+	}{
+		{
+			Input: `Account.Order[0].Price`,
+			Nodes: []string{
+				"Account.Order[0].Price",
+				"Account",
+				"Order[0]",
+				"Order",
+				"0",
+				"Price",
+			},
+		},
+		{
+			Input: `$sum(a.b) + -1`,
+			Nodes: []string{
+				"$sum(a.b) + -1",
+				"$sum(a.b)",
+				"$sum",
+				"a.b",
+				"a",
+				"b",
+				"-1",
+			},
+		},
+		{
+			Input: `["a" & 'b', 1..3, $f(?)]`,
+			Nodes: []string{
+				`["a" & 'b', 1..3, $f(?)]`,
+				`"a" & 'b'`,
+				`"a"`,
+				`'b'`,
+				"1..3",
+				"1",
+				"3",
+				"$f(?)",
+				"$f",
+				"?",
+			},
+		},
+		{
+			Input: `a{b: c}[] ~> |$|{}|`,
+			Nodes: []string{
+				"a{b: c}[] ~> |$|{}|",
+				"a{b: c}[]",
+				"a{b: c}",
+				"a",
+				"a",
+				"b",
+				"b",
+				"c",
+				"c",
+				"|$|{}|",
+				"$",
+				"{}",
+			},
+		},
+		{
+			Input: "(\n  $x := function($v) { $v };\n  `a b`^(>c)\n)",
+			Nodes: []string{
+				"(\n  $x := function($v) { $v };\n  `a b`^(>c)\n)",
+				"$x := function($v) { $v }",
+				"function($v) { $v }",
+				"$v",
+				"`a b`^(>c)",
+				"`a b`",
+				"`a b`",
+				"c",
+				"c",
+			},
+		},
+	}
+
+	for _, test := range data {
+
+		ast, err := jparse.Parse(test.Input)
+		if err != nil {
+			t.Errorf("%s: %s", test.Input, err)
+			continue
+		}
+
+		var nodes []string
+
+		jparse.Walk(ast, func(node jparse.Node) bool {
+			pos := node.Position()
+			nodes = append(nodes, test.Input[pos.Start:pos.End])
+			return true
+		})
+
+		if !reflect.DeepEqual(nodes, test.Nodes) {
+			t.Errorf("%s: expected nodes %q, got %q", test.Input, test.Nodes, nodes)
+		}
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+
+	data := []struct {
+		Input string
+		Code  string
+	}{
+		{`1 +`, "S0207"},
+		{`[1, 2`, "S0203"},
+		{`(1; 2]`, "S0202"},
+		{`"hello`, "S0101"},
+		{"`hello", "S0105"},
+		{`/hello`, "S0302"},
+		{`//`, "S0301"},
+		{`"\q"`, "S0103"},
+		{`1e1000`, "S0102"},
+		{`1 := 2`, "S0212"},
+		{`a."b"`, "S0213"},
+		{`a{"b": c}[0]`, "S0209"},
+		{`function(a) { 1 }`, "S0208"},
+		{`function($x)<s<s>>{ $x }`, "S0401"},
+		{`1 /* comment`, "S0106"},
+		{`a@b`, "S0214"},
+		{`a[0]@$x`, "S0215"},
+		{`a^(b)@$x`, "S0216"},
+		{`a^(b).%`, "S0217"},
+	}
+
+	for _, test := range data {
+
+		_, err := jparse.Parse(test.Input)
+
+		e, ok := err.(*jparse.Error)
+		if !ok {
+			t.Errorf("%s: expected a parser error, got %v", test.Input, err)
+			continue
+		}
+
+		if got := e.Code(); got != test.Code {
+			t.Errorf("%s: expected code %s, got %s (%s)", test.Input, test.Code, got, err)
+		}
+	}
+
+	// Every error type must have a code.
+	for typ := jparse.ErrSyntaxError; typ <= jparse.ErrNoParent; typ++ {
+		if code := (jparse.Error{Type: typ}).Code(); code == "" {
+			t.Errorf("error type %d does not have a code", typ)
+		}
+	}
+}
+
+func TestParseTolerant(t *testing.T) {
+
+	data := []struct {
+		Input  string
+		Output string
+		Errors []*jparse.Error
+		Nodes  []jparse.Pos // positions of the ErrorNodes
+	}{
+		{
+			Input:  `[1, 2 +, 3 * ]`,
+			Output: `[1, 2 + <error>, 3 * <error>]`,
+			Errors: []*jparse.Error{
+				{
+					Type:     jparse.ErrPrefix,
+					Token:    ",",
+					Position: 7,
+				},
+				{
+					Type:     jparse.ErrPrefix,
+					Token:    "]",
+					Position: 13,
+				},
+			},
+			Nodes: []jparse.Pos{
+				{Start: 7, End: 7},
+				{Start: 13, End: 13},
+			},
+		},
+		{
+			// Errors that are knock-on effects of an earlier
+			// error are not reported.
+			Input:  `($x := ; $y := 2; $x + "abc)`,
+			Output: `($x := <error>; $y := 2; $x + <error>)`,
+			Errors: []*jparse.Error{
+				{
+					Type:     jparse.ErrPrefix,
+					Token:    ";",
+					Position: 7,
+				},
+				{
+					Type:     jparse.ErrUnterminatedString,
+					Token:    "abc)",
+					Hint:     "\"",
+					Position: 24,
+				},
+			},
+			Nodes: []jparse.Pos{
+				{Start: 7, End: 7},
+				{Start: 28, End: 28},
+			},
+		},
+		{
+			// A closing token that ends an error is not
+			// reported again.
+			Input:  `[1, )`,
+			Output: `[1, <error>]`,
+			Errors: []*jparse.Error{
+				{
+					Type:     jparse.ErrPrefix,
+					Token:    ")",
+					Position: 4,
+				},
+			},
+			Nodes: []jparse.Pos{
+				{Start: 4, End: 4},
+			},
+		},
+		{
+			// Missing tokens are skipped over.
+			Input:  `{"a" 1, "b": $f(2 3)}`,
+			Output: `{"a": 1, "b": $f(2)}`,
+			Errors: []*jparse.Error{
+				{
+					Type:     jparse.ErrUnexpectedToken,
+					Token:    "1",
+					Hint:     ":",
+					Position: 5,
+				},
+				{
+					Type:     jparse.ErrUnexpectedToken,
+					Token:    "3",
+					Hint:     ")",
+					Position: 18,
+				},
+			},
+		},
+		{
+			// Errors found during optimization are reported
+			// in order of position.
+			Input:  `a.0.b + $f(1 2) + c{}{}`,
+			Output: `a.<error>.b + $f(1) + <error>`,
+			Errors: []*jparse.Error{
+				{
+					Type:     jparse.ErrPathLiteral,
+					Hint:     "0",
+					Position: 2,
+				},
+				{
+					Type:     jparse.ErrUnexpectedToken,
+					Token:    "2",
+					Hint:     ")",
+					Position: 13,
+				},
+				{
+					Type:     jparse.ErrGroupGroup,
+					Position: 21,
+				},
+			},
+			Nodes: []jparse.Pos{
+				{Start: 2, End: 3},
+				{Start: 18, End: 23},
+			},
+		},
+		{
+			Input:  `a b`,
+			Output: `a`,
+			Errors: []*jparse.Error{
+				{
+					Type:     jparse.ErrSyntaxError,
+					Token:    "b",
+					Position: 2,
+				},
+			},
+		},
+		{
+			Input:  ``,
+			Output: `<error>`,
+			Errors: []*jparse.Error{
+				{
+					Type: jparse.ErrUnexpectedEOF,
+				},
+			},
+			Nodes: []jparse.Pos{
+				{Start: 0, End: 0},
+			},
+		},
+	}
+
+	for _, test := range data {
+
+		node, errs := jparse.ParseTolerant(test.Input)
+
+		if got := node.String(); got != test.Output {
+			t.Errorf("%s: expected output %s, got %s", test.Input, test.Output, got)
+		}
+
+		if !reflect.DeepEqual(errs, test.Errors) {
+			t.Errorf("%s: expected errors %v, got %v", test.Input, test.Errors, errs)
+		}
+
+		var nodes []jparse.Pos
+		jparse.Walk(node, func(node jparse.Node) bool {
+			if _, ok := node.(*jparse.ErrorNode); ok {
+				nodes = append(nodes, node.Position())
+			}
+			return true
+		})
+
+		if !reflect.DeepEqual(nodes, test.Nodes) {
+			t.Errorf("%s: expected error nodes at %v, got %v", test.Input, test.Nodes, nodes)
+		}
+	}
+}
+
+func TestParseTolerantValid(t *testing.T) {
+
+	// Valid expressions produce the same syntax trees as Parse.
+	inputs := []string{
+		`Account.Order[0].Product.Price`,
+		`($x := [1, 2, 3]; $map($x, function($v) { $v * 2 }))`,
+		`a{b: c}[] ~> |$|{}|`,
+	}
+
+	for _, input := range inputs {
+
+		want, err := jparse.Parse(input)
+		if err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+
+		got, errs := jparse.ParseTolerant(input)
+		if len(errs) != 0 {
+			t.Errorf("%s: expected no errors, got %v", input, errs)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %s, got %s", input, want, got)
+		}
+	}
+}
+
+func TestParseWithComments(t *testing.T) {
+
+	input := `/* header */
+(
+  /* total */
+  $total := a.b /* price */ + 1;
+  $total * 2 /* double */
+) /* trailer */`
+
+	root, comments, err := jparse.ParseWithComments(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Collect the comments for each node in the order that
+	// the nodes are walked.
+	var got []string
+	jparse.Walk(root, func(node jparse.Node) bool {
+		for _, c := range comments[node] {
+			got = append(got, fmt.Sprintf("%s: %s", node, c.Text))
+		}
+		return true
+	})
+
+	// Comments on the same line as the end of a node go to
+	// that node. Other comments go to the next node, or to the
+	// root if there is no node after them.
+	exp := []string{
+		"($total := a.b + 1; $total * 2): /* header */",
+		"($total := a.b + 1; $total * 2): /* trailer */",
+		"$total := a.b + 1: /* total */",
+		"a.b: /* price */",
+		"$total * 2: /* double */",
+	}
+
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected comments %q, got %q", exp, got)
+	}
+
+	// Comments have positions.
+	c := comments[root][0]
+	if exp := (jparse.Pos{Start: 0, End: 12}); c.Pos != exp {
+		t.Errorf("expected comment at %v, got %v", exp, c.Pos)
+	}
+
+	// A comment after a node on the same line goes to that
+	// node even if another node follows on the same line.
+	root, comments, err = jparse.ParseWithComments(`/* lead */ $sum(x) /* trail */ + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := comments[root]; len(got) != 1 || got[0].Text != "/* lead */" {
+		t.Errorf("expected comment %q on %s, got %v", "/* lead */", root, got)
+	}
+
+	sum := root.(*jparse.NumericOperatorNode).LHS
+	if got := comments[sum]; len(got) != 1 || got[0].Text != "/* trail */" {
+		t.Errorf("expected comment %q on %s, got %v", "/* trail */", sum, got)
+	}
+
+	// A comment inside brackets goes to the next node, not
+	// to the node before the bracket.
+	root, comments, err = jparse.ParseWithComments(`$f(/* arg */ x)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arg := root.(*jparse.FunctionCallNode).Args[0]
+	if got := comments[arg]; len(got) != 1 || got[0].Text != "/* arg */" {
+		t.Errorf("expected comment %q on %s, got %v", "/* arg */", arg, got)
+	}
+
+	// An expression without comments has no comment map.
+	_, comments, err = jparse.ParseWithComments("a.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments != nil {
+		t.Errorf("expected nil comment map, got %v", comments)
+	}
+}
+
+func TestTuplePaths(t *testing.T) {
+
+	data := []struct {
+		Input string
+		Paths []bool // Tuples for each path, in walk order
+	}{
+		{`a.b.c`, []bool{false}},
+		{`a.b.%.c`, []bool{true}},
+		{`a.b.{"x": %.c, "y": d.e}`, []bool{true, true, false}},
+		{`a.b^(%.c)`, []bool{true, true}},
+		{`a.b{%.c: d}`, []bool{true, true, false}},
+		{`a.b^(c)`, []bool{false, false}},
+		{`a.b@$x.c`, []bool{true}},
+		{`a.b#$i[$i > 0]`, []bool{true}},
+		{`a.b#$i^(c)`, []bool{true, false}},
+		{`a@$x.b^(c).d`, []bool{true, true, false}},
+	}
+
+	for _, test := range data {
+
+		root, err := jparse.Parse(test.Input)
+		if err != nil {
+			t.Errorf("%s: %s", test.Input, err)
+			continue
+		}
+
+		var got []bool
+		jparse.Walk(root, func(node jparse.Node) bool {
+			if path, ok := node.(*jparse.PathNode); ok {
+				got = append(got, path.Tuples)
+			}
+			return true
+		})
+
+		if !reflect.DeepEqual(got, test.Paths) {
+			t.Errorf("%s: expected Tuples %v, got %v", test.Input, test.Paths, got)
+		}
+	}
+}
+
+func TestParentErrors(t *testing.T) {
+	testParser(t, []testCase{
+		{
+			// No ancestor.
+			Inputs: []string{
+				"%",
+				"%.a",
+			},
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 0,
+			},
+		},
+		{
+			Inputs: []string{
+				"a.%.%",
+				"(1; %)",
+			},
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 4,
+			},
+		},
+		{
+			// A sort step does not keep the parents of the
+			// values that it sorts.
+			Input: "Account.Order.Product^(Price).%.OrderID",
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 30,
+			},
+		},
+		{
+			// Nor do variables and function calls.
+			Inputs: []string{
+				"$x.%",
+				"$$.%",
+			},
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 3,
+			},
+		},
+		{
+			Input: "a.$f().%",
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 7,
+			},
+		},
+	})
+}
+
+func TestParentValid(t *testing.T) {
+
+	// Values in sort terms, grouping expressions and predicates
+	// are derived from the path that they follow.
+	inputs := []string{
+		"a.%",
+		"a.b^(%.c)",
+		"a.b{%.c: d}",
+		"a.b[%.c]",
+		"a.b@$x.%",
+		"a.(b).%",
+		"a.(b.c).%.%",
+		"a.b.{'x': %.c, 'y': %.%.d}",
+		"a.b.$f(%.c)",
+		"a.b.[%.c]",
+		"$.a.%",
+		"$map(a, function($v) { % })",
+	}
+
+	for _, input := range inputs {
+		if _, err := jparse.Parse(input); err != nil {
+			t.Errorf("%s: %s", input, err)
+		}
+	}
+}
+
 func TestStringers(t *testing.T) {
 
 	data := []struct {
@@ -2298,6 +3106,10 @@ func TestStringers(t *testing.T) {
 			Input:  "Product^(Price)",
 			String: "Product^(Price)",
 		},
+		{
+			Input:  "Account.Order@$o.Product#$i",
+			String: "Account.Order@$o.Product#$i",
+		},
 		{
 			Input:  "Product^(Price, >Name)",
 			String: "Product^(Price, >Name)",
@@ -2334,6 +3146,7 @@ func testParser(t *testing.T, data []testCase) {
 		for _, input := range inputs {
 
 			output, err := jparse.Parse(input)
+			clearPositions(reflect.ValueOf(output))
 
 			if !reflect.DeepEqual(output, test.Output) {
 				t.Errorf("%s: expected output %s, got %s", input, test.Output, output)
@@ -2344,3 +3157,31 @@ func testParser(t *testing.T, data []testCase) {
 		}
 	}
 }
+
+// clearPositions zeroes the Pos fields of the nodes in a syntax
+// tree, so that trees parsed from expressions with different
+// spacing can be compared.
+func clearPositions(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			clearPositions(v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			clearPositions(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+			if f.Type() == reflect.TypeOf(jparse.Pos{}) {
+				f.Set(reflect.Zero(f.Type()))
+				continue
+			}
+			clearPositions(f)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package jparse
 
 import (
 	"fmt"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -56,6 +57,8 @@ const (
 	typeRange
 	typeAssign
 	typeDescendent
+	typeFocus
+	typeIndex
 
 	// Keyword operators
 	typeAnd
@@ -114,6 +117,8 @@ var symbols1 = [...]tokenType{
 	'>': typeGreater,
 	'^': typeSort,
 	'&': typeConcat,
+	'@': typeFocus,
+	'#': typeIndex,
 }
 
 type runeTokenType struct {
@@ -187,6 +192,16 @@ type lexer struct {
 	current int
 	width   int
 	err     error
+
+	// offset is the position of the first character of
+	// the last token returned by next. Unlike the token's
+	// Position, it includes any leading quote or dollar
+	// sign.
+	offset int
+
+	// comments holds the comments skipped by the lexer
+	// so far, in the order they appear in the input.
+	comments []Comment
 }
 
 // newLexer creates a new lexer from the provided input. The
@@ -211,6 +226,13 @@ func newLexer(input string) lexer {
 func (l *lexer) next(allowRegex bool) token {
 
 	l.skipWhitespace()
+	for strings.HasPrefix(l.input[l.current:], "/*") {
+		if !l.scanComment() {
+			return l.error(ErrUnterminatedComment, "*/")
+		}
+		l.skipWhitespace()
+	}
+	l.offset = l.current
 
 	ch := l.nextRune()
 	if ch == eof {
@@ -253,6 +275,31 @@ func (l *lexer) next(allowRegex bool) token {
 	return l.scanName()
 }
 
+// scanComment reads a block comment from the current position
+// and adds it to the lexer's comments. It returns false if the
+// comment has no closing delimiter.
+func (l *lexer) scanComment() bool {
+
+	i := strings.Index(l.input[l.current+2:], "*/")
+	if i < 0 {
+		l.current = l.length
+		return false
+	}
+
+	end := l.current + 2 + i + 2
+	l.comments = append(l.comments, Comment{
+		Pos: Pos{
+			Start: l.current,
+			End:   end,
+		},
+		Text: l.input[l.current:end],
+	})
+
+	l.current = end
+	l.ignore()
+	return true
+}
+
 // scanRegex reads a regular expression from the current position
 // and returns a regex token. The opening delimiter has already
 // been consumed.
@@ -36,6 +36,59 @@ func TestLexerWhitespace(t *testing.T) {
 	})
 }
 
+func TestLexerComments(t *testing.T) {
+	testLexer(t, []lexerTestCase{
+		{
+			Input: "/* comment */",
+		},
+		{
+			Input: "/**/ /* one */\n/* two */\t",
+		},
+		{
+			Input: "a /* comment */ + /* another\ncomment */ b",
+			Tokens: []token{
+				tok(typeName, "a", 0),
+				tok(typePlus, "+", 16),
+				tok(typeName, "b", 40),
+			},
+		},
+		{
+			// Comments take precedence over regular expressions.
+			Input:      "/* comment */ /a*/",
+			AllowRegex: true,
+			Tokens: []token{
+				tok(typeRegex, "a*", 15),
+			},
+		},
+		{
+			Input: "1 /* no closing delimiter",
+			Tokens: []token{
+				tok(typeNumber, "1", 0),
+				tok(typeError, "/* no closing delimiter", 2),
+			},
+			Error: &Error{
+				Type:     ErrUnterminatedComment,
+				Token:    "/* no closing delimiter",
+				Hint:     "*/",
+				Position: 2,
+			},
+		},
+		{
+			// The end of a comment cannot overlap its start.
+			Input: "/*/",
+			Tokens: []token{
+				tok(typeError, "/*/", 0),
+			},
+			Error: &Error{
+				Type:     ErrUnterminatedComment,
+				Token:    "/*/",
+				Hint:     "*/",
+				Position: 0,
+			},
+		},
+	})
+}
+
 func TestLexerRegex(t *testing.T) {
 	testLexer(t, []lexerTestCase{
 		{
@@ -17,11 +17,31 @@ import (
 // Node represents an individual node in a syntax tree.
 type Node interface {
 	String() string
+	Position() Pos
 	optimize() (Node, error)
+	setPosition(Pos)
+}
+
+// Pos records the location of a node in the expression that
+// it was parsed from. Start and End are byte offsets, so the
+// source text of the node is expr[Start:End].
+type Pos struct {
+	Start int
+	End   int
+}
+
+// Position returns the location of the node.
+func (p Pos) Position() Pos {
+	return p
+}
+
+func (p *Pos) setPosition(pos Pos) {
+	*p = pos
 }
 
 // A StringNode represents a string literal.
 type StringNode struct {
+	Pos
 	Value string
 }
 
@@ -52,6 +72,7 @@ func (n StringNode) String() string {
 
 // A NumberNode represents a number literal.
 type NumberNode struct {
+	Pos
 	Value float64
 }
 
@@ -82,6 +103,7 @@ func (n NumberNode) String() string {
 
 // A BooleanNode represents the boolean constant true or false.
 type BooleanNode struct {
+	Pos
 	Value bool
 }
 
@@ -112,7 +134,9 @@ func (n BooleanNode) String() string {
 }
 
 // A NullNode represents the JSON null value.
-type NullNode struct{}
+type NullNode struct {
+	Pos
+}
 
 func parseNull(p *parser, t token) (Node, error) {
 	return &NullNode{}, nil
@@ -128,6 +152,7 @@ func (NullNode) String() string {
 
 // A RegexNode represents a regular expression.
 type RegexNode struct {
+	Pos
 	Value *regexp.Regexp
 }
 
@@ -166,6 +191,7 @@ func (n RegexNode) String() string {
 
 // A VariableNode represents a JSONata variable.
 type VariableNode struct {
+	Pos
 	Name string
 }
 
@@ -185,6 +211,7 @@ func (n VariableNode) String() string {
 
 // A NameNode represents a JSON field name.
 type NameNode struct {
+	Pos
 	Value   string
 	escaped bool
 }
@@ -204,6 +231,7 @@ func parseEscapedName(p *parser, t token) (Node, error) {
 
 func (n *NameNode) optimize() (Node, error) {
 	return &PathNode{
+		Pos:   n.Pos,
 		Steps: []Node{n},
 	}, nil
 }
@@ -226,8 +254,17 @@ func (n NameNode) Escaped() bool {
 // A PathNode represents a JSON object path. It consists of one
 // or more 'steps' or Nodes (most commonly NameNode objects).
 type PathNode struct {
+	Pos
 	Steps      []Node
 	KeepArrays bool
+
+	// Tuples is set if the path's steps bind variables or
+	// use the parent operator, or if the path is sorted or
+	// grouped by terms that use the parent operator. Such
+	// paths are evaluated as a stream of tuples, each of which
+	// holds a value along with its parents and the variables
+	// bound by the steps so far.
+	Tuples bool
 }
 
 func (n *PathNode) optimize() (Node, error) {
@@ -244,6 +281,7 @@ func (n PathNode) String() string {
 
 // A NegationNode represents a numeric negation operation.
 type NegationNode struct {
+	Pos
 	RHS Node
 }
 
@@ -266,6 +304,7 @@ func (n *NegationNode) optimize() (Node, error) {
 	// instead of waiting for evaluation.
 	if number, ok := n.RHS.(*NumberNode); ok {
 		return &NumberNode{
+			Pos:   n.Pos,
 			Value: -number.Value,
 		}, nil
 	}
@@ -279,6 +318,7 @@ func (n NegationNode) String() string {
 
 // A RangeNode represents the range operator.
 type RangeNode struct {
+	Pos
 	LHS Node
 	RHS Node
 }
@@ -306,6 +346,7 @@ func (n RangeNode) String() string {
 
 // An ArrayNode represents an array of items.
 type ArrayNode struct {
+	Pos
 	Items []Node
 }
 
@@ -321,9 +362,14 @@ func parseArray(p *parser, t token) (Node, error) {
 
 			p.consume(typeRange, true)
 
+			rhs := p.parseExpression(0)
 			item = &RangeNode{
+				Pos: Pos{
+					Start: item.Position().Start,
+					End:   rhs.Position().End,
+				},
 				LHS: item,
-				RHS: p.parseExpression(0),
+				RHS: rhs,
 			}
 		}
 
@@ -363,6 +409,7 @@ func (n ArrayNode) String() string {
 // An ObjectNode represents an object, an unordered list of
 // key-value pairs.
 type ObjectNode struct {
+	Pos
 	Pairs [][2]Node
 }
 
@@ -420,6 +467,7 @@ func (n ObjectNode) String() string {
 
 // A BlockNode represents a block expression.
 type BlockNode struct {
+	Pos
 	Exprs []Node
 }
 
@@ -463,7 +511,9 @@ func (n BlockNode) String() string {
 }
 
 // A WildcardNode represents the wildcard operator.
-type WildcardNode struct{}
+type WildcardNode struct {
+	Pos
+}
 
 func parseWildcard(p *parser, t token) (Node, error) {
 	return &WildcardNode{}, nil
@@ -477,8 +527,459 @@ func (WildcardNode) String() string {
 	return "*"
 }
 
+// A ParentNode represents the parent operator (%). In a path
+// step, it refers to the value in the previous step from which
+// the current context value was derived.
+type ParentNode struct {
+	Pos
+}
+
+func parseParent(p *parser, t token) (Node, error) {
+	p.tuples = true
+	return &ParentNode{}, nil
+}
+
+func (n *ParentNode) optimize() (Node, error) {
+	return n, nil
+}
+
+func (ParentNode) String() string {
+	return "%"
+}
+
+// markTuplePaths sets the Tuples flag on the paths in a
+// syntax tree that need it.
+func markTuplePaths(root Node) {
+
+	mark := func(node Node, exprs ...Node) {
+		path, ok := node.(*PathNode)
+		if !ok {
+			return
+		}
+		for _, expr := range exprs {
+			if containsParent(expr) {
+				path.Tuples = true
+				return
+			}
+		}
+	}
+
+	Walk(root, func(node Node) bool {
+		switch node := node.(type) {
+		case *PathNode:
+			if hasBindings(node) {
+				node.Tuples = true
+			}
+			mark(node, node)
+		case *SortNode:
+			for _, term := range node.Terms {
+				mark(node.Expr, term.Expr)
+			}
+		case *GroupNode:
+			mark(node.Expr, node.ObjectNode)
+		}
+		return true
+	})
+}
+
+// hasBindings reports whether any of a path's steps bind
+// variables, including steps that sort a path with bindings.
+func hasBindings(path *PathNode) bool {
+
+	for _, step := range path.Steps {
+		switch step := step.(type) {
+		case *FocusNode, *IndexNode:
+			return true
+		case *PredicateNode:
+			switch step.Expr.(type) {
+			case *FocusNode, *IndexNode:
+				return true
+			}
+		case *SortNode:
+			if p, ok := step.Expr.(*PathNode); ok && hasBindings(p) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// containsParent reports whether the parent operator
+// appears anywhere in a syntax tree.
+func containsParent(root Node) bool {
+
+	var found bool
+
+	Walk(root, func(node Node) bool {
+		if _, ok := node.(*ParentNode); ok {
+			found = true
+		}
+		return !found
+	})
+
+	return found
+}
+
+// A parentSlot is a use of the parent operator whose value
+// has not yet been traced to a path step. Level is the number
+// of steps back that the value comes from.
+type parentSlot struct {
+	node  *ParentNode
+	level int
+}
+
+// checkParents returns an error if the value of a parent
+// operator in a syntax tree cannot be determined, either
+// because there are not enough steps before it or because
+// one of the steps is not a name, a wildcard, a parent
+// operator, a block or a path.
+func checkParents(root Node) error {
+
+	slots, err := parentSlots(root)
+	if err != nil {
+		return err
+	}
+
+	if len(slots) > 0 {
+		return newParentError(slots[0])
+	}
+
+	return nil
+}
+
+// parentSlots returns the parent operators in a syntax tree
+// that refer to the ancestors of the tree's context value.
+func parentSlots(node Node) ([]*parentSlot, error) {
+
+	switch node := node.(type) {
+	case *ParentNode:
+		return []*parentSlot{{node: node, level: 1}}, nil
+
+	case *PathNode:
+		var unresolved []*parentSlot
+		for i, step := range node.Steps {
+			slots, err := parentSlots(step)
+			if err != nil {
+				return nil, err
+			}
+			slots, err = resolveParents(node.Steps[:i], slots)
+			if err != nil {
+				return nil, err
+			}
+			unresolved = append(unresolved, slots...)
+		}
+		return unresolved, nil
+
+	case *PredicateNode:
+		unresolved, err := parentSlots(node.Expr)
+		if err != nil {
+			return nil, err
+		}
+		for _, filter := range node.Filters {
+			slots, err := parentSlots(filter)
+			if err != nil {
+				return nil, err
+			}
+			// The context of a filter is a value yielded by
+			// the predicate's expression.
+			for _, slot := range slots {
+				if slot.level == 1 {
+					if err := seekParent(node.Expr, slot); err != nil {
+						return nil, err
+					}
+				} else {
+					slot.level--
+				}
+				if slot.level > 0 {
+					unresolved = append(unresolved, slot)
+				}
+			}
+		}
+		return unresolved, nil
+
+	case *SortNode:
+		var terms []Node
+		for _, term := range node.Terms {
+			terms = append(terms, term.Expr)
+		}
+		return parentSlotsOf(node.Expr, terms...)
+
+	case *GroupNode:
+		return parentSlotsOf(node.Expr, node.ObjectNode)
+
+	case *LambdaNode, *TypedLambdaNode, *ObjectTransformationNode:
+		// These nodes are evaluated in a context of their
+		// own, so the parent operators in them do not refer
+		// to the ancestors of the enclosing context.
+		for _, child := range childNodes(node) {
+			if _, err := parentSlots(child); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+
+	default:
+		var unresolved []*parentSlot
+		for _, child := range childNodes(node) {
+			slots, err := parentSlots(child)
+			if err != nil {
+				return nil, err
+			}
+			unresolved = append(unresolved, slots...)
+		}
+		return unresolved, nil
+	}
+}
+
+// parentSlotsOf returns the parent operators in expr and in
+// a list of expressions that are evaluated against the values
+// yielded by expr, such as sort terms.
+func parentSlotsOf(expr Node, nodes ...Node) ([]*parentSlot, error) {
+
+	unresolved, err := parentSlots(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := []Node{expr}
+	if path, ok := expr.(*PathNode); ok {
+		steps = path.Steps
+	}
+
+	for _, node := range nodes {
+		slots, err := parentSlots(node)
+		if err != nil {
+			return nil, err
+		}
+		slots, err = resolveParents(steps, slots)
+		if err != nil {
+			return nil, err
+		}
+		unresolved = append(unresolved, slots...)
+	}
+
+	return unresolved, nil
+}
+
+// resolveParents traces parent operators back through a
+// list of path steps, starting with the last one, and
+// returns the ones that refer to values before the first
+// step.
+func resolveParents(steps []Node, slots []*parentSlot) ([]*parentSlot, error) {
+
+	var unresolved []*parentSlot
+
+	for _, slot := range slots {
+		for i := len(steps) - 1; i >= 0 && slot.level > 0; i-- {
+			if err := seekParent(steps[i], slot); err != nil {
+				return nil, err
+			}
+		}
+		if slot.level > 0 {
+			unresolved = append(unresolved, slot)
+		}
+	}
+
+	return unresolved, nil
+}
+
+// seekParent traces a parent operator back through a path
+// step. It returns an error if the step does not yield
+// values whose parents are known.
+func seekParent(step Node, slot *parentSlot) error {
+
+	switch step := step.(type) {
+	case *NameNode, *WildcardNode:
+		slot.level--
+	case *ParentNode:
+		slot.level++
+	case *BlockNode:
+		if len(step.Exprs) > 0 {
+			return seekParent(step.Exprs[len(step.Exprs)-1], slot)
+		}
+	case *PathNode:
+		for i := len(step.Steps) - 1; i >= 0 && slot.level > 0; i-- {
+			if err := seekParent(step.Steps[i], slot); err != nil {
+				return err
+			}
+		}
+	case *PredicateNode:
+		return seekParent(step.Expr, slot)
+	case *FocusNode:
+		return seekParent(step.Expr, slot)
+	case *IndexNode:
+		return seekParent(step.Expr, slot)
+	case *ErrorNode:
+		// Assume that the missing part of the expression
+		// would have provided the parent.
+		slot.level = 0
+	default:
+		return newParentError(slot)
+	}
+
+	return nil
+}
+
+func newParentError(slot *parentSlot) error {
+	return &Error{
+		Type:     ErrNoParent,
+		Token:    slot.node.String(),
+		Position: slot.node.Start,
+	}
+}
+
+// childNodes returns the immediate children of a node.
+func childNodes(node Node) []Node {
+
+	var children []Node
+
+	Walk(node, func(n Node) bool {
+		if n == node {
+			return true
+		}
+		children = append(children, n)
+		return false
+	})
+
+	return children
+}
+
+// A FocusNode represents a path step with a context variable
+// binding, e.g. loans@$l. Each value yielded by Expr is bound
+// to the variable, and the context value stays the same, so
+// the next step is evaluated against the context of this one.
+// This allows a path to join values from different arrays.
+type FocusNode struct {
+	Pos
+	Expr Node
+	Name string
+}
+
+func parseFocus(p *parser, t token, lhs Node) (Node, error) {
+
+	switch lhs.(type) {
+	case *predicateNode:
+		return nil, newError(ErrBindingPredicate, t)
+	case *SortNode:
+		return nil, newError(ErrBindingSort, t)
+	}
+
+	name, err := parseBindingVariable(p, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FocusNode{
+		Expr: lhs,
+		Name: name,
+	}, nil
+}
+
+func (n *FocusNode) optimize() (Node, error) {
+
+	expr, err := n.Expr.optimize()
+	if err != nil {
+		return nil, err
+	}
+
+	return bindingStep(n, &n.Expr, expr), nil
+}
+
+func (n FocusNode) String() string {
+	return fmt.Sprintf("%s@$%s", n.Expr, n.Name)
+}
+
+// An IndexNode represents a path step with a positional
+// variable binding, e.g. books#$i. The variable is bound to
+// the position of each value in the results of Expr.
+type IndexNode struct {
+	Pos
+	Expr Node
+	Name string
+}
+
+func parseIndex(p *parser, t token, lhs Node) (Node, error) {
+
+	name, err := parseBindingVariable(p, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IndexNode{
+		Expr: lhs,
+		Name: name,
+	}, nil
+}
+
+func (n *IndexNode) optimize() (Node, error) {
+
+	expr, err := n.Expr.optimize()
+	if err != nil {
+		return nil, err
+	}
+
+	return bindingStep(n, &n.Expr, expr), nil
+}
+
+func (n IndexNode) String() string {
+	return fmt.Sprintf("%s#$%s", n.Expr, n.Name)
+}
+
+// parseBindingVariable parses the variable on the right hand
+// side of a binding operator and returns its name.
+func parseBindingVariable(p *parser, t token) (string, error) {
+
+	p.tuples = true
+
+	rhs := p.parseExpression(p.bp(t.Type))
+
+	v, ok := rhs.(*VariableNode)
+	if !ok {
+		return "", newError(ErrBindingVariable, t)
+	}
+
+	return v.Name, nil
+}
+
+// bindingStep makes a FocusNode or IndexNode into a path step.
+// The expr argument is the node's optimized expression and
+// slot points to the node's Expr field. If expr is a path, the
+// binding applies to its last step. Otherwise, it applies to
+// expr, which becomes the only step in a new path.
+func bindingStep(n Node, slot *Node, expr Node) Node {
+
+	path, ok := expr.(*PathNode)
+	if !ok {
+		*slot = expr
+		return &PathNode{
+			Pos:   n.Position(),
+			Steps: []Node{n},
+		}
+	}
+
+	i := len(path.Steps) - 1
+	last := path.Steps[i]
+
+	*slot = last
+	n.setPosition(Pos{
+		Start: last.Position().Start,
+		End:   n.Position().End,
+	})
+
+	path.Steps[i] = n
+	path.Pos = Pos{
+		Start: path.Start,
+		End:   n.Position().End,
+	}
+
+	return path
+}
+
 // A DescendentNode represents the descendent operator.
-type DescendentNode struct{}
+type DescendentNode struct {
+	Pos
+}
 
 func parseDescendent(p *parser, t token) (Node, error) {
 	return &DescendentNode{}, nil
@@ -495,6 +996,7 @@ func (DescendentNode) String() string {
 // An ObjectTransformationNode represents the object transformation
 // operator.
 type ObjectTransformationNode struct {
+	Pos
 	Pattern Node
 	Updates Node
 	Deletes Node
@@ -830,6 +1332,7 @@ func getBracketedString(s string, open, close rune) string {
 
 // A LambdaNode represents a user-defined JSONata function.
 type LambdaNode struct {
+	Pos
 	Body       Node
 	ParamNames []string
 	shorthand  bool
@@ -911,6 +1414,7 @@ func (n TypedLambdaNode) String() string {
 
 // A PartialNode represents a partially applied function.
 type PartialNode struct {
+	Pos
 	Func Node
 	Args []Node
 }
@@ -940,7 +1444,9 @@ func (n PartialNode) String() string {
 
 // A PlaceholderNode represents a placeholder argument
 // in a partially applied function.
-type PlaceholderNode struct{}
+type PlaceholderNode struct {
+	Pos
+}
 
 func (n *PlaceholderNode) optimize() (Node, error) {
 	return n, nil
@@ -952,6 +1458,7 @@ func (PlaceholderNode) String() string {
 
 // A FunctionCallNode represents a call to a function.
 type FunctionCallNode struct {
+	Pos
 	Func Node
 	Args []Node
 }
@@ -973,8 +1480,11 @@ func parseFunctionCall(p *parser, t token, lhs Node) (Node, error) {
 
 		if p.token.Type == typePlaceholder {
 			isPartial = true
-			arg = &PlaceholderNode{}
+			start := p.start
 			p.consume(typePlaceholder, true)
+			arg = &PlaceholderNode{
+				Pos: p.pos(start),
+			}
 		} else {
 			arg = p.parseExpression(0)
 		}
@@ -1147,6 +1657,7 @@ Loop:
 
 // A PredicateNode represents a predicate expression.
 type PredicateNode struct {
+	Pos
 	Expr    Node
 	Filters []Node
 }
@@ -1161,8 +1672,10 @@ func (n PredicateNode) String() string {
 
 // A GroupNode represents a group expression.
 type GroupNode struct {
+	Pos
 	Expr Node
 	*ObjectNode
+	errs *errorList
 }
 
 func parseGroup(p *parser, t token, lhs Node) (Node, error) {
@@ -1171,10 +1684,12 @@ func parseGroup(p *parser, t token, lhs Node) (Node, error) {
 	if err != nil {
 		return nil, err
 	}
+	obj.setPosition(p.pos(t.Position))
 
 	return &GroupNode{
 		Expr:       lhs,
 		ObjectNode: obj.(*ObjectNode),
+		errs:       p.errs,
 	}, nil
 }
 
@@ -1188,10 +1703,10 @@ func (n *GroupNode) optimize() (Node, error) {
 	}
 
 	if _, isGroup := n.Expr.(*GroupNode); isGroup {
-		// TODO: Add position info.
-		return nil, &Error{
-			Type: ErrGroupGroup,
-		}
+		return n.errs.recover(&Error{
+			Type:     ErrGroupGroup,
+			Position: n.ObjectNode.Start,
+		}, n.Pos)
 	}
 
 	obj, err := n.ObjectNode.optimize()
@@ -1200,6 +1715,9 @@ func (n *GroupNode) optimize() (Node, error) {
 	}
 	n.ObjectNode = obj.(*ObjectNode)
 
+	// The error list is only needed during optimization.
+	n.errs = nil
+
 	return n, nil
 }
 
@@ -1209,6 +1727,7 @@ func (n GroupNode) String() string {
 
 // A ConditionalNode represents an if-then-else expression.
 type ConditionalNode struct {
+	Pos
 	If   Node
 	Then Node
 	Else Node
@@ -1267,6 +1786,7 @@ func (n ConditionalNode) String() string {
 
 // An AssignmentNode represents a variable assignment.
 type AssignmentNode struct {
+	Pos
 	Name  string
 	Value Node
 }
@@ -1333,6 +1853,7 @@ func (op NumericOperator) String() string {
 
 // A NumericOperatorNode represents a numeric operation.
 type NumericOperatorNode struct {
+	Pos
 	Type NumericOperator
 	LHS  Node
 	RHS  Node
@@ -1423,6 +1944,7 @@ func (op ComparisonOperator) String() string {
 
 // A ComparisonOperatorNode represents a comparison operation.
 type ComparisonOperatorNode struct {
+	Pos
 	Type ComparisonOperator
 	LHS  Node
 	RHS  Node
@@ -1503,6 +2025,7 @@ func (op BooleanOperator) String() string {
 
 // A BooleanOperatorNode represents a boolean operation.
 type BooleanOperatorNode struct {
+	Pos
 	Type BooleanOperator
 	LHS  Node
 	RHS  Node
@@ -1552,6 +2075,7 @@ func (n BooleanOperatorNode) String() string {
 // A StringConcatenationNode represents a string concatenation
 // operation.
 type StringConcatenationNode struct {
+	Pos
 	LHS Node
 	RHS Node
 }
@@ -1603,6 +2127,7 @@ type SortTerm struct {
 
 // A SortNode represents a sort clause on a JSONata path step.
 type SortNode struct {
+	Pos
 	Expr  Node
 	Terms []SortTerm
 }
@@ -1687,6 +2212,7 @@ func (n SortNode) String() string {
 // A FunctionApplicationNode represents a function application
 // operation.
 type FunctionApplicationNode struct {
+	Pos
 	LHS Node
 	RHS Node
 }
@@ -1723,20 +2249,25 @@ func (n FunctionApplicationNode) String() string {
 // expressions. It is deliberately unexported and creates a PathNode
 // during its optimize phase.
 type dotNode struct {
-	lhs Node
-	rhs Node
+	Pos
+	lhs  Node
+	rhs  Node
+	errs *errorList
 }
 
 func parseDot(p *parser, t token, lhs Node) (Node, error) {
 	return &dotNode{
-		lhs: lhs,
-		rhs: p.parseExpression(p.bp(t.Type)),
+		lhs:  lhs,
+		rhs:  p.parseExpression(p.bp(t.Type)),
+		errs: p.errs,
 	}, nil
 }
 
 func (n *dotNode) optimize() (Node, error) {
 
-	path := &PathNode{}
+	path := &PathNode{
+		Pos: n.Pos,
+	}
 
 	lhs, err := n.lhs.optimize()
 	if err != nil {
@@ -1745,11 +2276,15 @@ func (n *dotNode) optimize() (Node, error) {
 
 	switch lhs := lhs.(type) {
 	case *NumberNode, *StringNode, *BooleanNode, *NullNode:
-		// TODO: Add position info.
-		return nil, &Error{
-			Type: ErrPathLiteral,
-			Hint: lhs.String(),
+		node, err := n.errs.recover(&Error{
+			Type:     ErrPathLiteral,
+			Hint:     lhs.String(),
+			Position: lhs.Position().Start,
+		}, lhs.Position())
+		if err != nil {
+			return nil, err
 		}
+		path.Steps = []Node{node}
 	case *PathNode:
 		path.Steps = lhs.Steps
 		if lhs.KeepArrays {
@@ -1766,11 +2301,15 @@ func (n *dotNode) optimize() (Node, error) {
 
 	switch rhs := rhs.(type) {
 	case *NumberNode, *StringNode, *BooleanNode, *NullNode:
-		// TODO: Add position info.
-		return nil, &Error{
-			Type: ErrPathLiteral,
-			Hint: rhs.String(),
+		node, err := n.errs.recover(&Error{
+			Type:     ErrPathLiteral,
+			Hint:     rhs.String(),
+			Position: rhs.Position().Start,
+		}, rhs.Position())
+		if err != nil {
+			return nil, err
 		}
+		path.Steps = append(path.Steps, node)
 	case *PathNode:
 		path.Steps = append(path.Steps, rhs.Steps...)
 		if rhs.KeepArrays {
@@ -1791,6 +2330,7 @@ func (n dotNode) String() string {
 // processing path expressions. It is deliberately unexported
 // and gets converted into a PathNode during optimization.
 type singletonArrayNode struct {
+	Pos
 	lhs Node
 }
 
@@ -1803,10 +2343,12 @@ func (n *singletonArrayNode) optimize() (Node, error) {
 
 	switch lhs := lhs.(type) {
 	case *PathNode:
+		lhs.Pos = n.Pos
 		lhs.KeepArrays = true
 		return lhs, nil
 	default:
 		return &PathNode{
+			Pos:        n.Pos,
 			Steps:      []Node{lhs},
 			KeepArrays: true,
 		}, nil
@@ -1821,8 +2363,10 @@ func (n singletonArrayNode) String() string {
 // predicate expressions. It is deliberately unexported and gets
 // converted into a PredicateNode during optimization.
 type predicateNode struct {
-	lhs Node // the context for this predicate
-	rhs Node // the predicate expression
+	Pos
+	lhs  Node // the context for this predicate
+	rhs  Node // the predicate expression
+	errs *errorList
 }
 
 func parsePredicate(p *parser, t token, lhs Node) (Node, error) {
@@ -1841,8 +2385,9 @@ func parsePredicate(p *parser, t token, lhs Node) (Node, error) {
 	p.consume(typeBracketClose, false)
 
 	return &predicateNode{
-		lhs: lhs,
-		rhs: rhs,
+		lhs:  lhs,
+		rhs:  rhs,
+		errs: p.errs,
 	}, nil
 }
 
@@ -1860,25 +2405,32 @@ func (n *predicateNode) optimize() (Node, error) {
 
 	switch lhs := lhs.(type) {
 	case *GroupNode:
-		return nil, &Error{
-			// TODO: Add position info.
-			Type: ErrGroupPredicate,
-		}
+		return n.errs.recover(&Error{
+			Type:     ErrGroupPredicate,
+			Position: rhs.Position().Start,
+		}, n.Pos)
 	case *PathNode:
 		i := len(lhs.Steps) - 1
 		switch last := lhs.Steps[i].(type) {
 		case *PredicateNode:
+			last.End = n.End
 			last.Filters = append(last.Filters, rhs)
 		default:
 			step := &PredicateNode{
+				Pos: Pos{
+					Start: last.Position().Start,
+					End:   n.End,
+				},
 				Expr:    last,
 				Filters: []Node{rhs},
 			}
 			lhs.Steps = append(lhs.Steps[:i], step)
 		}
+		lhs.Pos = n.Pos
 		return lhs, nil
 	default:
 		return &PredicateNode{
+			Pos:     n.Pos,
 			Expr:    lhs,
 			Filters: []Node{rhs},
 		}, nil
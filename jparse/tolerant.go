@@ -0,0 +1,214 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jparse
+
+import (
+	"sort"
+)
+
+// ParseTolerant is like Parse except that it does not stop at
+// the first error. When it finds a problem, it records the error,
+// skips ahead to the next delimiter (a comma, a semicolon or a
+// closing bracket) and carries on parsing from there. It is
+// intended for tools such as editors that need to report every
+// problem in an expression, not just the first.
+//
+// ParseTolerant returns a syntax tree in which the parts of the
+// expression that could not be parsed are replaced by ErrorNodes,
+// along with the errors that it found, sorted by position. If the
+// expression is valid, the syntax tree is the same as the one
+// returned by Parse and there are no errors. Syntax trees that
+// contain ErrorNodes cannot be evaluated.
+//
+// Errors that follow on from an earlier error without any valid
+// input in between are not reported.
+func ParseTolerant(expr string) (Node, []*Error) {
+
+	var errs errorList
+
+	p := newParser(expr, &errs)
+	node := p.parseExpression(0)
+
+	// Report tokens after the end of the expression as a single
+	// error, but keep parsing them to find any further errors.
+	for p.token.Type != typeEOF {
+		p.error(newError(ErrSyntaxError, p.token))
+		if p.lookupNud(p.token.Type) == nil {
+			p.advance(false)
+			continue
+		}
+		p.parseExpression(0)
+	}
+
+	// The nodes that can fail during optimization record their
+	// errors in errs, so optimize should not return an error
+	// here. Handle it anyway, just in case.
+	node, err := node.optimize()
+	if err != nil {
+		e, ok := err.(*Error)
+		if !ok {
+			panic(err)
+		}
+		errs.add(e)
+		node = &ErrorNode{
+			Pos: Pos{
+				Start: 0,
+				End:   len(expr),
+			},
+			Err: e,
+		}
+	}
+
+	if p.tuples {
+		if err := checkParents(node); err != nil {
+			errs.add(err.(*Error))
+		}
+		markTuplePaths(node)
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Position < errs[j].Position
+	})
+
+	return node, errs
+}
+
+// An ErrorNode takes the place of part of an expression that
+// could not be parsed. ErrorNodes only appear in syntax trees
+// returned by ParseTolerant.
+type ErrorNode struct {
+	Pos
+	Err *Error
+}
+
+func (n *ErrorNode) optimize() (Node, error) {
+	return n, nil
+}
+
+func (ErrorNode) String() string {
+	return "<error>"
+}
+
+// An errorList collects the errors found by ParseTolerant.
+type errorList []*Error
+
+func (l *errorList) add(err *Error) {
+	*l = append(*l, err)
+}
+
+// recover is called by nodes whose optimize methods can fail.
+// If the list is nil, as it is when parsing with Parse, recover
+// returns the error. Otherwise it records the error and returns
+// an ErrorNode with the given position in place of the node.
+func (l *errorList) recover(err *Error, pos Pos) (Node, error) {
+
+	if l == nil {
+		return nil, err
+	}
+
+	l.add(err)
+	return &ErrorNode{
+		Pos: pos,
+		Err: err,
+	}, nil
+}
+
+// error records an error in tolerant mode, unless the parser
+// is already recovering from an earlier error.
+func (p *parser) error(err error) {
+	if !p.recovering {
+		p.errs.add(err.(*Error))
+	}
+	p.recovering = true
+}
+
+// recoverExpression handles a panic in parseExpression in
+// tolerant mode. It records the error, skips the rest of the
+// expression and returns an ErrorNode that covers the part of
+// the input from start to the last skipped token.
+func (p *parser) recoverExpression(r interface{}, start int) Node {
+
+	err, ok := r.(*Error)
+	if !ok {
+		panic(r)
+	}
+
+	p.error(err)
+	p.skip()
+
+	return &ErrorNode{
+		Pos: Pos{
+			Start: start,
+			End:   max(p.end, start),
+		},
+		Err: err,
+	}
+}
+
+// skip advances to the next comma, semicolon or closing bracket
+// that is not nested inside brackets opened during the skip, or
+// to the end of the expression. It does not consume the token it
+// stops at.
+func (p *parser) skip() {
+
+	depth := 0
+
+	for {
+		switch p.token.Type {
+		case typeEOF:
+			return
+		case typeParenOpen, typeBracketOpen, typeBraceOpen:
+			depth++
+		case typeParenClose, typeBracketClose, typeBraceClose:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case typeComma, typeSemicolon:
+			if depth == 0 {
+				return
+			}
+		}
+		p.advance(false)
+	}
+}
+
+// skipTo is called by consume in tolerant mode when the current
+// token is not the expected one. If the expected token closes
+// a bracket (or an object transformation), skipTo skips ahead to
+// the first unnested instance of the token and returns true. It
+// returns false without skipping past a different closing token
+// or the end of the expression. For other token types, skipTo
+// skips nothing and returns false, so that parsing carries on as
+// if the missing token were present.
+func (p *parser) skipTo(expected tokenType) bool {
+
+	switch expected {
+	case typeParenClose, typeBracketClose, typeBraceClose, typePipe:
+	default:
+		return false
+	}
+
+	depth := 0
+
+	for {
+		switch p.token.Type {
+		case typeEOF:
+			return false
+		case typeParenOpen, typeBracketOpen, typeBraceOpen:
+			depth++
+		case typeParenClose, typeBracketClose, typeBraceClose:
+			if depth == 0 {
+				return p.token.Type == expected
+			}
+			depth--
+		case typePipe:
+			if depth == 0 && expected == typePipe {
+				return true
+			}
+		}
+		p.advance(false)
+	}
+}
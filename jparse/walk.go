@@ -0,0 +1,94 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jparse
+
+// Walk traverses a syntax tree in depth-first order. It calls
+// fn for node and, if fn returns true, walks each of node's
+// children in turn. Nil nodes are skipped.
+func Walk(node Node, fn func(Node) bool) {
+
+	if node == nil || !fn(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *PathNode:
+		walkNodes(node.Steps, fn)
+	case *NegationNode:
+		Walk(node.RHS, fn)
+	case *RangeNode:
+		Walk(node.LHS, fn)
+		Walk(node.RHS, fn)
+	case *ArrayNode:
+		walkNodes(node.Items, fn)
+	case *ObjectNode:
+		walkPairs(node.Pairs, fn)
+	case *BlockNode:
+		walkNodes(node.Exprs, fn)
+	case *ObjectTransformationNode:
+		Walk(node.Pattern, fn)
+		Walk(node.Updates, fn)
+		Walk(node.Deletes, fn)
+	case *LambdaNode:
+		Walk(node.Body, fn)
+	case *TypedLambdaNode:
+		Walk(node.Body, fn)
+	case *PartialNode:
+		Walk(node.Func, fn)
+		walkNodes(node.Args, fn)
+	case *FunctionCallNode:
+		Walk(node.Func, fn)
+		walkNodes(node.Args, fn)
+	case *PredicateNode:
+		Walk(node.Expr, fn)
+		walkNodes(node.Filters, fn)
+	case *GroupNode:
+		Walk(node.Expr, fn)
+		walkPairs(node.Pairs, fn)
+	case *FocusNode:
+		Walk(node.Expr, fn)
+	case *IndexNode:
+		Walk(node.Expr, fn)
+	case *ConditionalNode:
+		Walk(node.If, fn)
+		Walk(node.Then, fn)
+		Walk(node.Else, fn)
+	case *AssignmentNode:
+		Walk(node.Value, fn)
+	case *NumericOperatorNode:
+		Walk(node.LHS, fn)
+		Walk(node.RHS, fn)
+	case *ComparisonOperatorNode:
+		Walk(node.LHS, fn)
+		Walk(node.RHS, fn)
+	case *BooleanOperatorNode:
+		Walk(node.LHS, fn)
+		Walk(node.RHS, fn)
+	case *StringConcatenationNode:
+		Walk(node.LHS, fn)
+		Walk(node.RHS, fn)
+	case *SortNode:
+		Walk(node.Expr, fn)
+		for _, term := range node.Terms {
+			Walk(term.Expr, fn)
+		}
+	case *FunctionApplicationNode:
+		Walk(node.LHS, fn)
+		Walk(node.RHS, fn)
+	}
+}
+
+func walkNodes(nodes []Node, fn func(Node) bool) {
+	for _, node := range nodes {
+		Walk(node, fn)
+	}
+}
+
+func walkPairs(pairs [][2]Node, fn func(Node) bool) {
+	for _, pair := range pairs {
+		Walk(pair[0], fn)
+		Walk(pair[1], fn)
+	}
+}
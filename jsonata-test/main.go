@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,6 +12,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	jsonata "github.com/stepzen-dev/jsonata-go"
 	types "github.com/stepzen-dev/jsonata-go/jtypes"
@@ -120,10 +123,6 @@ func runTest(tc testCase, dataDir string, path string) (bool, error) {
 		return false, nil
 	}
 
-	if tc.TimeLimit != 0 {
-		return false, nil
-	}
-
 	// If this test has an associated dataset, load it
 	data := tc.Data
 	if tc.Dataset != "" {
@@ -135,44 +134,51 @@ func runTest(tc testCase, dataDir string, path string) (bool, error) {
 		data = dest
 	}
 
-	var failed bool
 	expr, unQuoted := replaceQuotesInPaths(tc.Expr)
-	got, _ := eval(expr, tc.Bindings, data)
+	got, err := eval(expr, tc, data)
 
-	if !equalResults(got, tc.Result) {
-		failed = true
-		printTestCase(os.Stderr, tc, strings.TrimSuffix(filepath.Base(path), ".json"))
-		fmt.Fprintf(os.Stderr, "Test file: %s \n", path)
+	resultOK := equalResults(got, tc.Result)
+	codeOK := tc.Error == "" || errorCode(err) == tc.Error
 
-		if tc.Category != "" {
-			fmt.Fprintf(os.Stderr, "Category: %s \n", tc.Category)
-		}
-		if tc.Description != "" {
-			fmt.Fprintf(os.Stderr, "Description: %s \n", tc.Description)
-		}
+	if resultOK && codeOK {
+		return false, nil
+	}
 
-		fmt.Fprintf(os.Stderr, "Expression: %s\n", expr)
-		if unQuoted {
-			fmt.Fprintf(os.Stderr, "Unquoted: %t\n", unQuoted)
-		}
+	printTestCase(os.Stderr, tc, strings.TrimSuffix(filepath.Base(path), ".json"))
+	fmt.Fprintf(os.Stderr, "Test file: %s \n", path)
+
+	if tc.Category != "" {
+		fmt.Fprintf(os.Stderr, "Category: %s \n", tc.Category)
+	}
+	if tc.Description != "" {
+		fmt.Fprintf(os.Stderr, "Description: %s \n", tc.Description)
+	}
+
+	fmt.Fprintf(os.Stderr, "Expression: %s\n", expr)
+	if unQuoted {
+		fmt.Fprintf(os.Stderr, "Unquoted: %t\n", unQuoted)
+	}
+
+	if !resultOK {
 		fmt.Fprintf(os.Stderr, "Expected Result: %v [%T]\n", tc.Result, tc.Result)
 		fmt.Fprintf(os.Stderr, "Actual Result:   %v [%T]\n", got, got)
 	}
+	if !codeOK {
+		fmt.Fprintf(os.Stderr, "Actual error code: %s\n", errorCode(err))
+		fmt.Fprintf(os.Stderr, "Actual error: %v\n", err)
+	}
 
-	// TODO this block is commented out to make staticcheck happy,
-	// but we should check that the error is the same as the js one
-	// var exp error
-	// if tc.Undefined {
-	// 	exp = jsonata.ErrUndefined
-	// } else {
-	// 	exp = convertError(tc.Error)
-	// }
-
-	// if !reflect.DeepEqual(err, exp) {
-	// TODO: Compare actual/expected errors
-	// }
+	return true, nil
+}
 
-	return failed, nil
+// errorCode returns the JSONata error code for err, or an
+// empty string if err does not have a code.
+func errorCode(err error) string {
+	var e interface{ Code() string }
+	if errors.As(err, &e) {
+		return e.Code()
+	}
+	return ""
 }
 
 // loadTestExprFile loads a jsonata expression from a file and returns the
@@ -267,18 +273,27 @@ func printTestCase(w io.Writer, tc testCase, name string) {
 	}
 }
 
-func eval(expression string, bindings map[string]interface{}, data interface{}) (interface{}, error) {
+func eval(expression string, tc testCase, data interface{}) (interface{}, error) {
 	expr, err := jsonata.Compile(expression)
 	if err != nil {
 		return nil, err
 	}
 
-	err = expr.RegisterVars(bindings)
-	if err != nil {
-		return nil, err
+	// Enforce the time and stack depth limits that some
+	// tests specify (the time limit is in milliseconds).
+	ctx := context.Background()
+	if tc.TimeLimit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(tc.TimeLimit)*time.Millisecond)
+		defer cancel()
+	}
+
+	opts := jsonata.EvalOptions{
+		MaxDepth: tc.Depth,
+		Bindings: tc.Bindings,
 	}
 
-	return expr.Eval(data)
+	return expr.EvalWithOptions(ctx, data, opts)
 }
 
 func equalResults(x, y interface{}) bool {
@@ -5,10 +5,16 @@
 package jsonata
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
 
@@ -17,11 +23,6 @@ import (
 	"github.com/stepzen-dev/jsonata-go/jtypes"
 )
 
-var (
-	globalRegistryMutex sync.RWMutex
-	globalRegistry      map[string]reflect.Value
-)
-
 // An Extension describes custom functionality added to a
 // JSONata expression.
 type Extension struct {
@@ -47,6 +48,14 @@ type Extension struct {
 	// true, the evaluation context is inserted as the first
 	// argument when Func is called.
 	EvalContextHandler jtypes.ArgHandler
+
+	// Sequential marks functions that must not be called
+	// from more than one goroutine at a time, e.g. because
+	// they have side effects or use state that is not safe
+	// for concurrent use. Expressions that use a Sequential
+	// function are never evaluated in parallel (see
+	// EvalOptions.Parallelism).
+	Sequential bool
 }
 
 // RegisterExts registers custom functions for use in JSONata
@@ -54,17 +63,11 @@ type Extension struct {
 // startup (e.g. from an init function).
 //
 // Custom functions registered at the package level will be
-// available to all Expr objects. To register custom functions
-// with specific Expr objects, use the RegisterExts method.
+// available to all Expr objects created by Compile. To make
+// custom functions available to specific Expr objects, add
+// them to a Registry and use CompileWith.
 func RegisterExts(exts map[string]Extension) error {
-
-	values, err := processExts(exts)
-	if err != nil {
-		return err
-	}
-
-	updateGlobalRegistry(values)
-	return nil
+	return defaultRegistry.RegisterExts(exts)
 }
 
 // RegisterVars registers custom variables for use in JSONata
@@ -72,43 +75,204 @@ func RegisterExts(exts map[string]Extension) error {
 // startup (e.g. from an init function).
 //
 // Custom variables registered at the package level will be
-// available to all Expr objects. To register custom variables
-// with specific Expr objects, use the RegisterVars method.
+// available to all Expr objects created by Compile. To make
+// custom variables available to specific Expr objects, add
+// them to a Registry and use CompileWith.
 func RegisterVars(vars map[string]interface{}) error {
+	return defaultRegistry.RegisterVars(vars)
+}
 
-	values, err := processVars(vars)
-	if err != nil {
-		return err
-	}
+// EvalOptions sets limits on the resources used by a single
+// evaluation of an Expr. A zero value for any field means
+// that there is no limit.
+type EvalOptions struct {
+
+	// MaxDepth is the maximum number of nested calls to
+	// JSONata functions (i.e. lambdas defined in the
+	// expression). It protects against unbounded recursion,
+	// which would otherwise overflow the Go stack and crash
+	// the program. Calls in tail position do not count
+	// towards the limit. If the limit is reached, evaluation
+	// fails with an ErrMaxDepth error.
+	MaxDepth int
+
+	// MaxSteps is the maximum number of expression nodes
+	// that can be evaluated. If the limit is reached,
+	// evaluation fails with an ErrMaxSteps error.
+	MaxSteps int
+
+	// MaxResultSize is the maximum number of items in any
+	// array produced during evaluation, including the final
+	// result. If the limit is reached, evaluation fails with
+	// an ErrMaxResultSize error.
+	MaxResultSize int
+
+	// Bindings holds variables that are available to this
+	// evaluation only. They take precedence over variables
+	// registered with RegisterVars. Unlike RegisterVars,
+	// Bindings do not modify the Expr, so they can be used
+	// to pass request-specific values to an Expr that is
+	// shared between goroutines.
+	Bindings map[string]interface{}
+
+	// Clock returns the current time. It is called once per
+	// evaluation to provide the timestamp returned by $now
+	// and $millis. If Clock is nil, time.Now is used. Set
+	// Clock to a function that returns a fixed time to get
+	// reproducible output, e.g. in tests.
+	Clock func() time.Time
+
+	// RandSource is the source of random numbers for the
+	// $random and $shuffle functions. If RandSource is nil,
+	// the default source from the math/rand package is used.
+	// Set RandSource to a seeded source, e.g. the result of
+	// rand.NewSource, to get reproducible output. A Source is
+	// not safe for concurrent use, so each evaluation needs
+	// its own.
+	RandSource rand.Source
+
+	// UseNumber causes EvalBytesWithOptions to decode numbers
+	// in the input as json.Numbers rather than float64s. This
+	// preserves the original digits of numbers that are copied
+	// to the output unchanged, such as 64-bit IDs that do not
+	// fit exactly in a float64. Arithmetic and comparisons on
+	// integer json.Numbers are exact, within the range of an
+	// int64. Other operations convert json.Numbers to float64.
+	UseNumber bool
+
+	// Decimal enables exact decimal arithmetic. Numbers are
+	// converted to exact rationals (*big.Rat) by the numeric
+	// operators and by $sum, $average, $round and
+	// $formatNumber, so calculations such as 0.1 + 0.2 do not
+	// suffer from floating point rounding errors. Comparisons
+	// between decimals are also exact. Decimals are converted
+	// back to float64 in the result of the evaluation. Note
+	// that custom functions with interface{} parameters may
+	// receive *big.Rat values in this mode.
+	Decimal bool
+
+	// Tracer, if set, is notified as each node of the
+	// expression is evaluated. See Tracer for details.
+	Tracer Tracer
+
+	// Profiler, if set, collects timing statistics for the
+	// evaluation. See Profiler for details.
+	Profiler *Profiler
+
+	// DisableEval disables the $eval function, which parses
+	// and evaluates a string as a JSONata expression. Calls
+	// to $eval fail with an ErrEvalDisabled error. Set it
+	// when evaluating expressions from untrusted sources.
+	// Note that $eval is subject to the other limits set in
+	// EvalOptions whether or not it is disabled.
+	DisableEval bool
+
+	// Parallelism is the maximum number of goroutines used
+	// to evaluate path steps, $map and $filter over large
+	// arrays. The results are in the same order as they
+	// would be if the items were processed one at a time.
+	// If Parallelism is less than 2, or a Tracer or Profiler
+	// is set, evaluation is sequential.
+	//
+	// Only expressions that are safe to run concurrently are
+	// evaluated in parallel. An expression is not safe if it
+	// assigns a variable outside of a block or a function
+	// body, or if it uses a custom function that is marked
+	// as Sequential (see Extension). Function calls made by
+	// all of the goroutines count towards MaxDepth.
+	Parallelism int
+
+	// ParallelThreshold is the minimum number of items in
+	// an array for it to be processed in parallel. If it is
+	// zero, DefaultParallelThreshold is used.
+	ParallelThreshold int
+}
 
-	updateGlobalRegistry(values)
-	return nil
+// A Tracer receives callbacks during the evaluation of an
+// expression. It can be used to debug expressions, e.g. to
+// find the path step that produced an empty result.
+//
+// Enter is called before a node of the expression's syntax
+// tree is evaluated. Its arguments are the node and the input
+// value (the context item) that the node is evaluated against.
+// Exit is called after the node has been evaluated, with the
+// same node and input plus the result. If the node evaluated
+// to undefined, e.g. a path step that did not match anything,
+// the output is an invalid reflect.Value. If evaluation failed,
+// err is the error.
+//
+// Calls to Enter and Exit are nested: every call to Enter is
+// matched by a call to Exit, and the nodes of subexpressions
+// are entered and exited between them. To keep this nesting
+// intact, function calls in tail position are not optimized
+// while a Tracer is set, so they count towards MaxDepth.
+//
+// A Tracer is called from the goroutine that is evaluating
+// the expression. It must not modify the node or the values
+// passed to it.
+type Tracer interface {
+	Enter(node jparse.Node, input reflect.Value)
+	Exit(node jparse.Node, input reflect.Value, output reflect.Value, err error)
 }
 
 // An Expr represents a JSONata expression.
+//
+// An Expr is safe for concurrent use by multiple goroutines.
+// Evaluation does not modify the Expr, so a single compiled
+// expression can be shared and evaluated many times at once.
+// Use EvalOptions.Bindings to pass values that differ between
+// evaluations.
 type Expr struct {
-	node     jparse.Node
-	registry map[string]reflect.Value
+	src  string
+	node jparse.Node
+
+	// registry holds the custom functions and variables
+	// available to this Expr. The map is never modified
+	// once stored: the deprecated RegisterExts and
+	// RegisterVars methods replace it with a new copy.
+	registry atomic.Pointer[map[string]reflect.Value]
+	mu       sync.Mutex
+
+	// forbidden holds the names of the functions that this
+	// Expr may not use (see CompileOptions).
+	forbidden map[string]bool
 }
 
 // Compile parses a JSONata expression and returns an Expr
 // that can be evaluated against JSON data. If the input is
 // not a valid JSONata expression, Compile returns an error
 // of type jparse.Error.
+//
+// The returned Expr has access to the custom functions and
+// variables registered with the package level RegisterExts
+// and RegisterVars functions at the time of the call.
+//
+// Syntax trees are cached (see CompileCache), so compiling
+// an expression that was compiled recently is cheap.
 func Compile(expr string) (*Expr, error) {
+	return CompileWith(expr, defaultRegistry)
+}
 
-	node, err := jparse.Parse(expr)
+// CompileWith is like Compile but the returned Expr has access
+// to the custom functions and variables in the given Registry
+// instead of those registered at the package level. If the
+// Registry is nil, only the standard JSONata functions are
+// available.
+func CompileWith(expr string, r *Registry) (*Expr, error) {
+
+	node, err := defaultCache.Parse(expr)
 	if err != nil {
 		return nil, err
 	}
 
 	e := &Expr{
+		src:  expr,
 		node: node,
 	}
 
-	globalRegistryMutex.RLock()
-	e.updateRegistry(globalRegistry)
-	globalRegistryMutex.RUnlock()
+	if values := r.snapshot(); values != nil {
+		e.registry.Store(&values)
+	}
 
 	return e, nil
 }
@@ -134,12 +298,41 @@ func MustCompile(expr string) *Expr {
 // Eval can be called multiple times, with different input
 // data if required.
 func (e *Expr) Eval(data interface{}) (interface{}, error) {
+	return e.EvalContext(context.Background(), data)
+}
+
+// EvalContext is like Eval but it stops evaluation if the
+// given context is cancelled or its deadline passes. In that
+// case, EvalContext returns an EvalError of type ErrCanceled
+// or ErrDeadlineExceeded. Both errors wrap the corresponding
+// context error, so callers can also test for them with
+// errors.Is.
+//
+// The context is checked at each path step and lambda call,
+// and on each iteration of the higher order functions $map,
+// $filter and $reduce. Custom functions can receive the
+// context by declaring a context.Context as their first
+// parameter.
+func (e *Expr) EvalContext(ctx context.Context, data interface{}) (interface{}, error) {
+	return e.EvalWithOptions(ctx, data, EvalOptions{})
+}
+
+// EvalWithOptions is like EvalContext but it also enforces
+// the resource limits in opts. It is intended for evaluating
+// untrusted expressions, where a runaway expression must not
+// be allowed to exhaust memory or crash the program.
+func (e *Expr) EvalWithOptions(ctx context.Context, data interface{}, opts EvalOptions) (interface{}, error) {
 	input, ok := data.(reflect.Value)
 	if !ok {
 		input = reflect.ValueOf(data)
 	}
 
-	result, err := eval(e.node, input, e.newEnv(input))
+	env, err := e.newEnv(ctx, input, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := eval(e.node, input, env)
 	if err != nil {
 		return nil, err
 	}
@@ -156,21 +349,84 @@ func (e *Expr) Eval(data interface{}) (interface{}, error) {
 		return nil, nil
 	}
 
+	if opts.Decimal {
+		return decimalsToFloats(result.Interface()), nil
+	}
+
 	return result.Interface(), nil
 }
 
+// decimalsToFloats replaces the decimals in an evaluation
+// result with float64s. The result may share values with the
+// input to the evaluation, so it is not modified. Instead,
+// any container that holds decimals is copied (see
+// jtypes.ConvertDecimals).
+func decimalsToFloats(v interface{}) interface{} {
+	if res, ok := jtypes.ConvertDecimals(reflect.ValueOf(v)); ok {
+		return res.Interface()
+	}
+	return v
+}
+
+// EvalWithBindings is like Eval but it also makes the given
+// variables available to the expression. The variables apply
+// to this evaluation only: they do not modify the Expr. This
+// makes EvalWithBindings safe to call from multiple goroutines
+// at the same time, whereas RegisterVars is not.
+func (e *Expr) EvalWithBindings(data interface{}, bindings map[string]interface{}) (interface{}, error) {
+	return e.EvalWithOptions(context.Background(), data, EvalOptions{
+		Bindings: bindings,
+	})
+}
+
+// EvalInto is like Eval but it stores the result in the value
+// pointed to by out. The result is converted to the type of
+// out using the same rules as json.Unmarshal, and conversion
+// errors are reported in the same way. Typically, out points
+// to a struct, a slice or a map.
+//
+// If the expression yields no results, EvalInto returns
+// ErrUndefined and out is not modified.
+func (e *Expr) EvalInto(data interface{}, out interface{}) error {
+
+	result, err := e.Eval(data)
+	if err != nil {
+		return err
+	}
+
+	return decodeResult(result, out)
+}
+
 // EvalBytes is like Eval but it accepts and returns byte slices
 // instead of objects.
 func (e *Expr) EvalBytes(data []byte) ([]byte, error) {
+	return e.EvalBytesWithOptions(context.Background(), data, EvalOptions{})
+}
+
+// EvalBytesWithOptions is like EvalWithOptions but it accepts
+// and returns byte slices instead of objects. If opts.UseNumber
+// is set, numbers in the input are decoded as json.Numbers.
+func (e *Expr) EvalBytesWithOptions(ctx context.Context, data []byte, opts EvalOptions) ([]byte, error) {
 
 	var v interface{}
 
-	err := json.Unmarshal(data, &v)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if opts.UseNumber {
+		dec.UseNumber()
+	}
+
+	err := dec.Decode(&v)
 	if err != nil {
 		return nil, err
 	}
 
-	v, err = e.Eval(v)
+	// Like json.Unmarshal, reject trailing data after
+	// the first JSON value.
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+
+	v, err = e.EvalWithOptions(ctx, v, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -183,6 +439,10 @@ func (e *Expr) EvalBytes(data []byte) ([]byte, error) {
 // are only available to this Expr object. To make custom
 // functions available to all Expr objects, use the package
 // level RegisterExts function.
+//
+// Deprecated: RegisterExts modifies a compiled expression.
+// Add custom functions to a Registry and use CompileWith
+// instead.
 func (e *Expr) RegisterExts(exts map[string]Extension) error {
 
 	values, err := processExts(exts)
@@ -199,6 +459,10 @@ func (e *Expr) RegisterExts(exts map[string]Extension) error {
 // are only available to this Expr object. To make custom
 // variables available to all Expr objects, use the package
 // level RegisterVars function.
+//
+// Deprecated: RegisterVars modifies a compiled expression.
+// Use EvalOptions.Bindings to pass variables to a single
+// evaluation, or add them to a Registry and use CompileWith.
 func (e *Expr) RegisterVars(vars map[string]interface{}) error {
 
 	values, err := processVars(vars)
@@ -218,29 +482,82 @@ func (e *Expr) String() string {
 	return e.node.String()
 }
 
+// updateRegistry adds values to the Expr's registry. The
+// registry may be in use by concurrent evaluations so it is
+// replaced rather than modified.
 func (e *Expr) updateRegistry(values map[string]reflect.Value) {
 
-	for name, v := range values {
-		if e.registry == nil {
-			e.registry = make(map[string]reflect.Value, len(values))
-		}
-		e.registry[name] = v
+	if len(values) == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	registry := mergeValues(e.loadRegistry(), values)
+	e.registry.Store(&registry)
+}
+
+func (e *Expr) loadRegistry() map[string]reflect.Value {
+	if p := e.registry.Load(); p != nil {
+		return *p
 	}
+	return nil
 }
 
-func (e *Expr) newEnv(input reflect.Value) *environment {
+func (e *Expr) newEnv(ctx context.Context, input reflect.Value, opts EvalOptions) (*environment, error) {
+
+	bindings, err := processVars(opts.Bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	state := newEvalState(ctx, opts)
+	clock := opts.Clock
+	if clock == nil {
+		clock = time.Now
+	}
 
-	tc := timeCallables(time.Now())
+	tc := timeCallables(clock())
+	registry := e.loadRegistry()
 
 	// create a new base environment (with the standard functions) to
 	// ensure each execution gets its own set of goCallables for functions.
-	env := newEnvironment(initBaseEnv(standardFunctions), len(tc)+len(e.registry)+1)
+	env := newEnvironment(initBaseEnv(standardFunctions, state), len(tc)+len(registry)+len(bindings)+2)
+	env.src = e.src
 
 	env.bind("$", input)
+	env.bind("eval", reflect.ValueOf(newEvalCallable(env, len(e.forbidden) > 0)))
 	env.bindAll(tc)
-	env.bindAll(e.registry)
+	if opts.RandSource != nil {
+		env.bindAll(randomCallables(rand.New(opts.RandSource)))
+	}
+	if opts.Decimal {
+		env.bindAll(decimalCallables())
+	}
+	if opts.Parallelism > 1 {
+		env.bindAll(parallelCallables(state))
+	}
+	env.bindAll(registry)
+
+	// Custom functions that take a context.Context are shared
+	// between evaluations. Give this evaluation its own copy
+	// with the correct context.
+	for name, v := range registry {
+		if !v.IsValid() || !v.CanInterface() {
+			continue
+		}
+		if fn, ok := v.Interface().(*goCallable); ok && fn.hasCtx {
+			fn2 := *fn
+			fn2.ctx = ctx
+			env.bind(name, reflect.ValueOf(&fn2))
+		}
+	}
 
-	return env
+	env.bindAll(bindings)
+	bindForbidden(env, e.forbidden)
+
+	return env, nil
 }
 
 var (
@@ -293,6 +610,54 @@ func timeCallables(t time.Time) map[string]reflect.Value {
 	}
 }
 
+// randomCallables returns versions of the $random and $shuffle
+// functions that take their random numbers from r.
+func randomCallables(r *rand.Rand) map[string]reflect.Value {
+
+	random := standardFunctions["random"]
+	random.Func = func() float64 {
+		return jlib.RandomWith(r)
+	}
+
+	shuffle := standardFunctions["shuffle"]
+	shuffle.Func = func(v reflect.Value) interface{} {
+		return jlib.ShuffleWith(r, v)
+	}
+
+	// A rand.Rand is not safe for concurrent use.
+	random.Sequential = true
+	shuffle.Sequential = true
+
+	return map[string]reflect.Value{
+		"random":  reflect.ValueOf(mustGoCallable("random", random)),
+		"shuffle": reflect.ValueOf(mustGoCallable("shuffle", shuffle)),
+	}
+}
+
+// decimalCallables returns versions of the numeric functions
+// that use exact decimal arithmetic.
+func decimalCallables() map[string]reflect.Value {
+
+	sum := standardFunctions["sum"]
+	sum.Func = jlib.SumDecimal
+
+	average := standardFunctions["average"]
+	average.Func = jlib.AverageDecimal
+
+	round := standardFunctions["round"]
+	round.Func = jlib.RoundDecimal
+
+	formatNumber := standardFunctions["formatNumber"]
+	formatNumber.Func = jlib.FormatNumberDecimal
+
+	return map[string]reflect.Value{
+		"sum":          reflect.ValueOf(mustGoCallable("sum", sum)),
+		"average":      reflect.ValueOf(mustGoCallable("average", average)),
+		"round":        reflect.ValueOf(mustGoCallable("round", round)),
+		"formatNumber": reflect.ValueOf(mustGoCallable("formatNumber", formatNumber)),
+	}
+}
+
 func processExts(exts map[string]Extension) (map[string]reflect.Value, error) {
 
 	var m map[string]reflect.Value
@@ -340,20 +705,6 @@ func processVars(vars map[string]interface{}) (map[string]reflect.Value, error)
 	return m, nil
 }
 
-func updateGlobalRegistry(values map[string]reflect.Value) {
-
-	globalRegistryMutex.Lock()
-
-	for name, v := range values {
-		if globalRegistry == nil {
-			globalRegistry = make(map[string]reflect.Value, len(values))
-		}
-		globalRegistry[name] = v
-	}
-
-	globalRegistryMutex.Unlock()
-}
-
 func validName(s string) bool {
 
 	if len(s) == 0 {
@@ -382,25 +733,19 @@ func isDigit(r rune) bool {
 	return (r >= '0' && r <= '9') || unicode.IsDigit(r)
 }
 
-type (
-	// need this indirection to avoid an initialization cycle with DoEval.
-	evali interface {
-		doEval(reflect.Value, string) (any, error)
-	}
-	evalc struct{}
-)
-
-// DoEval supports $eval(script, [context])
+// DoEval parses and evaluates the expression s against ctx,
+// or against sub if it is set. The expression only has access
+// to the standard functions and to the custom functions and
+// variables registered at the package level.
+//
+// Deprecated: DoEval was used to implement the $eval function,
+// which now evaluates expressions in the environment of the
+// caller.
 func DoEval(ctx reflect.Value, s string, sub jtypes.OptionalValue) (any, error) {
 	// replace the context if the optional second argument is provided.
 	if sub.IsSet() {
 		ctx = sub.Value
 	}
-	var e evali = evalc{}
-	return e.doEval(ctx, s)
-}
-
-func (evalc) doEval(ctx reflect.Value, s string) (any, error) {
 	expr, err := Compile(s)
 	if err != nil {
 		return nil, err
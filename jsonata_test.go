@@ -5,19 +5,25 @@
 package jsonata
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"math/big"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 	"unicode/utf8"
 
+	"github.com/stepzen-dev/jsonata-go/jlib"
+	"github.com/stepzen-dev/jsonata-go/jlib/jxpath"
 	"github.com/stepzen-dev/jsonata-go/jparse"
 	"github.com/stepzen-dev/jsonata-go/jtypes"
 	"github.com/stretchr/testify/require"
@@ -38,6 +44,20 @@ type testCase struct {
 	// given expression(s).
 	Exts map[string]Extension
 
+	// Context is the context to use when evaluating the given
+	// expression(s). If nil, context.Background is used.
+	Context context.Context
+
+	// Options holds the options to use when evaluating the given
+	// expression(s).
+	Options EvalOptions
+
+	// Into, if set, returns a pointer to a Go value. The given
+	// expression(s) are evaluated with EvalInto, which decodes
+	// the result into the value, and Output is the expected
+	// pointer.
+	Into func() interface{}
+
 	// Output is the expected output for the given expression(s).
 	Output interface{}
 
@@ -1042,6 +1062,48 @@ func TestParens(t *testing.T) {
 	})
 }
 
+func TestComments(t *testing.T) {
+
+	runTestCases(t, testdata.foobar, []*testCase{
+		{
+			Expression: []string{
+				"/* comment */ foo.blah.baz.fud",
+				"foo.blah.baz.fud /* comment */",
+				"foo /* a */ . /* b */ blah.baz.fud",
+				"foo.blah.baz.fud/**/",
+			},
+			Output: []interface{}{
+				"hello",
+				"world",
+			},
+		},
+		{
+			Expression: `/* Long-winded expressions might need some explanation */
+(
+  /* First, work out the total */
+  $total := 4 + 2;
+
+  /* Then halve it */
+  $total / 2
+)`,
+			Output: float64(3),
+		},
+		{
+			Expression: `"/* not a comment */"`,
+			Output:     "/* not a comment */",
+		},
+		{
+			Expression: "4 + 2 /* unterminated",
+			Error: &jparse.Error{
+				Type:     jparse.ErrUnterminatedComment,
+				Token:    "/* unterminated",
+				Hint:     "*/",
+				Position: 6,
+			},
+		},
+	})
+}
+
 func TestStringConcat(t *testing.T) {
 
 	runTestCases(t, nil, []*testCase{
@@ -1549,6 +1611,123 @@ func TestNotFound(t *testing.T) {
 	})
 }
 
+func TestNullValues(t *testing.T) {
+
+	// Nulls in maps and arrays must be distinguishable from
+	// missing values, whether or not the data is made up of
+	// the types used by encoding/json.
+	data := map[string]interface{}{
+		"a": nil,
+		"b": []interface{}{
+			map[string]interface{}{"c": nil},
+			map[string]interface{}{"c": 1.0},
+			map[string]interface{}{"d": 2.0},
+			nil,
+		},
+	}
+
+	runTestCases(t, data, []*testCase{
+		{
+			Expression: "a",
+			Output:     nil,
+		},
+		{
+			Expression: "x",
+			Error:      ErrUndefined,
+		},
+		{
+			Expression: "b.c",
+			Output:     []interface{}{nil, 1.0},
+		},
+		{
+			Expression: "b[3]",
+			Output:     nil,
+		},
+		{
+			Expression: "$count(*)",
+			Output:     5,
+		},
+		{
+			Expression: "$count(**)",
+			Output:     9,
+		},
+		{
+			Expression: "$keys($sift($, function($v) { $v = null }))",
+			Output:     "a",
+		},
+		{
+			Expression: "$count($each($, function($v) { $v }))",
+			Output:     2,
+		},
+		{
+			Expression: "$spread(b[0])",
+			Output: []interface{}{
+				map[string]interface{}{"c": nil},
+			},
+		},
+	})
+}
+
+func BenchmarkNativeValues(b *testing.B) {
+
+	type item struct {
+		Name  string   `json:"name"`
+		Price float64  `json:"price"`
+		Tags  []string `json:"tags"`
+	}
+
+	items := make([]item, 1000)
+	for i := range items {
+		items[i] = item{
+			Name:  fmt.Sprintf("item%d", i),
+			Price: float64(i),
+			Tags:  []string{"a", "b"},
+		}
+	}
+
+	// Compare data decoded by encoding/json, which takes
+	// the fast paths, with the equivalent Go structs, which
+	// go through reflection.
+	var native interface{}
+	buf, err := json.Marshal(map[string]interface{}{"items": items})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := json.Unmarshal(buf, &native); err != nil {
+		b.Fatal(err)
+	}
+
+	inputs := []struct {
+		Name string
+		Data interface{}
+	}{
+		{"json", native},
+		{"struct", map[string]interface{}{"items": items}},
+	}
+
+	exprs := []string{
+		"items.name",
+		"items[price > 500]",
+		"$sum(items.price)",
+		"$max(items.price)",
+		"items.tags",
+		"$count(**)",
+	}
+
+	for _, expr := range exprs {
+		e := MustCompile(expr)
+		for _, input := range inputs {
+			b.Run(expr+"/"+input.Name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := e.Eval(input.Data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
 func TestSortOperator(t *testing.T) {
 
 	runTestCases(t, testdata.account, []*testCase{
@@ -3693,7 +3872,7 @@ func TestFuncSort2(t *testing.T) {
 		},
 		{
 			Expression: "$sort(Account.Order.Product)",
-			Error:      fmt.Errorf("argument 1 of function sort must be an array of strings or numbers"), // TODO: Use a proper error
+			Error:      &jlib.Error{Func: "sort", Type: jlib.ErrNonSortable},
 		},
 	})
 }
@@ -3935,7 +4114,7 @@ func TestFuncZip(t *testing.T) {
 		},
 		{
 			Expression: `$zip()`,
-			Error:      fmt.Errorf("cannot call zip with no arguments"),
+			Error:      &jlib.Error{Func: "zip", Type: jlib.ErrZipArgs},
 		},
 	})
 }
@@ -3974,14 +4153,14 @@ func TestFuncSum(t *testing.T) {
 				"$sum(true)",
 				`$sum({"one":1})`,
 			},
-			Error: errors.New("cannot call sum on a non-array type"), // TODO: Don't rely on error strings
+			Error: &jlib.Error{Func: "sum", Type: jlib.ErrNonNumberArray},
 		},
 		{
 			Expression: []string{
 				`$sum([1,2,"3"])`,
 				"$sum([1,2,true])",
 			},
-			Error: errors.New("cannot call sum on an array with non-number types"), // TODO: Don't rely on error strings
+			Error: &jlib.Error{Func: "sum", Type: jlib.ErrNonNumberArray},
 		},
 		{
 			Expression: "$sum()",
@@ -4030,7 +4209,7 @@ func TestFuncSum2(t *testing.T) {
 		},
 		{
 			Expression: "$sum(Account.Order)",
-			Error:      fmt.Errorf("cannot call sum on an array with non-number types"), // TODO: relying on error strings is bad
+			Error:      &jlib.Error{Func: "sum", Type: jlib.ErrNonNumberArray},
 		},
 	})
 }
@@ -4069,14 +4248,14 @@ func TestFuncMax(t *testing.T) {
 				`$max(true)`,
 				`$max({"one":1})`,
 			},
-			Error: fmt.Errorf("cannot call max on a non-array type"), // TODO: Don't rely on the error string
+			Error: &jlib.Error{Func: "max", Type: jlib.ErrNonNumberArray},
 		},
 		{
 			Expression: []string{
 				`$max(["1","2","3"])`,
 				`$max(["1","2",3])`,
 			},
-			Error: fmt.Errorf("cannot call max on an array with non-number types"), // TODO: Don't rely on the error string
+			Error: &jlib.Error{Func: "max", Type: jlib.ErrNonNumberArray},
 		},
 		{
 			Expression: "$max()",
@@ -4162,14 +4341,14 @@ func TestFuncMin(t *testing.T) {
 				`$min(true)`,
 				`$min({"one":1})`,
 			},
-			Error: fmt.Errorf("cannot call min on a non-array type"), // TODO: Don't rely on error strings
+			Error: &jlib.Error{Func: "min", Type: jlib.ErrNonNumberArray},
 		},
 		{
 			Expression: []string{
 				`$min(["1","2","3"])`,
 				`$min(["1","2",3])`,
 			},
-			Error: fmt.Errorf("cannot call min on an array with non-number types"), // TODO: Don't rely on error strings
+			Error: &jlib.Error{Func: "min", Type: jlib.ErrNonNumberArray},
 		},
 		{
 			Expression: "$min()",
@@ -4252,14 +4431,14 @@ func TestFuncAverage(t *testing.T) {
 				`$average(true)`,
 				`$average({"one":1})`,
 			},
-			Error: fmt.Errorf("cannot call average on a non-array type"), // TODO: Don't rely on the error string
+			Error: &jlib.Error{Func: "average", Type: jlib.ErrNonNumberArray},
 		},
 		{
 			Expression: []string{
 				`$average(["1","2","3"])`,
 				`$average(["1","2",3])`,
 			},
-			Error: fmt.Errorf("cannot call average on an array with non-number types"), // TODO: Don't rely on the error string
+			Error: &jlib.Error{Func: "average", Type: jlib.ErrNonNumberArray},
 		},
 		{
 			Expression: "$average()",
@@ -4858,7 +5037,7 @@ func TestFuncReduce(t *testing.T) {
 					$seq := 1;
 					$reduce($seq, function($x){$x})
 				)`,
-			Error: fmt.Errorf("second argument of function \"reduce\" must be a function that takes two arguments"),
+			Error: &jlib.Error{Func: "reduce", Type: jlib.ErrReduceArgs},
 		},
 	})
 }
@@ -5602,7 +5781,7 @@ func TestFuncSplit(t *testing.T) {
 		},
 		{
 			Expression: `$split("a, b, c, d", ", ", -3)`,
-			Error:      fmt.Errorf("third argument of the split function must evaluate to a positive number"), // TODO: Use a proper error for this
+			Error:      &jlib.Error{Func: "split", Type: jlib.ErrSplitLimit},
 		},
 		{
 			Expression: []string{
@@ -5661,11 +5840,11 @@ func TestFuncJoin(t *testing.T) {
 		},
 		{
 			Expression: `$join(true, ", ")`,
-			Error:      fmt.Errorf("function join takes an array of strings"), // TODO: Use a proper error
+			Error:      &jlib.Error{Func: "join", Type: jlib.ErrNonStringArray},
 		},
 		{
 			Expression: `$join([1,2,3], ", ")`,
-			Error:      fmt.Errorf("function join takes an array of strings"), // TODO: Use a proper error
+			Error:      &jlib.Error{Func: "join", Type: jlib.ErrNonStringArray},
 		},
 		{
 			Expression: `$join("hello", 3)`,
@@ -5765,11 +5944,11 @@ func TestFuncReplace(t *testing.T) {
 		},
 		{
 			Expression: `$replace("hello", "l", "1", -2)`,
-			Error:      fmt.Errorf("fourth argument of function replace must evaluate to a positive number"), // TODO: Use a proper error
+			Error:      &jlib.Error{Func: "replace", Type: jlib.ErrReplaceLimit},
 		},
 		{
 			Expression: `$replace("hello", "", "bye")`,
-			Error:      fmt.Errorf("second argument of function replace can't be an empty string"), // TODO: Use a proper error
+			Error:      &jlib.Error{Func: "replace", Type: jlib.ErrEmptyPattern},
 		},
 	})
 }
@@ -5865,59 +6044,59 @@ func TestFormatNumber(t *testing.T) {
 
 		{
 			Expression: `$formatNumber(20,"#;#;#")`,
-			Error:      fmt.Errorf("picture string must contain 1 or 2 subpictures"),
+			Error:      &jxpath.Error{Type: jxpath.ErrSubpictureCount},
 		},
 		{
 			Expression: `$formatNumber(20,"#.0.0")`,
-			Error:      fmt.Errorf("a subpicture cannot contain more than one decimal separator"),
+			Error:      &jxpath.Error{Type: jxpath.ErrDecimalSeparators},
 		},
 		{
 			Expression: `$formatNumber(20,"#0%%")`,
-			Error:      fmt.Errorf("a subpicture cannot contain more than one percent character"),
+			Error:      &jxpath.Error{Type: jxpath.ErrPercents},
 		},
 		{
 			Expression: `$formatNumber(20,"#0‰‰")`,
-			Error:      fmt.Errorf("a subpicture cannot contain more than one per-mille character"),
+			Error:      &jxpath.Error{Type: jxpath.ErrPerMilles},
 		},
 		{
 			Expression: `$formatNumber(20,"#0%‰")`,
-			Error:      fmt.Errorf("a subpicture cannot contain both percent and per-mille characters"),
+			Error:      &jxpath.Error{Type: jxpath.ErrPercentPerMille},
 		},
 		{
 			Expression: `$formatNumber(20,".e0")`,
-			Error:      fmt.Errorf("a mantissa part must contain at least one decimal or optional digit"),
+			Error:      &jxpath.Error{Type: jxpath.ErrMantissaDigits},
 		},
 		{
 			Expression: `$formatNumber(20,"0+.e0")`,
-			Error:      fmt.Errorf("a subpicture cannot contain a passive character that is both preceded by and followed by an active character"),
+			Error:      &jxpath.Error{Type: jxpath.ErrPassiveCharacter},
 		},
 		{
 			Expression: `$formatNumber(20,"0,.e0")`,
-			Error:      fmt.Errorf("a group separator cannot be adjacent to a decimal separator"),
+			Error:      &jxpath.Error{Type: jxpath.ErrGroupSeparatorAdjacent},
 		},
 		{
 			Expression: `$formatNumber(20,"0,")`,
-			Error:      fmt.Errorf("an integer part cannot end with a group separator"),
+			Error:      &jxpath.Error{Type: jxpath.ErrGroupSeparatorEnd},
 		},
 		{
 			Expression: `$formatNumber(20,"0,,0")`,
-			Error:      fmt.Errorf("a subpicture cannot contain adjacent group separators"),
+			Error:      &jxpath.Error{Type: jxpath.ErrGroupSeparators},
 		},
 		{
 			Expression: `$formatNumber(20,"0#.e0")`,
-			Error:      fmt.Errorf("an integer part cannot contain a decimal digit followed by an optional digit"),
+			Error:      &jxpath.Error{Type: jxpath.ErrIntegerDigits},
 		},
 		{
 			Expression: `$formatNumber(20,"#0.#0e0")`,
-			Error:      fmt.Errorf("a fractional part cannot contain an optional digit followed by a decimal digit"),
+			Error:      &jxpath.Error{Type: jxpath.ErrFractionalDigits},
 		},
 		{
 			Expression: `$formatNumber(20,"#0.0e0%")`,
-			Error:      fmt.Errorf("a subpicture cannot contain a percent/per-mille character and an exponent separator"),
+			Error:      &jxpath.Error{Type: jxpath.ErrPercentExponent},
 		},
 		{
 			Expression: `$formatNumber(20,"#0.0e0,0")`,
-			Error:      fmt.Errorf("an exponent part must consist solely of one or more decimal digits"),
+			Error:      &jxpath.Error{Type: jxpath.ErrExponentDigits},
 		},
 	})
 }
@@ -5946,7 +6125,7 @@ func TestFuncFormatBase(t *testing.T) {
 		},
 		{
 			Expression: "$formatBase(100, 1)",
-			Error:      fmt.Errorf("the second argument to formatBase must be between 2 and 36"),
+			Error:      &jlib.Error{Func: "formatBase", Type: jlib.ErrRadix, Value: "1"},
 			/*Error: &EvalError1{
 				Errno:    ErrInvalidBase,
 				Position: -3,
@@ -5955,7 +6134,7 @@ func TestFuncFormatBase(t *testing.T) {
 		},
 		{
 			Expression: "$formatBase(100, 37)",
-			Error:      fmt.Errorf("the second argument to formatBase must be between 2 and 36"),
+			Error:      &jlib.Error{Func: "formatBase", Type: jlib.ErrRadix, Value: "37"},
 			/*Error: &EvalError1{
 				Errno:    ErrInvalidBase,
 				Position: -3,
@@ -6035,7 +6214,7 @@ func TestFuncNumber(t *testing.T) {
 		},
 		{
 			Expression: `$number("10e500")`,
-			Error:      fmt.Errorf("unable to cast %q to a number", "10e500"),
+			Error:      &jlib.Error{Func: "number", Type: jlib.ErrNumberCast, Value: "10e500"},
 			/*Error: &EvalError1{
 				Errno:    ErrCastNumber,
 				Position: -10,
@@ -6044,7 +6223,7 @@ func TestFuncNumber(t *testing.T) {
 		},
 		{
 			Expression: `$number("Hello world")`,
-			Error:      fmt.Errorf("unable to cast %q to a number", "Hello world"),
+			Error:      &jlib.Error{Func: "number", Type: jlib.ErrNumberCast, Value: "Hello world"},
 			/*Error: &EvalError1{
 				Errno:    ErrCastNumber,
 				Position: -10,
@@ -6053,7 +6232,7 @@ func TestFuncNumber(t *testing.T) {
 		},
 		{
 			Expression: `$number("1/2")`,
-			Error:      fmt.Errorf("unable to cast %q to a number", "1/2"),
+			Error:      &jlib.Error{Func: "number", Type: jlib.ErrNumberCast, Value: "1/2"},
 			/*Error: &EvalError1{
 				Errno:    ErrCastNumber,
 				Position: -10,
@@ -6062,7 +6241,7 @@ func TestFuncNumber(t *testing.T) {
 		},
 		{
 			Expression: `$number("1234 hello")`,
-			Error:      fmt.Errorf("unable to cast %q to a number", "1234 hello"),
+			Error:      &jlib.Error{Func: "number", Type: jlib.ErrNumberCast, Value: "1234 hello"},
 			/*Error: &EvalError1{
 				Errno:    ErrCastNumber,
 				Position: -10,
@@ -6071,7 +6250,7 @@ func TestFuncNumber(t *testing.T) {
 		},
 		{
 			Expression: `$number("")`,
-			Error:      fmt.Errorf("unable to cast %q to a number", ""),
+			Error:      &jlib.Error{Func: "number", Type: jlib.ErrNumberCast, Value: ""},
 			/*Error: &EvalError1{
 				Errno:    ErrCastNumber,
 				Position: -10,
@@ -6080,7 +6259,7 @@ func TestFuncNumber(t *testing.T) {
 		},
 		{
 			Expression: `$number("[1]")`,
-			Error:      fmt.Errorf("unable to cast %q to a number", "[1]"),
+			Error:      &jlib.Error{Func: "number", Type: jlib.ErrNumberCast, Value: "[1]"},
 			/*Error: &EvalError1{
 				Errno:    ErrCastNumber,
 				Position: -10,
@@ -6317,7 +6496,7 @@ func TestFuncSqrt(t *testing.T) {
 		},
 		{
 			Expression: "$sqrt(-2)",
-			Error:      fmt.Errorf("the sqrt function cannot be applied to a negative number"),
+			Error:      &jlib.Error{Func: "sqrt", Type: jlib.ErrSqrtNegative},
 		},
 		{
 			Expression: "$sqrt(nothing)",
@@ -6361,11 +6540,11 @@ func TestFuncPower(t *testing.T) {
 		},
 		{
 			Expression: "$power(-2,1/3)",
-			Error:      fmt.Errorf("the power function has resulted in a value that cannot be represented as a JSON number"),
+			Error:      &jlib.Error{Func: "power", Type: jlib.ErrPowerRange},
 		},
 		{
 			Expression: "$power(100,1000)",
-			Error:      fmt.Errorf("the power function has resulted in a value that cannot be represented as a JSON number"),
+			Error:      &jlib.Error{Func: "power", Type: jlib.ErrPowerRange},
 		},
 	})
 }
@@ -6384,6 +6563,49 @@ func TestFuncRandom(t *testing.T) {
 	})
 }
 
+func TestEvalRandSource(t *testing.T) {
+
+	exprs := []string{
+		`$random()`,
+		`[$random(), $random(), $random()]`,
+		`$shuffle([1..20])`,
+		`$shuffle($)`,
+		`$shuffle($)[0] & $string($random())`,
+	}
+
+	data := []interface{}{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	eval := func(expr *Expr, seed int64) interface{} {
+		output, err := expr.EvalWithOptions(context.Background(), data, EvalOptions{
+			RandSource: rand.NewSource(seed),
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", expr, err)
+		}
+		return output
+	}
+
+	for _, s := range exprs {
+
+		expr := MustCompile(s)
+
+		// The same seed must give the same output.
+		output1 := eval(expr, 42)
+		output2 := eval(expr, 42)
+
+		if !reflect.DeepEqual(output1, output2) {
+			t.Errorf("%s: expected identical output, got %v and %v", s, output1, output2)
+		}
+
+		// A different seed gives different output.
+		output3 := eval(expr, 43)
+
+		if reflect.DeepEqual(output1, output3) {
+			t.Errorf("%s: expected different output, got %v", s, output1)
+		}
+	}
+}
+
 func TestFuncKeys(t *testing.T) {
 
 	runTestCasesFunc(t, equalArraysUnordered, testdata.account, []*testCase{
@@ -7262,7 +7484,7 @@ func TestRegexMatch(t *testing.T) {
 		},
 		{
 			Expression: `$match("a, b, c, d", /ab/, -3)`,
-			Error:      fmt.Errorf("third argument of function match must evaluate to a positive number"), // TODO: use a proper error
+			Error:      &jlib.Error{Func: "match", Type: jlib.ErrMatchLimit},
 		},
 		{
 			Expression: `$match(12345, 3)`,
@@ -7438,12 +7660,12 @@ func TestRegexReplace2(t *testing.T) {
 		{
 			Expression: `Account.Order.Product.$replace($.` + "`Product Name`" + `, /(?i)hat/,
 				function($match) { true })`,
-			Error: fmt.Errorf("third argument of function replace must be a function that returns a string"),
+			Error: &jlib.Error{Func: "replace", Type: jlib.ErrReplacementResult},
 		},
 		{
 			Expression: `Account.Order.Product.$replace($.` + "`Product Name`" + `, /(?i)hat/,
 				function($match) { 42 })`,
-			Error: fmt.Errorf("third argument of function replace must be a function that returns a string"),
+			Error: &jlib.Error{Func: "replace", Type: jlib.ErrReplacementResult},
 		},
 	})
 }
@@ -7623,6 +7845,44 @@ func TestFuncMillis2(t *testing.T) {
 	})
 }
 
+func TestEvalClock(t *testing.T) {
+
+	clock := func() time.Time {
+		return time.Date(2020, time.March, 1, 12, 30, 45, 123000000, time.UTC)
+	}
+
+	// ticker advances by a second each time it is read.
+	now := clock()
+	ticker := func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	runTestCases(t, nil, []*testCase{
+		{
+			Expression: `$now()`,
+			Options:    EvalOptions{Clock: clock},
+			Output:     "2020-03-01T12:30:45.123Z",
+		},
+		{
+			Expression: `$now("[Y0001]-[M01]-[D01]")`,
+			Options:    EvalOptions{Clock: clock},
+			Output:     "2020-03-01",
+		},
+		{
+			Expression: `$millis()`,
+			Options:    EvalOptions{Clock: clock},
+			Output:     int64(1583065845123),
+		},
+		{
+			// The clock is read once per evaluation.
+			Expression: `[$millis(), $now(), $millis()]`,
+			Options:    EvalOptions{Clock: ticker},
+			Output:     []interface{}{int64(1583065846123), "2020-03-01T12:30:46.123Z", int64(1583065846123)},
+		},
+	})
+}
+
 func TestFuncToMillis(t *testing.T) {
 
 	runTestCases(t, nil, []*testCase{
@@ -7640,7 +7900,7 @@ func TestFuncToMillis(t *testing.T) {
 		},
 		{
 			Expression: `$toMillis("foo")`,
-			Error:      fmt.Errorf(`could not parse time "foo"`),
+			Error:      &jlib.Error{Func: "toMillis", Type: jlib.ErrInvalidTimestamp, Value: "foo"},
 		},
 	})
 }
@@ -7864,6 +8124,7 @@ func TestLambdaSignatureViolations(t *testing.T) {
 			Error: &ArgTypeError{
 				Func:  "lambda",
 				Which: 1,
+				Array: true,
 			},
 		},
 		{
@@ -7871,6 +8132,7 @@ func TestLambdaSignatureViolations(t *testing.T) {
 			Error: &ArgTypeError{
 				Func:  "lambda",
 				Which: 1,
+				Array: true,
 			},
 		},
 		{
@@ -7878,6 +8140,7 @@ func TestLambdaSignatureViolations(t *testing.T) {
 			Error: &ArgTypeError{
 				Func:  "lambda",
 				Which: 1,
+				Array: true,
 			},
 		},
 		{
@@ -7889,6 +8152,7 @@ func TestLambdaSignatureViolations(t *testing.T) {
 			Error: &ArgTypeError{
 				Func:  "fun",
 				Which: 1,
+				Array: true,
 			},
 		},
 		{
@@ -7989,6 +8253,11 @@ func runTestCase(t *testing.T, equal compareFunc, input interface{}, test *testC
 		t.Fatalf("Bad expression: %T %v", e, e)
 	}
 
+	ctx := test.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	var output interface{}
 
 	for _, exp := range exps {
@@ -7997,18 +8266,54 @@ func runTestCase(t *testing.T, equal compareFunc, input interface{}, test *testC
 		if err == nil {
 			must(t, "Vars", expr.RegisterVars(test.Vars))
 			must(t, "Exts", expr.RegisterExts(test.Exts))
-			output, err = expr.Eval(input)
+			output, err = evalCase(ctx, expr, input, test)
 		}
 
 		if !equal(output, test.Output) {
 			t.Errorf("\nExpression: %s\nExp. Value: %v [%T]\nAct. Value: %v [%T]", exp, test.Output, test.Output, output, output)
 		}
-		if !reflect.DeepEqual(err, test.Error) {
+		if !reflect.DeepEqual(clearLocation(err), test.Error) {
 			t.Errorf("\nExpression: %s\nExp. Error: %v [%T]\nAct. Error: %v [%T]", exp, test.Error, test.Error, err, err)
 		}
 	}
 }
 
+// evalCase evaluates an expression for a test case. If
+// the input is a []byte, the expression is evaluated with
+// EvalBytesWithOptions and the output is a JSON string.
+func evalCase(ctx context.Context, expr *Expr, input interface{}, test *testCase) (interface{}, error) {
+
+	if test.Into != nil {
+		output := test.Into()
+		return output, expr.EvalInto(input, output)
+	}
+
+	if b, ok := input.([]byte); ok {
+		output, err := expr.EvalBytesWithOptions(ctx, b, test.Options)
+		if err != nil {
+			return nil, err
+		}
+		return string(output), nil
+	}
+
+	return expr.EvalWithOptions(ctx, input, test.Options)
+}
+
+// clearLocation removes the location from an evaluation
+// error, so that errors can be compared without having to
+// spell out where they occurred. Locations are tested in
+// TestErrorLocations. Errors returned by Go functions are
+// unwrapped for the same reason.
+func clearLocation(err error) error {
+	if e, ok := err.(*CallError); ok {
+		return e.Err
+	}
+	if loc := errorLocation(err); loc != nil {
+		*loc = nil
+	}
+	return err
+}
+
 func equalRegexMatches(v1 interface{}, v2 interface{}) bool {
 
 	makeMap := func(in interface{}) map[string]interface{} {
@@ -8194,5 +8499,1032 @@ func TestFuncEval(t *testing.T) {
 			Expression: `$eval("a+b", {"a":8.4, "b": 33.6})`,
 			Output:     42.0,
 		},
+		{
+			// ensure local variables are visible
+			Expression: `($n := 40; $eval("$n + 2"))`,
+			Output:     42.0,
+		},
+		{
+			// ensure registered variables and functions are visible
+			Expression: `$eval("$double($half)")`,
+			Vars: map[string]interface{}{
+				"half": 21.0,
+			},
+			Exts: map[string]Extension{
+				"double": {
+					Func: func(x float64) float64 {
+						return x * 2
+					},
+				},
+			},
+			Output: 42.0,
+		},
+		{
+			Expression: `$eval(nothing)`,
+			Error:      ErrUndefined,
+		},
+		{
+			Expression: `$eval(42)`,
+			Error: &ArgTypeError{
+				Func:  "eval",
+				Which: 1,
+			},
+		},
+		{
+			// ensure local variables are visible when $eval
+			// is passed to another function
+			Expression: `($n := 40; $map(["$n + 2"], $eval))`,
+			Output:     []any{42.0},
+		},
+		{
+			// ensure the context is picked up when $eval is
+			// passed to another function
+			Expression: `Account.$apply($eval, "Order.OrderID")`,
+			Exts: map[string]Extension{
+				"apply": {
+					Func: func(fn jtypes.Callable, s string) (interface{}, error) {
+						v, err := fn.Call([]reflect.Value{reflect.ValueOf(s)})
+						if err != nil || !v.IsValid() {
+							return nil, err
+						}
+						return v.Interface(), nil
+					},
+				},
+			},
+			Output: []any{"order103", "order104"},
+		},
+		{
+			Expression: `($e := $eval; Account.$e("Order.OrderID"))`,
+			Output:     []any{"order103", "order104"},
+		},
+	})
+}
+
+func TestEvalContext(t *testing.T) {
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	runTestCases(t, testdata.account, []*testCase{
+		{
+			Expression: `$sum([1..10])`,
+			Output:     float64(55),
+		},
+		{
+			Expression: `Account.Order.Product.Price`,
+			Context:    cancelled,
+			Error:      newEvalError(ErrCanceled, nil, nil),
+		},
+		{
+			Expression: `[1..10000000]`,
+			Context:    expired,
+			Error:      newEvalError(ErrDeadlineExceeded, nil, nil),
+		},
+		{
+			Expression: `$map([1..10], $string)`,
+			Context:    cancelled,
+			Error:      newEvalError(ErrCanceled, nil, nil),
+		},
+		{
+			Expression: `(
+				$loop := function($n) { $loop($n + 1) };
+				$loop(0)
+			)`,
+			Context: expired,
+			Error:   newEvalError(ErrDeadlineExceeded, nil, nil),
+		},
+	})
+}
+
+func TestEvalContextErrors(t *testing.T) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	expr := MustCompile(`$map([1..1000000], function($x) { $x * $x }) ~> $count()`)
+	_, err := expr.EvalContext(ctx, nil)
+
+	// The result depends on timing. If evaluation does not
+	// finish before the deadline, the error must wrap the
+	// context error.
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	<-ctx.Done()
+	_, err = expr.EvalContext(ctx, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+
+	runTestCases(t, nil, []*testCase{
+		{
+			Expression: `(
+				$fact := function($n, $acc) { $n <= 1 ? $acc : $fact($n - 1, $n * $acc) };
+				$fact(10, 1)
+			)`,
+			Output: float64(3628800),
+		},
+		{
+			// Tail calls in a block.
+			Expression: `(
+				$count := function($n, $acc) {(
+					$next := $acc + 1;
+					$n = 0 ? $acc : $count($n - 1, $next)
+				)};
+				$count(100000, 0)
+			)`,
+			Output: float64(100000),
+		},
+		{
+			// Mutual recursion.
+			Expression: `(
+				$even := function($n) { $n = 0 ? true : $odd($n - 1) };
+				$odd := function($n) { $n = 0 ? false : $even($n - 1) };
+				[$even(100001), $odd(100001)]
+			)`,
+			Output: []interface{}{
+				false,
+				true,
+			},
+		},
+		{
+			// Tail calls using function application.
+			Expression: `(
+				$sum := function($n, $acc) { $n = 0 ? $acc : ($n - 1) ~> $sum($acc + $n) };
+				$sum(100000, 0)
+			)`,
+			Output: float64(5000050000),
+		},
+		{
+			// A conditional with no else clause.
+			Expression: `(
+				$f := function($n) { $n > 0 ? $f($n - 1) };
+				$f(100000)
+			)`,
+			Error: ErrUndefined,
+		},
+		{
+			// Tail calls to Go functions.
+			Expression: `(
+				$f := function($s) { $uppercase($s) };
+				$f("hello")
+			)`,
+			Output: "HELLO",
+		},
 	})
 }
+
+func TestEvalWithOptions(t *testing.T) {
+
+	data := []interface{}{}
+	for i := 0; i < 100; i++ {
+		data = append(data, i)
+	}
+
+	runTestCases(t, data, []*testCase{
+		{
+			// Limits that are not reached have no effect.
+			Expression: `$sum($map($, function($x) { $x * 2 }))`,
+			Options: EvalOptions{
+				MaxDepth:      10,
+				MaxSteps:      10000,
+				MaxResultSize: 100,
+			},
+			Output: float64(9900),
+		},
+		{
+			Expression: `(
+				$f := function($n) { $n = 0 ? 0 : 1 + $f($n - 1) };
+				$f(50)
+			)`,
+			Options: EvalOptions{
+				MaxDepth: 100,
+			},
+			Output: float64(50),
+		},
+		{
+			// Tail calls do not count towards the depth.
+			Expression: `(
+				$f := function($n, $acc) { $n = 0 ? $acc : $f($n - 1, $acc + 1) };
+				$f(100000, 0)
+			)`,
+			Options: EvalOptions{
+				MaxDepth: 10,
+			},
+			Output: float64(100000),
+		},
+		{
+			Expression: `(
+				$f := function($n) { 1 + $f($n + 1) };
+				$f(0)
+			)`,
+			Options: EvalOptions{
+				MaxDepth: 100,
+			},
+			Error: &EvalError{
+				Type:  ErrMaxDepth,
+				Token: "f",
+				Value: "100",
+			},
+		},
+		{
+			Expression: `(
+				$f := function($n) { $n = 0 ? 0 : 1 + $f($n - 1) };
+				$f(200)
+			)`,
+			Options: EvalOptions{
+				MaxDepth: 100,
+			},
+			Error: &EvalError{
+				Type:  ErrMaxDepth,
+				Token: "f",
+				Value: "100",
+			},
+		},
+		{
+			Expression: `$map($, function($x) { $x * 2 })`,
+			Options: EvalOptions{
+				MaxSteps: 100,
+			},
+			Error: &EvalError{
+				Type:  ErrMaxSteps,
+				Value: "100",
+			},
+		},
+		{
+			Expression: `$[$ > 10]`,
+			Options: EvalOptions{
+				MaxResultSize: 50,
+			},
+			Error: &EvalError{
+				Type:  ErrMaxResultSize,
+				Value: "50",
+			},
+		},
+		{
+			Expression: `$count([1..1000000])`,
+			Options: EvalOptions{
+				MaxResultSize: 1000,
+			},
+			Error: &EvalError{
+				Type:  ErrMaxResultSize,
+				Value: "1000",
+			},
+		},
+		{
+			Expression: `$count([1..1000])`,
+			Options: EvalOptions{
+				MaxResultSize: 1000,
+			},
+			Output: 1000,
+		},
+		{
+			// Limits apply to expressions evaluated by $eval.
+			Expression: `$eval("$map($, function($x) { $x * 2 })")`,
+			Options: EvalOptions{
+				MaxSteps: 100,
+			},
+			Error: &EvalError{
+				Type:  ErrMaxSteps,
+				Value: "100",
+			},
+		},
+		{
+			Expression: `($s := "$eval($s)"; $eval($s))`,
+			Options: EvalOptions{
+				MaxDepth: 100,
+			},
+			Error: &EvalError{
+				Type:  ErrMaxDepth,
+				Token: "eval",
+				Value: "100",
+			},
+		},
+		{
+			Expression: `$eval("$n * 2")`,
+			Options: EvalOptions{
+				Bindings: map[string]interface{}{
+					"n": 21,
+				},
+			},
+			Output: float64(42),
+		},
+		{
+			Expression: `$eval("1 + 1")`,
+			Options: EvalOptions{
+				DisableEval: true,
+			},
+			Error: &EvalError{
+				Type:  ErrEvalDisabled,
+				Token: "eval",
+			},
+		},
+	})
+}
+
+func TestEvalWithBindings(t *testing.T) {
+
+	expr := MustCompile(`$greeting & ", " & $user`)
+	must(t, "Vars", expr.RegisterVars(map[string]interface{}{
+		"greeting": "Hello",
+		"user":     "nobody",
+	}))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			user := fmt.Sprintf("user%d", i)
+			output, err := expr.EvalWithBindings(nil, map[string]interface{}{
+				"user": user,
+			})
+
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", user, err)
+			}
+			if exp := "Hello, " + user; output != exp {
+				t.Errorf("%s: expected output %q, got %v", user, exp, output)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	// Bindings must not leak into subsequent evaluations.
+	output, err := expr.Eval(nil)
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if exp := "Hello, nobody"; output != exp {
+		t.Errorf("expected output %q, got %v", exp, output)
+	}
+
+	_, err = expr.EvalWithBindings(nil, map[string]interface{}{
+		"not valid": "",
+	})
+	if exp := "not valid is not a valid name"; err == nil || err.Error() != exp {
+		t.Errorf("expected error %q, got %v", exp, err)
+	}
+}
+
+type structTagsBase struct {
+	ID      string `json:"id"`
+	Created string `json:"created,omitempty"`
+}
+
+type structTagsItem struct {
+	SKU      string  `json:"sku"`
+	Price    float64 `json:"price"`
+	Quantity int     `json:"qty,omitempty"`
+}
+
+type structTagsOrder struct {
+	structTagsBase
+	OrderID  string            `json:"orderId"`
+	Customer string            `json:"customer,omitempty"`
+	Items    []structTagsItem  `json:"items"`
+	Notes    map[string]string `json:"notes,omitempty"`
+	Secret   string            `json:"-"`
+	Untagged bool
+	internal int
+}
+
+func TestStructTags(t *testing.T) {
+
+	order := structTagsOrder{
+		structTagsBase: structTagsBase{
+			ID: "abc",
+		},
+		OrderID: "order103",
+		Items: []structTagsItem{
+			{
+				SKU:      "0406654608",
+				Price:    34.45,
+				Quantity: 2,
+			},
+			{
+				SKU:   "0406634348",
+				Price: 21.67,
+			},
+		},
+		Secret:   "shh",
+		Untagged: true,
+		internal: 1,
+	}
+
+	// Evaluating an expression against a struct must give
+	// the same result as evaluating it against the struct's
+	// JSON encoding.
+	b, err := json.Marshal(order)
+	if err != nil {
+		t.Fatalf("json.Marshal: %s", err)
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal: %s", err)
+	}
+
+	exprs := []string{
+		`orderId`,
+		`id`,
+		`created`,
+		`customer`,
+		`Secret`,
+		`Untagged`,
+		`internal`,
+		`items.sku`,
+		`items[price > 30].qty`,
+		`$sum(items.(price * qty))`,
+		`$sort($keys($))`,
+		`$sort($keys(items))`,
+		`$sort($each($, function($v, $k) { $k }))`,
+		`$sift($, function($v) { $type($v) = "string" })`,
+		`$merge([$, {"extra": 1}]) ~> $keys() ~> $sort()`,
+		`$spread($) ~> $count()`,
+		`*[$type($) = "string"] ~> $sort()`,
+		`**.sku`,
+	}
+
+	for _, s := range exprs {
+
+		expr := MustCompile(s)
+
+		exp, experr := expr.Eval(decoded)
+		got, goterr := expr.Eval(order)
+
+		if !reflect.DeepEqual(goterr, experr) {
+			t.Errorf("%s: expected error %v, got %v", s, experr, goterr)
+			continue
+		}
+
+		if !equalJSON(t, got, exp) {
+			t.Errorf("%s: expected output %v, got %v", s, exp, got)
+		}
+	}
+}
+
+// equalJSON reports whether the JSON encodings of two values
+// are the same.
+func equalJSON(t *testing.T, v1, v2 interface{}) bool {
+
+	b1, err := json.Marshal(v1)
+	if err != nil {
+		t.Fatalf("json.Marshal: %s", err)
+	}
+
+	b2, err := json.Marshal(v2)
+	if err != nil {
+		t.Fatalf("json.Marshal: %s", err)
+	}
+
+	return string(b1) == string(b2)
+}
+
+type evalIntoProduct struct {
+	Name     string   `json:"Product Name"`
+	ID       int      `json:"ProductID"`
+	Price    float64  `json:"Price"`
+	Quantity uint8    `json:"Quantity"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+type evalIntoOrder struct {
+	OrderID  string
+	Products []evalIntoProduct `json:"Product"`
+	Total    *float64
+}
+
+func TestEvalInto(t *testing.T) {
+
+	total := func(f float64) *float64 {
+		return &f
+	}
+
+	account := testdata.account.(map[string]interface{})["Account"]
+
+	runTestCases(t, testdata.account, []*testCase{
+		{
+			Expression: `Account.Order[0].Product[0]`,
+			Into:       func() interface{} { return new(evalIntoProduct) },
+			Output: &evalIntoProduct{
+				Name:     "Bowler Hat",
+				ID:       858383,
+				Price:    34.45,
+				Quantity: 2,
+			},
+		},
+		{
+			Expression: `Account.Order.{"OrderID": OrderID, "Product": Product, "Total": $sum(Product.(Price * Quantity))}`,
+			Into:       func() interface{} { return new([]evalIntoOrder) },
+			Output: &[]evalIntoOrder{
+				{
+					OrderID: "order103",
+					Products: []evalIntoProduct{
+						{
+							Name:     "Bowler Hat",
+							ID:       858383,
+							Price:    34.45,
+							Quantity: 2,
+						},
+						{
+							Name:     "Trilby hat",
+							ID:       858236,
+							Price:    21.67,
+							Quantity: 1,
+						},
+					},
+					Total: total(90.57000000000001),
+				},
+				{
+					OrderID: "order104",
+					Products: []evalIntoProduct{
+						{
+							Name:     "Bowler Hat",
+							ID:       858383,
+							Price:    34.45,
+							Quantity: 4,
+						},
+						{
+							Name:     "Cloak",
+							ID:       345664,
+							Price:    107.99,
+							Quantity: 1,
+						},
+					},
+					Total: total(245.79000000000002),
+				},
+			},
+		},
+		{
+			Expression: `Account.Order.Product.Quantity`,
+			Into:       func() interface{} { return new([]int) },
+			Output:     &[]int{2, 1, 4, 1},
+		},
+		{
+			Expression: `Account.Order.Product.Quantity`,
+			Into:       func() interface{} { return new([2]int) },
+			Output:     &[2]int{2, 1},
+		},
+		{
+			Expression: `Account.Order.Product{$string(ProductID): $sum(Price)}`,
+			Into:       func() interface{} { return new(map[int]float64) },
+			Output: &map[int]float64{
+				858383: 68.9,
+				858236: 21.67,
+				345664: 107.99,
+			},
+		},
+		{
+			Expression: `Account.Order.Product{"Product Name": ProductID}`,
+			Into:       func() interface{} { return new(map[string]interface{}) },
+			Output: &map[string]interface{}{
+				"Product Name": []interface{}{
+					float64(858383),
+					float64(858236),
+					float64(858383),
+					float64(345664),
+				},
+			},
+		},
+		{
+			Expression: `Account`,
+			Into:       func() interface{} { return new(interface{}) },
+			Output:     &account,
+		},
+		{
+			Expression: `$string(Account.Order[0].Product[0].Price)`,
+			Into:       func() interface{} { return new(json.Number) },
+			Output:     func() *json.Number { n := json.Number("34.45"); return &n }(),
+		},
+		{
+			Expression: `null`,
+			Into:       func() interface{} { p := 1.0; q := &p; return &q },
+			Output:     new(*float64),
+		},
+		{
+			Expression: `"2019-02-03T04:05:06Z"`,
+			Into:       func() interface{} { return new(time.Time) },
+			Output:     func() *time.Time { t := time.Date(2019, time.February, 3, 4, 5, 6, 0, time.UTC); return &t }(),
+		},
+	})
+}
+
+func TestEvalIntoErrors(t *testing.T) {
+
+	var s string
+
+	err := MustCompile(`Account.Missing`).EvalInto(testdata.account, &s)
+	if err != ErrUndefined {
+		t.Errorf("expected error %v, got %v", ErrUndefined, err)
+	}
+
+	err = MustCompile(`Account`).EvalInto(testdata.account, s)
+	if exp := "json: Unmarshal(non-pointer string)"; err == nil || err.Error() != exp {
+		t.Errorf("expected error %q, got %v", exp, err)
+	}
+
+	tests := []struct {
+		Expression string
+		Out        interface{}
+		Error      string
+	}{
+		{
+			Expression: `Account`,
+			Out:        &s,
+			Error:      "json: cannot unmarshal object into Go value of type string",
+		},
+		{
+			Expression: `Account.Order[0].Product.{"ProductID": Price}`,
+			Out:        &[]evalIntoProduct{},
+			Error:      "json: cannot unmarshal number 34.45 into Go struct field evalIntoProduct.ProductID of type int",
+		},
+		{
+			Expression: `Account.Order[0].{"OrderID": OrderID, "Product": [{"Quantity": -1}]}`,
+			Out:        &evalIntoOrder{},
+			Error:      "json: cannot unmarshal number -1 into Go struct field evalIntoProduct.Product.Quantity of type uint8",
+		},
+		{
+			Expression: `{"a": $uppercase}`,
+			Out:        &map[string]string{},
+			Error:      "json: cannot unmarshal function into Go value of type string",
+		},
+		{
+			Expression: `Account.Order.Product.Price`,
+			Out:        &[]string{},
+			Error:      "json: cannot unmarshal number into Go value of type string",
+		},
+		{
+			Expression: `{"Quantity": -1, "Product Name": "x"}`,
+			Out:        &evalIntoProduct{},
+			Error:      "json: cannot unmarshal number -1 into Go struct field evalIntoProduct.Quantity of type uint8",
+		},
+	}
+
+	for _, test := range tests {
+
+		err := MustCompile(test.Expression).EvalInto(testdata.account, test.Out)
+		if err == nil || err.Error() != test.Error {
+			t.Errorf("%s: expected error %q, got %v", test.Expression, test.Error, err)
+		}
+	}
+}
+
+func TestUseNumber(t *testing.T) {
+
+	data := []byte(`{
+		"id": 1234567890123456789,
+		"n": 9007199254740993,
+		"price": 1.5
+	}`)
+
+	runTestCases(t, data, []*testCase{
+		{
+			Expression: `id`,
+			Options:    EvalOptions{UseNumber: true},
+			Output:     `1234567890123456789`,
+		},
+		{
+			// Without UseNumber, the id is rounded to the
+			// nearest float64.
+			Expression: `id`,
+			Output:     `1234567890123456800`,
+		},
+		{
+			Expression: `{"id": id, "next": id + 1, "prev": id - 1}`,
+			Options:    EvalOptions{UseNumber: true},
+			Output:     `{"id":1234567890123456789,"next":1234567890123456790,"prev":1234567890123456788}`,
+		},
+		{
+			Expression: `[-id, id % 1000, n * 2]`,
+			Options:    EvalOptions{UseNumber: true},
+			Output:     `[-1234567890123456789,789,18014398509481986]`,
+		},
+		{
+			// Results that overflow an int64 fall back
+			// to floating point.
+			Expression: `id * 10`,
+			Options:    EvalOptions{UseNumber: true},
+			Output:     `12345678901234567000`,
+		},
+		{
+			Expression: `[id / 2, price * 2]`,
+			Options:    EvalOptions{UseNumber: true},
+			Output:     `[617283945061728400,3]`,
+		},
+		{
+			Expression: `[n = 9007199254740992, n > 9007199254740992, id + 1 > id, id = id]`,
+			Options:    EvalOptions{UseNumber: true},
+			Output:     `[false,true,true,true]`,
+		},
+		{
+			Expression: `[n = 9007199254740992, n > 9007199254740992]`,
+			Output:     `[true,false]`,
+		},
+		{
+			Expression: `[$string(id), $type(id), $substring("abcdef", n - 9007199254740991)]`,
+			Options:    EvalOptions{UseNumber: true},
+			Output:     `["1234567890123456789","number","cdef"]`,
+		},
+	})
+
+	id := int64(1234567890123456789)
+
+	runTestCases(t, map[string]interface{}{
+		"id": json.Number("1234567890123456789"),
+	}, []*testCase{
+		{
+			Expression: `id`,
+			Into:       func() interface{} { return new(int64) },
+			Output:     &id,
+		},
+	})
+}
+
+func TestEvalDecimal(t *testing.T) {
+
+	data := map[string]interface{}{
+		"Order": map[string]interface{}{
+			"Product": []interface{}{
+				map[string]interface{}{"Price": 34.45, "Quantity": 2.0},
+				map[string]interface{}{"Price": 21.67, "Quantity": 1.0},
+				map[string]interface{}{"Price": 34.45, "Quantity": 4.0},
+				map[string]interface{}{"Price": 107.99, "Quantity": 1.0},
+			},
+		},
+	}
+
+	runTestCases(t, data, []*testCase{
+		{
+			Expression: `$sum([0.1, 0.2])`,
+			Output:     0.30000000000000004,
+		},
+		{
+			Expression: `$sum([0.1, 0.2])`,
+			Options:    EvalOptions{Decimal: true},
+			Output:     0.3,
+		},
+		{
+			Expression: `$sum(Order.Product.(Price*Quantity))`,
+			Options:    EvalOptions{Decimal: true},
+			Output:     336.36,
+		},
+		{
+			Expression: `{"total": $sum(Order.Product.(Price*Quantity)), "items": Order.Product.(Price*Quantity)}`,
+			Options:    EvalOptions{Decimal: true},
+			Output: map[string]interface{}{
+				"total": 336.36,
+				"items": []interface{}{68.9, 21.67, 137.8, 107.99},
+			},
+		},
+		{
+			Expression: `[0.1 + 0.2, -(0.1 + 0.2), 0.3 - 0.1, 1.1 * 1.1]`,
+			Options:    EvalOptions{Decimal: true},
+			Output:     []interface{}{0.3, -0.3, 0.2, 1.21},
+		},
+		{
+			Expression: `[0.1 + 0.2 = 0.3, 0.1 + 0.2 > 0.3, 1 / 3 * 3 = 1]`,
+			Options:    EvalOptions{Decimal: true},
+			Output:     []interface{}{true, false, true},
+		},
+		{
+			Expression: `[7 % 3, -7 % 3, 7.5 % 2]`,
+			Options:    EvalOptions{Decimal: true},
+			Output:     []interface{}{1.0, -1.0, 1.5},
+		},
+		{
+			Expression: `[$average([0.1, 0.2, 0.3]), $round(2.675, 2), $round(0.1 + 0.2, 1)]`,
+			Options:    EvalOptions{Decimal: true},
+			Output:     []interface{}{0.2, 2.68, 0.3},
+		},
+		{
+			Expression: `$formatNumber(0.1 + 0.2, "0.00000000000000000")`,
+			Output:     "0.30000000000000004",
+		},
+		{
+			Expression: `$formatNumber(0.1 + 0.2, "0.00000000000000000")`,
+			Options:    EvalOptions{Decimal: true},
+			Output:     "0.30000000000000000",
+		},
+		{
+			Expression: `[$string(0.1 + 0.2), $type(0.1 + 0.2), $abs(-0.5 * 3)]`,
+			Options:    EvalOptions{Decimal: true},
+			Output:     []interface{}{"0.3", "number", 1.5},
+		},
+		{
+			Expression: `[$string({"a": 1.1 * 2}), $string([0.1 + 0.2]), $string({"a": [{"b": 0.1 + 0.2}]})]`,
+			Options:    EvalOptions{Decimal: true},
+			Output:     []interface{}{`{"a":2.2}`, `[0.3]`, `{"a":[{"b":0.3}]}`},
+		},
+		{
+			Expression: `$distinct([0.1 + 0.2, 0.3, 0.2 + 0.1, 1])`,
+			Options:    EvalOptions{Decimal: true},
+			Output:     []interface{}{0.3, 1.0},
+		},
+		{
+			Expression: `1 / 0`,
+			Options:    EvalOptions{Decimal: true},
+			Error:      newEvalError(ErrNumberInf, nil, jparse.NumericDivide),
+		},
+	})
+}
+
+func TestEvalDecimalInput(t *testing.T) {
+
+	newInput := func() map[string]interface{} {
+		return map[string]interface{}{
+			"price": big.NewRat(1, 10),
+			"items": []interface{}{
+				big.NewRat(1, 5),
+				map[string]interface{}{
+					"qty": big.NewRat(3, 1),
+				},
+			},
+			"codes": []*big.Rat{
+				big.NewRat(1, 2),
+			},
+		}
+	}
+
+	input := newInput()
+
+	exp := map[string]interface{}{
+		"price": 0.1,
+		"items": []interface{}{
+			0.2,
+			map[string]interface{}{
+				"qty": 3.0,
+			},
+		},
+		"codes": []interface{}{
+			0.5,
+		},
+	}
+
+	e := MustCompile("$")
+
+	// Evaluations that return their input must not modify it,
+	// even when they run concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			output, err := e.EvalWithOptions(context.Background(), input, EvalOptions{
+				Decimal: true,
+			})
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+				return
+			}
+			if !reflect.DeepEqual(output, exp) {
+				t.Errorf("expected output %v, got %v", exp, output)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !reflect.DeepEqual(input, newInput()) {
+		t.Errorf("input was modified: %v", input)
+	}
+}
+
+type traceEvent struct {
+	Enter  bool
+	Node   string
+	Output interface{}
+	Err    error
+}
+
+// recordingTracer is a Tracer that records the nodes that are
+// entered and exited, and the results of the exited nodes.
+type recordingTracer struct {
+	events []traceEvent
+	depth  int
+}
+
+func (t *recordingTracer) Enter(node jparse.Node, input reflect.Value) {
+	t.events = append(t.events, traceEvent{
+		Enter: true,
+		Node:  node.String(),
+	})
+	t.depth++
+}
+
+func (t *recordingTracer) Exit(node jparse.Node, input reflect.Value, output reflect.Value, err error) {
+	e := traceEvent{
+		Node: node.String(),
+		Err:  err,
+	}
+	if output.IsValid() {
+		e.Output = output.Interface()
+	}
+	t.events = append(t.events, e)
+	t.depth--
+}
+
+func TestTracer(t *testing.T) {
+
+	data := map[string]interface{}{
+		"Account": map[string]interface{}{
+			"Order": []interface{}{
+				map[string]interface{}{"OrderID": "order1"},
+				map[string]interface{}{"OrderID": "order2"},
+			},
+		},
+	}
+
+	tracer := &recordingTracer{}
+
+	runTestCases(t, data, []*testCase{
+		{
+			Expression: `Account.Order.Product`,
+			Options:    EvalOptions{Tracer: tracer},
+			Error:      ErrUndefined,
+		},
+	})
+
+	if tracer.depth != 0 {
+		t.Errorf("expected balanced Enter/Exit calls, got depth %d", tracer.depth)
+	}
+
+	// The Account and Order steps produce results but the
+	// Product step is undefined for both orders.
+	results := map[string][]interface{}{}
+	for _, e := range tracer.events {
+		if !e.Enter {
+			results[e.Node] = append(results[e.Node], e.Output)
+		}
+	}
+
+	exp := map[string][]interface{}{
+		"Account":               {data["Account"]},
+		"Order":                 {data["Account"].(map[string]interface{})["Order"]},
+		"Product":               {nil, nil},
+		"Account.Order.Product": {nil},
+	}
+
+	if !reflect.DeepEqual(results, exp) {
+		t.Errorf("expected results %v, got %v", exp, results)
+	}
+
+	// Recursive calls are nested, even in tail position.
+	tracer = &recordingTracer{}
+
+	runTestCases(t, nil, []*testCase{
+		{
+			Expression: `($f := function($n) { $n > 0 ? $f($n - 1) : "done" }; $f(3))`,
+			Options:    EvalOptions{Tracer: tracer},
+			Output:     "done",
+		},
+	})
+	if tracer.depth != 0 {
+		t.Errorf("expected balanced Enter/Exit calls, got depth %d", tracer.depth)
+	}
+
+	calls := 0
+	for _, e := range tracer.events {
+		if !e.Enter && e.Node == "$f($n - 1)" {
+			calls++
+			if e.Output != "done" {
+				t.Errorf("expected %s to exit with output %q, got %v", e.Node, "done", e.Output)
+			}
+		}
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 recursive calls, got %d", calls)
+	}
+
+	// Errors are passed to Exit.
+	tracer = &recordingTracer{}
+
+	expErr := &EvalError{
+		Type:  ErrNonNumberRHS,
+		Token: `"a"`,
+		Value: "+",
+	}
+
+	runTestCases(t, nil, []*testCase{
+		{
+			Expression: `1 + "a"`,
+			Options:    EvalOptions{Tracer: tracer},
+			Error:      expErr,
+		},
+	})
+
+	last := tracer.events[len(tracer.events)-1]
+	if last.Node != `1 + "a"` || !reflect.DeepEqual(clearLocation(last.Err), expErr) {
+		t.Errorf("expected %s to exit with error %v, got %v", `1 + "a"`, expErr, last.Err)
+	}
+}
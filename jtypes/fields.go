@@ -0,0 +1,315 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jtypes
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// A StructField describes a field of a Go struct as it appears
+// in JSON. The set of fields and their names follow the rules
+// used by the encoding/json package:
+//
+//   - Unexported fields are ignored.
+//   - Fields with the tag `json:"-"` are ignored.
+//   - A field's name is taken from its json tag, if present.
+//     Otherwise it is the Go field name.
+//   - Fields of embedded structs are promoted to the parent
+//     struct, unless the embedded struct has a json tag name.
+//   - If several fields have the same name, the shallowest
+//     one wins. If that is ambiguous, a tagged field beats
+//     an untagged field. If that is still ambiguous, all of
+//     the fields are ignored.
+type StructField struct {
+	Name      string
+	Index     []int
+	OmitEmpty bool
+	tagged    bool
+}
+
+// Value returns the value of the field f in the struct v.
+// It returns an invalid value if the field is inside a nil
+// embedded pointer, or if the field has the omitempty option
+// and its value is empty. In both cases the field would not
+// appear in the JSON encoding of v.
+func (f StructField) Value(v reflect.Value) reflect.Value {
+
+	for i, x := range f.Index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	if f.OmitEmpty && isEmptyValue(v) {
+		return reflect.Value{}
+	}
+
+	return v
+}
+
+type structFields struct {
+	list   []StructField
+	byName map[string]int
+}
+
+var fieldCache sync.Map // map[reflect.Type]*structFields
+
+// StructFields returns the fields of the struct type t in the
+// order that encoding/json would encode them. The results are
+// cached, so callers must not modify the returned slice.
+func StructFields(t reflect.Type) []StructField {
+	return cachedFields(t).list
+}
+
+// FieldByName returns the value of the field with the given
+// JSON name in the struct v. It returns an invalid value if
+// there is no such field, or if the field would not appear
+// in the JSON encoding of v (see StructField.Value).
+func FieldByName(v reflect.Value, name string) reflect.Value {
+
+	fields := cachedFields(v.Type())
+
+	i, ok := fields.byName[name]
+	if !ok {
+		return reflect.Value{}
+	}
+
+	return fields.list[i].Value(v)
+}
+
+func cachedFields(t reflect.Type) *structFields {
+
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(*structFields)
+	}
+
+	list := typeFields(t)
+	fields := &structFields{
+		list:   list,
+		byName: make(map[string]int, len(list)),
+	}
+
+	for i, f := range list {
+		fields.byName[f.Name] = i
+	}
+
+	f, _ := fieldCache.LoadOrStore(t, fields)
+	return f.(*structFields)
+}
+
+// typeFields returns the JSON fields of the struct type t. It
+// is based on the function of the same name in encoding/json.
+func typeFields(t reflect.Type) []StructField {
+
+	type entry struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	var fields []StructField
+
+	// Walk the embedded structs breadth first, so that
+	// shallower fields are found before deeper ones.
+	current := []entry{}
+	next := []entry{{typ: t}}
+
+	visited := map[reflect.Type]bool{}
+
+	for len(next) > 0 {
+		current, next = next, current[:0]
+
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+
+				sf := e.typ.Field(i)
+
+				if sf.Anonymous {
+					ft := sf.Type
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						// Ignore embedded fields of unexported
+						// non-struct types.
+						continue
+					}
+					// Do not ignore embedded fields of
+					// unexported struct types since they
+					// may have exported fields.
+				} else if !sf.IsExported() {
+					// Ignore unexported non-embedded fields.
+					continue
+				}
+
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+
+				name, opts, _ := strings.Cut(tag, ",")
+				if !isValidTag(name) {
+					name = ""
+				}
+
+				index := make([]int, len(e.index)+1)
+				copy(index, e.index)
+				index[len(e.index)] = i
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+
+				// Promote the fields of embedded structs
+				// that do not have a tag name.
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, entry{
+						typ:   ft,
+						index: index,
+					})
+					continue
+				}
+
+				f := StructField{
+					Name:      name,
+					Index:     index,
+					OmitEmpty: hasOption(opts, "omitempty"),
+					tagged:    name != "",
+				}
+				if f.Name == "" {
+					f.Name = sf.Name
+				}
+
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	// Sort by name, breaking ties with depth, then whether
+	// the field is tagged, then index sequence. This puts the
+	// dominant field first in each group of names.
+	sort.Slice(fields, func(i, j int) bool {
+		x := fields
+		if x[i].Name != x[j].Name {
+			return x[i].Name < x[j].Name
+		}
+		if len(x[i].Index) != len(x[j].Index) {
+			return len(x[i].Index) < len(x[j].Index)
+		}
+		if x[i].tagged != x[j].tagged {
+			return x[i].tagged
+		}
+		return lessIndex(x[i].Index, x[j].Index)
+	})
+
+	// Remove hidden fields and ambiguous fields.
+	out := fields[:0]
+	for advance, i := 0, 0; i < len(fields); i += advance {
+
+		fi := fields[i]
+		for advance = 1; i+advance < len(fields); advance++ {
+			if fields[i+advance].Name != fi.Name {
+				break
+			}
+		}
+
+		if advance == 1 {
+			out = append(out, fi)
+			continue
+		}
+
+		if dominant, ok := dominantField(fields[i : i+advance]); ok {
+			out = append(out, dominant)
+		}
+	}
+
+	fields = out
+
+	// Restore the struct order.
+	sort.Slice(fields, func(i, j int) bool {
+		return lessIndex(fields[i].Index, fields[j].Index)
+	})
+
+	return fields
+}
+
+// dominantField returns the field that takes precedence over
+// the other fields with the same name. The fields are sorted
+// in order of precedence.
+func dominantField(fields []StructField) (StructField, bool) {
+	if len(fields) > 1 &&
+		len(fields[0].Index) == len(fields[1].Index) &&
+		fields[0].tagged == fields[1].tagged {
+		return StructField{}, false
+	}
+	return fields[0], true
+}
+
+func lessIndex(x, y []int) bool {
+	for k, xk := range x {
+		if k >= len(y) {
+			return false
+		}
+		if xk != y[k] {
+			return xk < y[k]
+		}
+	}
+	return len(x) < len(y)
+}
+
+func hasOption(opts string, name string) bool {
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+			// Backslash and quote chars are reserved, but
+			// otherwise any punctuation chars are allowed
+			// in a tag name.
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			return false
+		}
+	}
+	return true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Ptr:
+		return v.IsZero()
+	}
+	return false
+}
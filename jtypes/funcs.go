@@ -6,7 +6,10 @@
 package jtypes
 
 import (
+	"math"
+	"math/big"
 	"reflect"
+	"strconv"
 )
 
 // Resolve (golint)
@@ -32,12 +35,28 @@ func IsBool(v reflect.Value) bool {
 
 // IsString (golint)
 func IsString(v reflect.Value) bool {
-	return v.Kind() == reflect.String || resolvedKind(v) == reflect.String
+	return (v.Kind() == reflect.String || resolvedKind(v) == reflect.String) && !IsJSONNumber(v)
 }
 
 // IsNumber (golint)
 func IsNumber(v reflect.Value) bool {
-	return isFloat(v) || isInt(v) || isUint(v)
+	return isFloat(v) || isInt(v) || isUint(v) || IsJSONNumber(v) || IsDecimal(v)
+}
+
+// IsJSONNumber reports whether v is a json.Number. Although
+// json.Number is a string type, it is treated as a number
+// by JSONata.
+func IsJSONNumber(v reflect.Value) bool {
+	v = Resolve(v)
+	return v.IsValid() && v.Type() == typeJSONNumber
+}
+
+// IsDecimal reports whether v is a big.Rat or a pointer to
+// one. Decimal arithmetic produces *big.Rat values, which are
+// treated as numbers by JSONata.
+func IsDecimal(v reflect.Value) bool {
+	v = Resolve(v)
+	return v.IsValid() && v.Type() == typeBigRat
 }
 
 // IsCallable (golint)
@@ -79,7 +98,7 @@ func IsMap(v reflect.Value) bool {
 
 // IsStruct (golint)
 func IsStruct(v reflect.Value) bool {
-	return resolvedKind(v) == reflect.Struct
+	return resolvedKind(v) == reflect.Struct && !IsDecimal(v)
 }
 
 // AsBool (golint)
@@ -115,11 +134,104 @@ func AsNumber(v reflect.Value) (float64, bool) {
 		return v.Float(), true
 	case isInt(v), isUint(v):
 		return v.Convert(typeFloat64).Float(), true
+	case IsJSONNumber(v):
+		n, err := strconv.ParseFloat(v.String(), 64)
+		return n, err == nil
+	case IsDecimal(v):
+		n, _ := asRat(v).Float64()
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// AsDecimal returns the value of v as an exact rational
+// number. Floating point numbers are converted from their
+// shortest decimal representation, so 0.1 becomes exactly
+// 1/10 rather than the nearest binary fraction. The returned
+// value may be shared with v and must not be modified.
+func AsDecimal(v reflect.Value) (*big.Rat, bool) {
+	v = Resolve(v)
+
+	switch {
+	case IsDecimal(v):
+		return asRat(v), true
+	case isInt(v):
+		return new(big.Rat).SetInt64(v.Int()), true
+	case isUint(v):
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v.Uint())), true
+	case isFloat(v):
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	case IsJSONNumber(v):
+		return new(big.Rat).SetString(v.String())
+	default:
+		return nil, false
+	}
+}
+
+// asRat returns a pointer to the big.Rat held by v, which
+// must already be resolved.
+func asRat(v reflect.Value) *big.Rat {
+	if v.CanAddr() {
+		return v.Addr().Interface().(*big.Rat)
+	}
+	r := v.Interface().(big.Rat)
+	return &r
+}
+
+// maxExactInt is the largest integer that a float64 can
+// represent exactly (2^53).
+const maxExactInt = 1 << 53
+
+// AsInteger returns the value of v as an int64 if v is a
+// number with an integer value that can be represented
+// exactly. For json.Number and Go integer types this covers
+// the full range of an int64. For floating point numbers,
+// the range is limited to +/-2^53.
+func AsInteger(v reflect.Value) (int64, bool) {
+	v = Resolve(v)
+
+	switch {
+	case isInt(v):
+		return v.Int(), true
+	case isUint(v):
+		n := v.Uint()
+		return int64(n), n <= math.MaxInt64
+	case isFloat(v):
+		return floatToInteger(v.Float())
+	case IsJSONNumber(v):
+		if n, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return n, true
+		}
+		// The number may be written with a fraction
+		// or an exponent, e.g. 1.0 or 1e3.
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return 0, false
+		}
+		return floatToInteger(f)
+	case IsDecimal(v):
+		r := asRat(v)
+		if !r.IsInt() || !r.Num().IsInt64() {
+			return 0, false
+		}
+		return r.Num().Int64(), true
 	default:
 		return 0, false
 	}
 }
 
+func floatToInteger(f float64) (int64, bool) {
+	if f != math.Trunc(f) || math.Abs(f) > maxExactInt {
+		return 0, false
+	}
+	return int64(f), true
+}
+
 // AsCallable (golint)
 func AsCallable(v reflect.Value) (Callable, bool) {
 	v = Resolve(v)
@@ -135,6 +247,45 @@ func AsCallable(v reflect.Value) (Callable, bool) {
 	return nil, false
 }
 
+// AsInterfaceSlice returns the []interface{} held by v, if any.
+// JSON arrays decoded by encoding/json have this type, and
+// accessing them directly is much faster than going through
+// reflection.
+func AsInterfaceSlice(v reflect.Value) ([]interface{}, bool) {
+	v = Resolve(v)
+
+	if v.IsValid() && v.Type() == typeInterfaceSlice && v.CanInterface() {
+		return v.Interface().([]interface{}), true
+	}
+
+	return nil, false
+}
+
+// AsInterfaceMap returns the map[string]interface{} held by v,
+// if any. JSON objects decoded by encoding/json have this type,
+// as do the objects created by JSONata expressions.
+func AsInterfaceMap(v reflect.Value) (map[string]interface{}, bool) {
+	v = Resolve(v)
+
+	if v.IsValid() && v.Type() == typeInterfaceMap && v.CanInterface() {
+		return v.Interface().(map[string]interface{}), true
+	}
+
+	return nil, false
+}
+
+// ValueOf returns a reflect.Value for an element of a
+// []interface{} or a map[string]interface{}. It is like
+// reflect.ValueOf except that, for nil, it returns a valid
+// Value that represents null rather than an invalid Value
+// (which represents undefined).
+func ValueOf(x interface{}) reflect.Value {
+	if x == nil {
+		return reflect.ValueOf(&x).Elem()
+	}
+	return reflect.ValueOf(x)
+}
+
 func isInt(v reflect.Value) bool {
 	return isIntKind(v.Kind()) || isIntKind(resolvedKind(v))
 }
@@ -177,3 +328,89 @@ func isFloatKind(k reflect.Kind) bool {
 func resolvedKind(v reflect.Value) reflect.Kind {
 	return Resolve(v).Kind()
 }
+
+// ConvertDecimals returns a copy of v in which decimals are
+// replaced by float64s. Arrays, slices and maps are searched
+// recursively. A container is copied only if it holds decimals,
+// directly or indirectly, and v itself is never modified. The
+// boolean return value is false if v does not contain any
+// decimals, in which case v is returned unchanged.
+func ConvertDecimals(v reflect.Value) (reflect.Value, bool) {
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		return ConvertDecimals(v.Elem())
+
+	case reflect.Ptr, reflect.Struct:
+		if IsDecimal(v) {
+			f, _ := asRat(Resolve(v)).Float64()
+			return reflect.ValueOf(f), true
+		}
+
+	case reflect.Slice, reflect.Array:
+		n := v.Len()
+		items := make([]reflect.Value, n)
+		var changed []reflect.Value
+		for i := 0; i < n; i++ {
+			item, ok := ConvertDecimals(v.Index(i))
+			if ok {
+				changed = append(changed, item)
+			} else {
+				item = v.Index(i)
+			}
+			items[i] = item
+		}
+		if len(changed) == 0 {
+			return v, false
+		}
+
+		elemType := decimalsElemType(v.Type().Elem(), changed)
+		res := reflect.MakeSlice(reflect.SliceOf(elemType), n, n)
+		for i, item := range items {
+			res.Index(i).Set(item)
+		}
+		return res, true
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		items := make([]reflect.Value, len(keys))
+		var changed []reflect.Value
+		for i, key := range keys {
+			item, ok := ConvertDecimals(v.MapIndex(key))
+			if ok {
+				changed = append(changed, item)
+			} else {
+				item = v.MapIndex(key)
+			}
+			items[i] = item
+		}
+		if len(changed) == 0 {
+			return v, false
+		}
+
+		elemType := decimalsElemType(v.Type().Elem(), changed)
+		res := reflect.MakeMapWithSize(reflect.MapOf(v.Type().Key(), elemType), len(keys))
+		for i, key := range keys {
+			res.SetMapIndex(key, items[i])
+		}
+		return res, true
+	}
+
+	return v, false
+}
+
+// decimalsElemType returns the element type for a copy of a
+// container whose elements have the given type, and some of
+// which have been replaced by the given values. If the values
+// do not fit the original type, the copy holds interface{}s.
+func decimalsElemType(typ reflect.Type, changed []reflect.Value) reflect.Type {
+	for _, v := range changed {
+		if !v.Type().AssignableTo(typ) {
+			return TypeInterface
+		}
+	}
+	return typ
+}
@@ -7,7 +7,9 @@
 package jtypes
 
 import (
+	"encoding/json"
 	"errors"
+	"math/big"
 	"reflect"
 )
 
@@ -19,6 +21,12 @@ var (
 	typeFloat64 = reflect.TypeOf((*float64)(nil)).Elem()
 	typeString  = reflect.TypeOf((*string)(nil)).Elem()
 
+	typeJSONNumber = reflect.TypeOf((*json.Number)(nil)).Elem()
+	typeBigRat     = reflect.TypeOf((*big.Rat)(nil)).Elem()
+
+	typeInterfaceSlice = reflect.SliceOf(TypeInterface)
+	typeInterfaceMap   = reflect.MapOf(typeString, TypeInterface)
+
 	// TypeOptional (golint)
 	TypeOptional = reflect.TypeOf((*Optional)(nil)).Elem()
 	// TypeCallable (golint)
@@ -0,0 +1,505 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/stepzen-dev/jsonata-go/jlib"
+	"github.com/stepzen-dev/jsonata-go/jparse"
+	"github.com/stepzen-dev/jsonata-go/jtypes"
+)
+
+// DefaultParallelThreshold is the minimum number of items in
+// an array for it to be processed in parallel, if no other
+// value is set in EvalOptions.
+const DefaultParallelThreshold = 1000
+
+// parallelism returns the number of goroutines to use to
+// process an array with n items, or zero if the array should
+// be processed sequentially. It is safe to call on a nil
+// evalState.
+func (s *evalState) parallelism(n int) int {
+	if s == nil || s.opts.Parallelism < 2 {
+		return 0
+	}
+
+	if s.opts.Tracer != nil || s.opts.Profiler != nil {
+		return 0
+	}
+
+	threshold := s.opts.ParallelThreshold
+	if threshold <= 0 {
+		threshold = DefaultParallelThreshold
+	}
+
+	if n < threshold {
+		return 0
+	}
+
+	if n < s.opts.Parallelism {
+		return n
+	}
+	return s.opts.Parallelism
+}
+
+// beginParallel marks the start of the parallel processing
+// of an array. Only one array is processed in parallel at a
+// time. Arrays nested inside it are processed sequentially
+// by its goroutines. If beginParallel returns true, the
+// caller must call endParallel when it is done.
+func (s *evalState) beginParallel() bool {
+	return s.parallel.CompareAndSwap(false, true)
+}
+
+// endParallel marks the end of the parallel processing of
+// an array.
+func (s *evalState) endParallel() {
+	s.parallel.Store(false)
+}
+
+// parallelWorkers returns the number of goroutines to use to
+// evaluate node against each of n items, or zero if the items
+// should be processed sequentially. If parallelWorkers returns
+// a positive number, the caller must call endParallel when it
+// is done.
+func parallelWorkers(node jparse.Node, n int, env *environment) int {
+
+	if env == nil {
+		return 0
+	}
+
+	workers := env.state.parallelism(n)
+	if workers == 0 || !isParallelSafe(node, env) || !env.state.beginParallel() {
+		return 0
+	}
+
+	return workers
+}
+
+// parallelFor calls fn for every index from 0 to n-1 using
+// the given number of goroutines. If a call fails, no more
+// calls are started and the error from the call with the
+// lowest index is returned, so the error is the same as it
+// would be if the calls were made in order.
+func parallelFor(state *evalState, n, workers int, fn func(int) error) error {
+
+	var (
+		next     atomic.Int64
+		stop     atomic.Bool
+		mu       sync.Mutex
+		errIndex = n
+		err      error
+		panicked interface{}
+		wg       sync.WaitGroup
+	)
+
+	fail := func(i int, e error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if i < errIndex {
+			errIndex, err = i, e
+		}
+		stop.Store(true)
+	}
+
+	work := func() {
+		defer wg.Done()
+
+		// Re-raise panics on the calling goroutine rather
+		// than crashing the program.
+		defer func() {
+			if r := recover(); r != nil {
+				mu.Lock()
+				panicked = r
+				mu.Unlock()
+				stop.Store(true)
+			}
+		}()
+
+		for !stop.Load() {
+			i := int(next.Add(1) - 1)
+			if i >= n {
+				return
+			}
+			if e := state.checkCancel(); e != nil {
+				fail(i, e)
+				return
+			}
+			if e := fn(i); e != nil {
+				fail(i, e)
+				return
+			}
+		}
+	}
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go work()
+	}
+	wg.Wait()
+
+	if panicked != nil {
+		panic(panicked)
+	}
+
+	return err
+}
+
+// evalParallel evaluates node against the n items returned by
+// item, using the given number of goroutines. Like
+// evalOverArray, it returns the results in order, leaving
+// out undefined results.
+func evalParallel(node jparse.Node, n, workers int, item func(int) reflect.Value, env *environment) ([]reflect.Value, error) {
+
+	results := make([]reflect.Value, n)
+
+	err := parallelFor(env.state, n, workers, func(i int) error {
+		res, err := eval(node, item(i), env)
+		results[i] = res
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return compactValues(results), nil
+}
+
+// compactValues removes the invalid values from vs. It returns
+// nil if there are no valid values.
+func compactValues(vs []reflect.Value) []reflect.Value {
+
+	out := vs[:0]
+	for _, v := range vs {
+		if v.IsValid() {
+			out = append(out, v)
+		}
+	}
+
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// parallelCallables returns versions of the $map and $filter
+// functions that call their function argument in parallel
+// for large arrays.
+func parallelCallables(state *evalState) map[string]reflect.Value {
+
+	mapExt := standardFunctions["map"]
+	mapExt.Func = func(ctx context.Context, v reflect.Value, f jtypes.Callable) (interface{}, error) {
+		return parallelMap(ctx, state, v, f)
+	}
+
+	filterExt := standardFunctions["filter"]
+	filterExt.Func = func(ctx context.Context, v reflect.Value, f jtypes.Callable) (interface{}, error) {
+		return parallelFilter(ctx, state, v, f)
+	}
+
+	return map[string]reflect.Value{
+		"map":    reflect.ValueOf(mustGoCallable("map", mapExt)),
+		"filter": reflect.ValueOf(mustGoCallable("filter", filterExt)),
+	}
+}
+
+func parallelMap(ctx context.Context, state *evalState, v reflect.Value, f jtypes.Callable) (interface{}, error) {
+
+	arr, workers := parallelArgs(state, v, f)
+	if workers == 0 {
+		return jlib.MapContext(ctx, v, f)
+	}
+	defer state.endParallel()
+
+	n := arr.Len()
+	results := make([]reflect.Value, n)
+	argc := clampInt(f.ParamCount(), 1, 3)
+
+	err := parallelFor(state, n, workers, func(i int) error {
+		argv := []reflect.Value{arr.Index(i), reflect.ValueOf(i), arr}
+		res, err := f.Call(argv[:argc])
+		if res.IsValid() && res.CanInterface() {
+			results[i] = res
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return interfaces(compactValues(results)), nil
+}
+
+func parallelFilter(ctx context.Context, state *evalState, v reflect.Value, f jtypes.Callable) (interface{}, error) {
+
+	arr, workers := parallelArgs(state, v, f)
+	if workers == 0 {
+		return jlib.FilterContext(ctx, v, f)
+	}
+	defer state.endParallel()
+
+	n := arr.Len()
+	results := make([]reflect.Value, n)
+	argc := clampInt(f.ParamCount(), 1, 3)
+
+	err := parallelFor(state, n, workers, func(i int) error {
+		item := arr.Index(i)
+		argv := []reflect.Value{item, reflect.ValueOf(i), arr}
+		res, err := f.Call(argv[:argc])
+		if jlib.Boolean(res) && item.IsValid() && item.CanInterface() {
+			results[i] = item
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return interfaces(compactValues(results)), nil
+}
+
+// parallelArgs returns the array argument of $map or $filter
+// and the number of goroutines to process it with, or zero if
+// the function f should be called sequentially. If the number
+// of goroutines is positive, the caller must call endParallel
+// when it is done.
+func parallelArgs(state *evalState, v reflect.Value, f jtypes.Callable) (reflect.Value, int) {
+
+	if !jtypes.IsArray(v) {
+		return v, 0
+	}
+
+	v = jtypes.Resolve(v)
+
+	workers := state.parallelism(v.Len())
+	if workers == 0 || !isParallelSafeCallable(f) || !state.beginParallel() {
+		return v, 0
+	}
+
+	return v, workers
+}
+
+func interfaces(vs []reflect.Value) []interface{} {
+
+	if len(vs) == 0 {
+		return nil
+	}
+
+	results := make([]interface{}, len(vs))
+	for i, v := range vs {
+		results[i] = v.Interface()
+	}
+
+	return results
+}
+
+func clampInt(n, min, max int) int {
+	switch {
+	case n < min:
+		return min
+	case n > max:
+		return max
+	default:
+		return n
+	}
+}
+
+// isParallelSafe reports whether node can be evaluated by
+// several goroutines at once in the environment env.
+func isParallelSafe(node jparse.Node, env *environment) bool {
+	c := parallelChecker{
+		seen: map[jtypes.Callable]bool{},
+	}
+	return c.node(node, env, false)
+}
+
+// isParallelSafeCallable reports whether f can be called by
+// several goroutines at once.
+func isParallelSafeCallable(f jtypes.Callable) bool {
+	c := parallelChecker{
+		seen: map[jtypes.Callable]bool{},
+	}
+	return c.callable(f)
+}
+
+// A parallelChecker looks for the parts of an expression that
+// are not safe to evaluate concurrently: assignments that
+// modify a shared environment and calls to Sequential
+// functions. Functions are checked when they are referenced,
+// so a function that is passed to another function (e.g. to
+// $map) is checked as well as one that is called directly.
+type parallelChecker struct {
+	seen map[jtypes.Callable]bool
+}
+
+// node reports whether node is safe to evaluate concurrently.
+// If scoped is true, node is evaluated in its own environment,
+// so it may assign variables.
+func (c *parallelChecker) node(node jparse.Node, env *environment, scoped bool) bool {
+
+	switch node := node.(type) {
+	case nil:
+		return true
+
+	case *jparse.StringNode, *jparse.NumberNode, *jparse.BooleanNode,
+		*jparse.NullNode, *jparse.RegexNode, *jparse.NameNode,
+		*jparse.WildcardNode, *jparse.DescendentNode, *jparse.ParentNode,
+		*jparse.PlaceholderNode:
+		return true
+
+	case *jparse.VariableNode:
+		// Variables that are not in the environment are
+		// either undefined or assigned within the node,
+		// in which case their values are checked where
+		// they are assigned.
+		v := env.lookup(node.Name)
+		if f, ok := jtypes.AsCallable(v); ok {
+			return c.callable(f)
+		}
+		return true
+
+	case *jparse.AssignmentNode:
+		return scoped && c.node(node.Value, env, scoped)
+
+	case *jparse.BlockNode:
+		// Blocks have their own environments.
+		return c.nodes(node.Exprs, env, true)
+
+	case *jparse.LambdaNode:
+		return c.node(node.Body, env, true)
+	case *jparse.TypedLambdaNode:
+		return c.node(node.Body, env, true)
+
+	case *jparse.PathNode:
+		return c.nodes(node.Steps, env, scoped)
+	case *jparse.NegationNode:
+		return c.node(node.RHS, env, scoped)
+	case *jparse.RangeNode:
+		return c.node(node.LHS, env, scoped) && c.node(node.RHS, env, scoped)
+	case *jparse.ArrayNode:
+		return c.nodes(node.Items, env, scoped)
+	case *jparse.ObjectNode:
+		return c.pairs(node.Pairs, env, scoped)
+	case *jparse.ConditionalNode:
+		return c.node(node.If, env, scoped) &&
+			c.node(node.Then, env, scoped) &&
+			c.node(node.Else, env, scoped)
+	case *jparse.GroupNode:
+		return c.node(node.Expr, env, scoped) && c.pairs(node.Pairs, env, scoped)
+	case *jparse.PredicateNode:
+		return c.node(node.Expr, env, scoped) && c.nodes(node.Filters, env, scoped)
+	case *jparse.FocusNode:
+		return c.node(node.Expr, env, scoped)
+	case *jparse.IndexNode:
+		return c.node(node.Expr, env, scoped)
+	case *jparse.SortNode:
+		if !c.node(node.Expr, env, scoped) {
+			return false
+		}
+		for _, term := range node.Terms {
+			if !c.node(term.Expr, env, scoped) {
+				return false
+			}
+		}
+		return true
+	case *jparse.ObjectTransformationNode:
+		return c.node(node.Pattern, env, scoped) &&
+			c.node(node.Updates, env, scoped) &&
+			c.node(node.Deletes, env, scoped)
+	case *jparse.PartialNode:
+		return c.node(node.Func, env, scoped) && c.nodes(node.Args, env, scoped)
+	case *jparse.FunctionCallNode:
+		return c.node(node.Func, env, scoped) && c.nodes(node.Args, env, scoped)
+	case *jparse.FunctionApplicationNode:
+		return c.node(node.LHS, env, scoped) && c.node(node.RHS, env, scoped)
+	case *jparse.NumericOperatorNode:
+		return c.node(node.LHS, env, scoped) && c.node(node.RHS, env, scoped)
+	case *jparse.ComparisonOperatorNode:
+		return c.node(node.LHS, env, scoped) && c.node(node.RHS, env, scoped)
+	case *jparse.BooleanOperatorNode:
+		return c.node(node.LHS, env, scoped) && c.node(node.RHS, env, scoped)
+	case *jparse.StringConcatenationNode:
+		return c.node(node.LHS, env, scoped) && c.node(node.RHS, env, scoped)
+
+	default:
+		return false
+	}
+}
+
+func (c *parallelChecker) nodes(nodes []jparse.Node, env *environment, scoped bool) bool {
+	for _, node := range nodes {
+		if !c.node(node, env, scoped) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *parallelChecker) pairs(pairs [][2]jparse.Node, env *environment, scoped bool) bool {
+	for _, pair := range pairs {
+		if !c.node(pair[0], env, scoped) || !c.node(pair[1], env, scoped) {
+			return false
+		}
+	}
+	return true
+}
+
+// callable reports whether f is safe to call concurrently.
+// Functions that are not defined by this package are assumed
+// to be unsafe.
+func (c *parallelChecker) callable(f jtypes.Callable) bool {
+
+	switch f := f.(type) {
+	case *goCallable:
+		return !f.sequential
+	case *regexCallable, *matchCallable, *undefinedCallable:
+		return true
+	case *lambdaCallable:
+		return c.check(f, func() bool {
+			return c.node(f.body, f.env, true)
+		})
+	case *partialCallable:
+		return c.check(f, func() bool {
+			return c.callable(f.fn) && c.nodes(f.args, f.env, false)
+		})
+	case *transformationCallable:
+		return c.check(f, func() bool {
+			return c.node(f.pattern, f.env, false) &&
+				c.node(f.updates, f.env, false) &&
+				c.node(f.deletes, f.env, false)
+		})
+	case *chainCallable:
+		return c.check(f, func() bool {
+			for _, fn := range f.callables {
+				if !c.callable(fn) {
+					return false
+				}
+			}
+			return true
+		})
+	default:
+		return false
+	}
+}
+
+// check calls fn to check the function f, unless f has
+// already been checked.
+func (c *parallelChecker) check(f jtypes.Callable, fn func() bool) bool {
+
+	// Assume that a function is safe while it is being
+	// checked, so that recursive functions terminate.
+	if safe, ok := c.seen[f]; ok {
+		return safe
+	}
+	c.seen[f] = true
+
+	safe := fn()
+	c.seen[f] = safe
+	return safe
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stepzen-dev/jsonata-go/jparse"
+)
+
+func TestParallel(t *testing.T) {
+
+	items := make([]interface{}, 5000)
+	for i := range items {
+		items[i] = map[string]interface{}{
+			"id":    float64(i),
+			"price": float64(i % 100),
+		}
+	}
+
+	data := map[string]interface{}{
+		"items": items,
+	}
+
+	exprs := []string{
+		`items.(price * 2)`,
+		`items[price > 50].id`,
+		`items.{"id": id, "even": id % 2 = 0}`,
+		`$map(items, function($v, $i) { $v.price + $i })`,
+		`$filter(items, function($v) { $v.price < 10 }).id`,
+		`$map(items.id, function($id) { ($x := $id * 2; $x + 1) })`,
+		`($t := 0; items.($t := price); $t)`,
+		`$sum($map(items, function($v) { $sum($map([1, 2, 3], function($n) { $n * $v.price })) }))`,
+	}
+
+	for _, exp := range exprs {
+
+		e := MustCompile(exp)
+
+		want, err := e.EvalWithOptions(context.Background(), data, EvalOptions{})
+		if err != nil {
+			t.Fatalf("%s: %s", exp, err)
+		}
+
+		got, err := e.EvalWithOptions(context.Background(), data, EvalOptions{
+			Parallelism:       4,
+			ParallelThreshold: 100,
+		})
+		if err != nil {
+			t.Errorf("%s: %s", exp, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: parallel result does not match sequential result", exp)
+		}
+	}
+}
+
+func TestParallelError(t *testing.T) {
+
+	arr := make([]interface{}, 1000)
+	for i := range arr {
+		arr[i] = float64(i)
+	}
+
+	e := MustCompile(`$map($, function($v) { $v >= 500 ? $error("failed at " & $v) : $v })`)
+
+	// The error is the one that a sequential evaluation
+	// would return, whichever goroutine gets there first.
+	for i := 0; i < 10; i++ {
+		_, err := e.EvalWithOptions(context.Background(), arr, EvalOptions{
+			Parallelism:       8,
+			ParallelThreshold: 10,
+		})
+		if err == nil || clearLocation(err).Error() != "failed at 500" {
+			t.Fatalf("expected error %q, got %v", "failed at 500", err)
+		}
+	}
+}
+
+func TestParallelSequential(t *testing.T) {
+
+	var active, maxActive int32
+
+	e := MustCompile(`$map($, function($v) { $count($v) })`)
+	err := e.RegisterExts(map[string]Extension{
+		"count": {
+			Func: func(v interface{}) int {
+				n := atomic.AddInt32(&active, 1)
+				defer atomic.AddInt32(&active, -1)
+				for {
+					max := atomic.LoadInt32(&maxActive)
+					if n <= max || atomic.CompareAndSwapInt32(&maxActive, max, n) {
+						break
+					}
+				}
+				return 1
+			},
+			Sequential: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arr := make([]interface{}, 1000)
+	for i := range arr {
+		arr[i] = float64(i)
+	}
+
+	res, err := e.EvalWithOptions(context.Background(), arr, EvalOptions{
+		Parallelism:       8,
+		ParallelThreshold: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(res.([]interface{})); n != len(arr) {
+		t.Errorf("expected %d results, got %d", len(arr), n)
+	}
+
+	if maxActive != 1 {
+		t.Errorf("expected Sequential function to be called by one goroutine at a time, got %d", maxActive)
+	}
+}
+
+func TestIsParallelSafe(t *testing.T) {
+
+	env := newEnvironment(nil, 0)
+	env.bind("seq", reflect.ValueOf(mustGoCallable("seq", Extension{
+		Func:       func() int { return 0 },
+		Sequential: true,
+	})))
+	env.bind("par", reflect.ValueOf(mustGoCallable("par", Extension{
+		Func: func() int { return 0 },
+	})))
+
+	tests := []struct {
+		Expression string
+		Safe       bool
+	}{
+		{`a.b.c`, true},
+		{`$par()`, true},
+		{`$seq()`, false},
+		{`[1, 2, $seq]`, false},
+		{`$x := 1`, false},
+		{`($x := 1; $x + 1)`, true},
+		{`function($v) { $x := $v }`, true},
+		{`function($v) { $seq() }`, false},
+		{`($f := function() { $seq() }; $f())`, false},
+		{`($f := $par; $f())`, true},
+	}
+
+	for _, test := range tests {
+
+		node, err := jparse.Parse(test.Expression)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Expression, err)
+		}
+
+		if got := isParallelSafe(node, env); got != test.Safe {
+			t.Errorf("%s: expected %t, got %t", test.Expression, test.Safe, got)
+		}
+	}
+}
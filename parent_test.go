@@ -0,0 +1,168 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"testing"
+
+	"github.com/stepzen-dev/jsonata-go/jparse"
+)
+
+func TestParentOperator(t *testing.T) {
+
+	runTestCases(t, testdata.account, []*testCase{
+		{
+			Expression: "Account.Order.Product.{ 'Product': `Product Name`, 'Order': %.OrderID, 'Account': %.%.`Account Name` }",
+			Output: []interface{}{
+				map[string]interface{}{
+					"Product": "Bowler Hat",
+					"Order":   "order103",
+					"Account": "Firefly",
+				},
+				map[string]interface{}{
+					"Product": "Trilby hat",
+					"Order":   "order103",
+					"Account": "Firefly",
+				},
+				map[string]interface{}{
+					"Product": "Bowler Hat",
+					"Order":   "order104",
+					"Account": "Firefly",
+				},
+				map[string]interface{}{
+					"Product": "Cloak",
+					"Order":   "order104",
+					"Account": "Firefly",
+				},
+			},
+		},
+		{
+			Expression: []string{
+				"Account.Order.Product.(%.OrderID)",
+				"Account.Order.Product.$string(%.OrderID)",
+				"Account.Order.Product.Description.%.%.OrderID",
+				"Account.Order.Product.Price.%.%.OrderID",
+			},
+			Output: []interface{}{
+				"order103",
+				"order103",
+				"order104",
+				"order104",
+			},
+		},
+		{
+			// The parent operator in a predicate refers to the
+			// parent of the items being filtered.
+			Expression: "Account.Order.Product[%.OrderID = 'order104'].SKU",
+			Output: []interface{}{
+				"040657863",
+				"0406654603",
+			},
+		},
+		{
+			Expression: "Account.Order[0].%.`Account Name`",
+			Output:     "Firefly",
+		},
+		{
+			Expression: "Account.Order.Product^(>%.OrderID, Price).SKU",
+			Output: []interface{}{
+				"040657863",
+				"0406654603",
+				"0406634348",
+				"0406654608",
+			},
+		},
+		{
+			Expression: "Account.Order.Product{%.OrderID: $sum(Price)}",
+			Output: map[string]interface{}{
+				"order103": 56.120000000000005,
+				"order104": 142.44,
+			},
+		},
+		{
+			// When the items in a group have different parents,
+			// the parent operator yields all of them.
+			Expression: "Account.Order.Product{`Product Name`: %.OrderID}",
+			Output: map[string]interface{}{
+				"Bowler Hat": []interface{}{
+					"order103",
+					"order104",
+				},
+				"Trilby hat": "order103",
+				"Cloak":      "order104",
+			},
+		},
+		{
+			// In the infix position, % is the modulo operator.
+			Expression: "Account.Order.Product.(Quantity % 3)",
+			Output: []interface{}{
+				float64(2),
+				float64(1),
+				float64(1),
+				float64(1),
+			},
+		},
+		{
+			// The parser rejects uses of the parent operator
+			// whose value cannot be derived from the path.
+			Expression: []string{
+				"%",
+				"%.OrderID",
+			},
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 0,
+			},
+		},
+		{
+			Expression: "Account.%.%",
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 10,
+			},
+		},
+		{
+			Expression: "($x := Account; $x.%)",
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 19,
+			},
+		},
+		{
+			Expression: "$.%",
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 2,
+			},
+		},
+		{
+			Expression: "$map(Account.Order.Product, function($v) { $v.% })",
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 46,
+			},
+		},
+		{
+			Expression: "Account.Order.Product^(Price).%.OrderID",
+			Error: &jparse.Error{
+				Type:     jparse.ErrNoParent,
+				Token:    "%",
+				Position: 30,
+			},
+		},
+		{
+			Expression: "(Account.Order.Product)[%.OrderID = 'order104']",
+			Error: &EvalError{
+				Type:  ErrNoParent,
+				Token: "%",
+			},
+		},
+	})
+}
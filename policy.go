@@ -0,0 +1,230 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/stepzen-dev/jsonata-go/jparse"
+	"github.com/stepzen-dev/jsonata-go/jtypes"
+)
+
+// CompileOptions holds options for CompileWithOptions.
+type CompileOptions struct {
+
+	// Registry holds the custom functions and variables
+	// available to the expression (see CompileWith). If
+	// Registry is nil, the functions and variables registered
+	// at the package level are used, as with Compile.
+	Registry *Registry
+
+	// AllowFunctions, if not nil, lists the only functions
+	// that the expression may use. Names are given without
+	// the leading dollar sign. The list applies to standard
+	// functions and to custom functions in the Registry.
+	AllowFunctions []string
+
+	// DenyFunctions lists functions that the expression may
+	// not use, in the same form as AllowFunctions. A name
+	// that appears in both lists is denied.
+	DenyFunctions []string
+}
+
+// CompileWithOptions is like Compile but takes options that
+// control which functions and variables are available to the
+// expression.
+//
+// If the options restrict the functions that can be used and
+// the expression refers to a forbidden function, whether it
+// calls the function or not, CompileWithOptions returns a
+// *FunctionPolicyError. The check is based on names alone, so
+// a local variable with the same name as a forbidden function
+// is also rejected. The restrictions also apply to expressions
+// evaluated by $eval, which fail at runtime with the same
+// error.
+func CompileWithOptions(expr string, opts CompileOptions) (*Expr, error) {
+
+	r := opts.Registry
+	if r == nil {
+		r = defaultRegistry
+	}
+
+	e, err := CompileWith(expr, r)
+	if err != nil {
+		return nil, err
+	}
+
+	e.forbidden = forbiddenFunctions(e.loadRegistry(), opts.AllowFunctions, opts.DenyFunctions)
+	if err := checkFunctionPolicy(e.node, expr, e.forbidden); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// FunctionPolicyError is returned when an expression refers
+// to a function that is forbidden by CompileOptions.
+type FunctionPolicyError struct {
+	Func string
+
+	// Location is the reference to the function in the
+	// expression, if known.
+	Location *Location
+}
+
+// Code returns the JSONata error code for the error. The
+// code is the same as for an EvalError of type ErrEvalDisabled.
+func (e FunctionPolicyError) Code() string {
+	return goErrcodes[ErrEvalDisabled]
+}
+
+func (e FunctionPolicyError) Error() string {
+	s := fmt.Sprintf("function %q is not allowed", e.Func)
+	return withLocation(s, e.Location)
+}
+
+// forbiddenFunctions returns the names of the functions that
+// may not be used under the given allow and deny lists, or nil
+// if there are no restrictions.
+func forbiddenFunctions(registry map[string]reflect.Value, allow, deny []string) map[string]bool {
+
+	m := map[string]bool{}
+
+	if allow != nil {
+		allowed := make(map[string]bool, len(allow))
+		for _, name := range allow {
+			allowed[name] = true
+		}
+
+		for _, name := range functionNames(registry) {
+			if !allowed[name] {
+				m[name] = true
+			}
+		}
+	}
+
+	for _, name := range deny {
+		m[name] = true
+	}
+
+	if len(m) == 0 {
+		return nil
+	}
+
+	return m
+}
+
+// functionNames returns the names of the functions that are
+// available to an expression with the given registry.
+func functionNames(registry map[string]reflect.Value) []string {
+
+	names := make([]string, 0, len(standardFunctions)+len(registry)+3)
+	for name := range standardFunctions {
+		names = append(names, name)
+	}
+
+	names = append(names, "eval", "millis", "now")
+
+	for name, v := range registry {
+		if _, ok := jtypes.AsCallable(v); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// checkFunctionPolicy returns a *FunctionPolicyError for the
+// first variable in the syntax tree that refers to a forbidden
+// function. The syntax tree is parsed from expr.
+func checkFunctionPolicy(node jparse.Node, expr string, forbidden map[string]bool) error {
+
+	if len(forbidden) == 0 {
+		return nil
+	}
+
+	var err error
+
+	jparse.Walk(node, func(node jparse.Node) bool {
+		if err != nil {
+			return false
+		}
+		if v, ok := node.(*jparse.VariableNode); ok && forbidden[v.Name] {
+			err = &FunctionPolicyError{
+				Func: v.Name,
+			}
+			setErrorLocation(err, v, expr)
+		}
+		return err == nil
+	})
+
+	return err
+}
+
+// checkEvalPolicy is like checkFunctionPolicy but it looks up
+// variables in an environment. It is used by $eval, which can
+// only see forbidden functions through the placeholders bound
+// by bindForbidden.
+func checkEvalPolicy(node jparse.Node, expr string, env *environment) error {
+
+	var err error
+
+	jparse.Walk(node, func(node jparse.Node) bool {
+		if err != nil {
+			return false
+		}
+		if v, ok := node.(*jparse.VariableNode); ok {
+			if f, ok := asForbidden(env.lookup(v.Name)); ok {
+				err = &FunctionPolicyError{
+					Func: f.Name(),
+				}
+				setErrorLocation(err, v, expr)
+			}
+		}
+		return err == nil
+	})
+
+	return err
+}
+
+// bindForbidden replaces the forbidden functions in env with
+// placeholders that fail when called.
+func bindForbidden(env *environment, forbidden map[string]bool) {
+	for name := range forbidden {
+		env.bind(name, reflect.ValueOf(&forbiddenCallable{
+			callableName: callableName{
+				name: name,
+			},
+		}))
+	}
+}
+
+// A forbiddenCallable stands in for a function that is not
+// allowed by CompileOptions. References to forbidden functions
+// are normally rejected before evaluation, so Call is only a
+// safeguard.
+type forbiddenCallable struct {
+	callableName
+	callableMarshaler
+}
+
+func asForbidden(v reflect.Value) (*forbiddenCallable, bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, false
+	}
+	f, ok := v.Interface().(*forbiddenCallable)
+	return f, ok
+}
+
+func (f *forbiddenCallable) ParamCount() int {
+	return 0
+}
+
+func (f *forbiddenCallable) Call([]reflect.Value) (reflect.Value, error) {
+	return undefined, &FunctionPolicyError{
+		Func: f.Name(),
+	}
+}
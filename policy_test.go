@@ -0,0 +1,216 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompileWithOptions(t *testing.T) {
+
+	r := NewRegistry()
+	err := r.RegisterExts(map[string]Extension{
+		"secret": {
+			Func: func() string { return "secret" },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Expression string
+		Options    CompileOptions
+		Output     interface{}
+		Error      error
+	}{
+		{
+			Expression: `$random()`,
+			Options: CompileOptions{
+				DenyFunctions: []string{"random"},
+			},
+			Error: &FunctionPolicyError{
+				Func: "random",
+				Location: &Location{
+					Expr:  `$random()`,
+					Start: 0,
+					End:   7,
+				},
+			},
+		},
+		{
+			// Functions are forbidden even if they are not called.
+			Expression: `$map([1, 2], $shuffle)`,
+			Options: CompileOptions{
+				DenyFunctions: []string{"shuffle"},
+			},
+			Error: &FunctionPolicyError{
+				Func: "shuffle",
+				Location: &Location{
+					Expr:  `$map([1, 2], $shuffle)`,
+					Start: 13,
+					End:   21,
+				},
+			},
+		},
+		{
+			Expression: `$uppercase("x") & $secret()`,
+			Options: CompileOptions{
+				Registry:      r,
+				DenyFunctions: []string{"secret"},
+			},
+			Error: &FunctionPolicyError{
+				Func: "secret",
+				Location: &Location{
+					Expr:  `$uppercase("x") & $secret()`,
+					Start: 18,
+					End:   25,
+				},
+			},
+		},
+		{
+			Expression: `$uppercase("x") & $secret()`,
+			Options: CompileOptions{
+				Registry:       r,
+				AllowFunctions: []string{"uppercase"},
+			},
+			Error: &FunctionPolicyError{
+				Func: "secret",
+				Location: &Location{
+					Expr:  `$uppercase("x") & $secret()`,
+					Start: 18,
+					End:   25,
+				},
+			},
+		},
+		{
+			Expression: `$uppercase("x") & $secret()`,
+			Options: CompileOptions{
+				Registry:       r,
+				AllowFunctions: []string{"uppercase", "secret"},
+			},
+			Output: "Xsecret",
+		},
+		{
+			// Variables that are not functions are not affected
+			// by AllowFunctions.
+			Expression: `($x := 1; $sum([$x, 2]))`,
+			Options: CompileOptions{
+				Registry:       r,
+				AllowFunctions: []string{"sum"},
+			},
+			Output: float64(3),
+		},
+		{
+			Expression: `$sum([1, 2])`,
+			Options: CompileOptions{
+				Registry:       r,
+				AllowFunctions: []string{"sum"},
+				DenyFunctions:  []string{"sum"},
+			},
+			Error: &FunctionPolicyError{
+				Func: "sum",
+				Location: &Location{
+					Expr:  `$sum([1, 2])`,
+					Start: 0,
+					End:   4,
+				},
+			},
+		},
+		{
+			Expression: `$eval("1 + 1")`,
+			Options: CompileOptions{
+				Registry:      r,
+				DenyFunctions: []string{"eval"},
+			},
+			Error: &FunctionPolicyError{
+				Func: "eval",
+				Location: &Location{
+					Expr:  `$eval("1 + 1")`,
+					Start: 0,
+					End:   5,
+				},
+			},
+		},
+		{
+			// Expressions evaluated by $eval are checked
+			// when they are evaluated.
+			Expression: `$eval("1 + $random()")`,
+			Options: CompileOptions{
+				Registry:      r,
+				DenyFunctions: []string{"random"},
+			},
+			Error: &FunctionPolicyError{
+				Func: "random",
+				Location: &Location{
+					Expr:  `1 + $random()`,
+					Start: 4,
+					End:   11,
+				},
+			},
+		},
+		{
+			Expression: `$eval("$secret()")`,
+			Options: CompileOptions{
+				Registry:       r,
+				AllowFunctions: []string{"eval"},
+			},
+			Error: &FunctionPolicyError{
+				Func: "secret",
+				Location: &Location{
+					Expr:  `$secret()`,
+					Start: 0,
+					End:   7,
+				},
+			},
+		},
+		{
+			Expression: `$eval("$string(1)")`,
+			Options: CompileOptions{
+				Registry:       r,
+				AllowFunctions: []string{"eval", "string"},
+			},
+			Output: "1",
+		},
+	}
+
+	for _, test := range tests {
+
+		var output interface{}
+
+		e, err := CompileWithOptions(test.Expression, test.Options)
+		if err == nil {
+			output, err = e.Eval(nil)
+		}
+
+		if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("%s: expected output %v, got %v", test.Expression, test.Output, output)
+		}
+
+		if !reflect.DeepEqual(err, test.Error) {
+			t.Errorf("%s: expected error %v, got %v", test.Expression, test.Error, err)
+		}
+	}
+}
+
+func TestCompileWithOptionsDefaultRegistry(t *testing.T) {
+
+	// Without any restrictions, CompileWithOptions behaves
+	// like Compile.
+	e, err := CompileWithOptions(`$string($random() < 1)`, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := e.Eval(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output != "true" {
+		t.Errorf("expected %q, got %v", "true", output)
+	}
+}
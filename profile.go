@@ -0,0 +1,472 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stepzen-dev/jsonata-go/jparse"
+	"github.com/stepzen-dev/jsonata-go/jtypes"
+)
+
+// A Profiler collects statistics about the evaluation of
+// expressions. Set EvalOptions.Profiler to profile an
+// evaluation. Statistics are collected for each node of
+// the expression's syntax tree and for each function that
+// is called, whether it is a built-in function, a custom
+// function or a lambda defined in the expression.
+//
+// A Profiler can be shared by multiple evaluations, including
+// concurrent ones. The statistics from all of them are added
+// together.
+type Profiler struct {
+	mu        sync.Mutex
+	start     time.Time
+	nodes     map[jparse.Node]*ProfileEntry
+	functions map[string]*ProfileEntry
+	samples   map[string]*profileSample
+	locations map[jparse.Node]uint64
+}
+
+// A ProfileEntry holds the statistics for a node or a function.
+type ProfileEntry struct {
+
+	// Name is the source text of the node (as returned by its
+	// String method) or the name of the function.
+	Name string
+
+	// Calls is the number of times the node was evaluated or
+	// the function was called.
+	Calls int
+
+	// Time is the total time spent evaluating the node or
+	// running the function, including the time spent in any
+	// subexpressions. Recursive evaluations of a node, or
+	// recursive calls to a function, are included in the time
+	// of the outermost one and are not counted again.
+	Time time.Duration
+
+	// ResultSize is the total number of items produced by
+	// the node or function. Arrays count as one item per
+	// element, undefined results count as zero, and all
+	// other values count as one.
+	ResultSize int
+}
+
+// A profileSample records the time spent in a node, excluding
+// its subexpressions, for a particular stack of nodes. Samples
+// are used to generate pprof output.
+type profileSample struct {
+	stack []uint64
+	calls int64
+	self  time.Duration
+}
+
+// A profileFrame is an entry in the stack of nodes currently
+// being evaluated.
+type profileFrame struct {
+	node  jparse.Node
+	start time.Time
+	child time.Duration
+}
+
+// NewProfiler returns a new Profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		start:     time.Now(),
+		nodes:     map[jparse.Node]*ProfileEntry{},
+		functions: map[string]*ProfileEntry{},
+		samples:   map[string]*profileSample{},
+		locations: map[jparse.Node]uint64{},
+	}
+}
+
+// Nodes returns the statistics for each node that has been
+// evaluated, ordered by time, from slowest to fastest. Nodes
+// with the same source text are combined into one entry.
+func (p *Profiler) Nodes() []ProfileEntry {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := map[string]*ProfileEntry{}
+	for node, e := range p.nodes {
+		name := node.String()
+		if m[name] == nil {
+			m[name] = &ProfileEntry{
+				Name: name,
+			}
+		}
+		m[name].add(*e)
+	}
+
+	return sortEntries(m)
+}
+
+// Functions returns the statistics for each function that
+// has been called, ordered by time, from slowest to fastest.
+func (p *Profiler) Functions() []ProfileEntry {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return sortEntries(p.functions)
+}
+
+// WriteReport writes a plain text report of the statistics
+// for nodes and functions to w.
+func (p *Profiler) WriteReport(w io.Writer) error {
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	write := func(title string, entries []ProfileEntry) {
+		fmt.Fprintf(tw, "%s\tCalls\tTime\tResult Size\t\n", title)
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t\n", e.Name, e.Calls, e.Time, e.ResultSize)
+		}
+	}
+
+	write("Function", p.Functions())
+	fmt.Fprintln(tw, "\t\t\t\t")
+	write("Node", p.Nodes())
+
+	return tw.Flush()
+}
+
+// WritePprof writes the node statistics to w in the gzipped
+// protocol buffer format used by pprof. Each node appears as
+// a function, named with its source text, so the usual pprof
+// views (top, tree, flame graphs) show the time spent in each
+// part of the expression. The profile has two sample types:
+// the number of evaluations and the time spent.
+func (p *Profiler) WritePprof(w io.Writer) error {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b pprofBuilder
+
+	b.valueType(1, "calls", "count")
+	b.valueType(1, "time", "nanoseconds")
+
+	keys := make([]string, 0, len(p.samples))
+	for k := range p.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := p.samples[k]
+
+		// pprof stacks start with the innermost frame.
+		stack := make([]uint64, len(s.stack))
+		for i, id := range s.stack {
+			stack[len(stack)-1-i] = id
+		}
+
+		b.sample(stack, s.calls, int64(s.self))
+	}
+
+	nodes := make([]jparse.Node, len(p.locations))
+	for node, id := range p.locations {
+		nodes[id-1] = node
+	}
+
+	for i, node := range nodes {
+		id := uint64(i + 1)
+		b.location(id, id)
+		b.function(id, node.String())
+	}
+
+	b.int64(9, p.start.UnixNano())
+	b.int64(10, int64(time.Since(p.start)))
+	b.valueType(11, "time", "nanoseconds")
+	b.int64(12, 1)
+
+	// The string table must come last, once all of the
+	// strings have been added to it.
+	for _, s := range b.strings {
+		b.buf = appendString(b.buf, 6, s)
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b.buf); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+func (e *ProfileEntry) add(e2 ProfileEntry) {
+	e.Calls += e2.Calls
+	e.Time += e2.Time
+	e.ResultSize += e2.ResultSize
+}
+
+func sortEntries(m map[string]*ProfileEntry) []ProfileEntry {
+
+	entries := make([]ProfileEntry, 0, len(m))
+	for _, e := range m {
+		entries = append(entries, *e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Time != entries[j].Time {
+			return entries[i].Time > entries[j].Time
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries
+}
+
+// recordNode adds the evaluation of the last node in stack
+// to the statistics. If recursive is true, the node is also
+// further up the stack, which already accounts for the time
+// taken.
+func (p *Profiler) recordNode(stack []profileFrame, elapsed time.Duration, size int, recursive bool) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f := stack[len(stack)-1]
+
+	e := p.nodes[f.node]
+	if e == nil {
+		e = &ProfileEntry{}
+		p.nodes[f.node] = e
+	}
+	total := elapsed
+	if recursive {
+		total = 0
+	}
+	e.add(ProfileEntry{
+		Calls:      1,
+		Time:       total,
+		ResultSize: size,
+	})
+
+	ids := make([]uint64, len(stack))
+	key := make([]byte, 0, len(stack)*2)
+	for i, f := range stack {
+		id, ok := p.locations[f.node]
+		if !ok {
+			id = uint64(len(p.locations) + 1)
+			p.locations[f.node] = id
+		}
+		ids[i] = id
+		key = binary.AppendUvarint(key, id)
+	}
+
+	s := p.samples[string(key)]
+	if s == nil {
+		s = &profileSample{
+			stack: ids,
+		}
+		p.samples[string(key)] = s
+	}
+	s.calls++
+	s.self += elapsed - f.child
+}
+
+// recordFunction adds a call to the named function to the
+// statistics. Recursive calls are handled as in recordNode.
+func (p *Profiler) recordFunction(name string, elapsed time.Duration, size int, recursive bool) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e := p.functions[name]
+	if e == nil {
+		e = &ProfileEntry{
+			Name: name,
+		}
+		p.functions[name] = e
+	}
+	total := elapsed
+	if recursive {
+		total = 0
+	}
+	e.add(ProfileEntry{
+		Calls:      1,
+		Time:       total,
+		ResultSize: size,
+	})
+}
+
+// profiler returns the Profiler for this evaluation, if any.
+// It is safe to call on a nil evalState.
+func (s *evalState) profiler() *Profiler {
+	if s == nil {
+		return nil
+	}
+	return s.opts.Profiler
+}
+
+// profileEnter records the start of the evaluation of a node.
+// Each call to profileEnter must be paired with a call to
+// profileExit.
+func (s *evalState) profileEnter(node jparse.Node) {
+	s.frames = append(s.frames, profileFrame{
+		node:  node,
+		start: time.Now(),
+	})
+}
+
+// profileExit records the end of the evaluation of a node.
+func (s *evalState) profileExit(v reflect.Value) {
+
+	n := len(s.frames) - 1
+	elapsed := time.Since(s.frames[n].start)
+
+	recursive := false
+	for _, f := range s.frames[:n] {
+		if f.node == s.frames[n].node {
+			recursive = true
+			break
+		}
+	}
+
+	s.opts.Profiler.recordNode(s.frames, elapsed, resultSize(v), recursive)
+
+	s.frames = s.frames[:n]
+	if n > 0 {
+		s.frames[n-1].child += elapsed
+	}
+}
+
+// profileCallStart records the start of a call to the named
+// function and returns the start time. Each call to
+// profileCallStart must be paired with a call to profileCall.
+func (s *evalState) profileCallStart(name string) time.Time {
+	if s.calls == nil {
+		s.calls = map[string]int{}
+	}
+	s.calls[name]++
+	return time.Now()
+}
+
+// profileCall records a call to the named function that
+// started at the given time.
+func (s *evalState) profileCall(name string, start time.Time, v reflect.Value) {
+	if p := s.profiler(); p != nil {
+		s.calls[name]--
+		p.recordFunction(name, time.Since(start), resultSize(v), s.calls[name] > 0)
+	}
+}
+
+func resultSize(v reflect.Value) int {
+	switch {
+	case v == undefined:
+		return 0
+	case jtypes.IsArray(v):
+		return jtypes.Resolve(v).Len()
+	default:
+		return 1
+	}
+}
+
+// A pprofBuilder encodes a profile in the protocol buffer
+// format described at
+//
+//	https://github.com/google/pprof/blob/main/proto/profile.proto
+type pprofBuilder struct {
+	buf     []byte
+	strings []string
+	index   map[string]int64
+}
+
+// str returns the index of s in the string table, adding it
+// if necessary. The first entry in the table is always the
+// empty string.
+func (b *pprofBuilder) str(s string) int64 {
+
+	if b.index == nil {
+		b.strings = []string{""}
+		b.index = map[string]int64{"": 0}
+	}
+
+	i, ok := b.index[s]
+	if !ok {
+		i = int64(len(b.strings))
+		b.strings = append(b.strings, s)
+		b.index[s] = i
+	}
+
+	return i
+}
+
+func (b *pprofBuilder) valueType(field int, typ, unit string) {
+	var msg []byte
+	msg = appendVarint(msg, 1, uint64(b.str(typ)))
+	msg = appendVarint(msg, 2, uint64(b.str(unit)))
+	b.buf = appendBytes(b.buf, field, msg)
+}
+
+func (b *pprofBuilder) sample(stack []uint64, values ...int64) {
+
+	var ids, vals []byte
+	for _, id := range stack {
+		ids = binary.AppendUvarint(ids, id)
+	}
+	for _, v := range values {
+		vals = binary.AppendUvarint(vals, uint64(v))
+	}
+
+	var msg []byte
+	msg = appendBytes(msg, 1, ids)
+	msg = appendBytes(msg, 2, vals)
+	b.buf = appendBytes(b.buf, 2, msg)
+}
+
+func (b *pprofBuilder) location(id, functionID uint64) {
+
+	var line []byte
+	line = appendVarint(line, 1, functionID)
+
+	var msg []byte
+	msg = appendVarint(msg, 1, id)
+	msg = appendBytes(msg, 4, line)
+	b.buf = appendBytes(b.buf, 4, msg)
+}
+
+func (b *pprofBuilder) function(id uint64, name string) {
+	var msg []byte
+	msg = appendVarint(msg, 1, id)
+	msg = appendVarint(msg, 2, uint64(b.str(name)))
+	msg = appendVarint(msg, 3, uint64(b.str(name)))
+	msg = appendVarint(msg, 4, uint64(b.str("jsonata")))
+	b.buf = appendBytes(b.buf, 5, msg)
+}
+
+func (b *pprofBuilder) int64(field int, v int64) {
+	b.buf = appendVarint(b.buf, field, uint64(v))
+}
+
+// appendVarint appends a varint field to a protocol buffer.
+func appendVarint(buf []byte, field int, v uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3)
+	return binary.AppendUvarint(buf, v)
+}
+
+// appendBytes appends a length-delimited field to a protocol
+// buffer.
+func appendBytes(buf []byte, field int, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|2)
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func appendString(buf []byte, field int, s string) []byte {
+	return appendBytes(buf, field, []byte(s))
+}
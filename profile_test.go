@@ -0,0 +1,231 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestProfiler(t *testing.T) {
+
+	data := map[string]interface{}{
+		"Product": []interface{}{
+			map[string]interface{}{"Price": 1.5, "Quantity": 2.0},
+			map[string]interface{}{"Price": 2.5, "Quantity": 1.0},
+			map[string]interface{}{"Price": 3.5, "Quantity": 4.0},
+		},
+	}
+
+	e := MustCompile(`(
+		$double := function($x) { $x * 2 };
+		{
+			"total": $sum(Product.(Price * Quantity)),
+			"doubled": $map(Product.Quantity, $double)
+		}
+	)`)
+
+	p := NewProfiler()
+
+	// Statistics from multiple evaluations are added together.
+	for i := 0; i < 2; i++ {
+		_, err := e.EvalWithOptions(context.Background(), data, EvalOptions{
+			Profiler: p,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	functions := map[string]ProfileEntry{}
+	for _, e := range p.Functions() {
+		functions[e.Name] = e
+	}
+
+	tests := []struct {
+		Name       string
+		Calls      int
+		ResultSize int
+	}{
+		{
+			Name:       "sum",
+			Calls:      2,
+			ResultSize: 2,
+		},
+		{
+			Name:       "map",
+			Calls:      2,
+			ResultSize: 6,
+		},
+		{
+			// The lambda is called by $map, so it does not
+			// have a name.
+			Name:       "lambda",
+			Calls:      6,
+			ResultSize: 6,
+		},
+	}
+
+	for _, test := range tests {
+		got := functions[test.Name]
+		if got.Calls != test.Calls || got.ResultSize != test.ResultSize {
+			t.Errorf("function %s: expected %d calls and result size %d, got %d and %d",
+				test.Name, test.Calls, test.ResultSize, got.Calls, got.ResultSize)
+		}
+	}
+
+	nodes := map[string]ProfileEntry{}
+	for _, e := range p.Nodes() {
+		nodes[e.Name] = e
+	}
+
+	tests = []struct {
+		Name       string
+		Calls      int
+		ResultSize int
+	}{
+		{
+			Name:       "Price * Quantity",
+			Calls:      6,
+			ResultSize: 6,
+		},
+		{
+			Name:       "Product.(Price * Quantity)",
+			Calls:      2,
+			ResultSize: 6,
+		},
+	}
+
+	for _, test := range tests {
+		got := nodes[test.Name]
+		if got.Calls != test.Calls || got.ResultSize != test.ResultSize {
+			t.Errorf("node %s: expected %d calls and result size %d, got %d and %d",
+				test.Name, test.Calls, test.ResultSize, got.Calls, got.ResultSize)
+		}
+	}
+
+	// Nodes are sorted by time so the root node, which
+	// includes the time for all other nodes, comes first.
+	if all := p.Nodes(); all[0].Name != e.String() {
+		t.Errorf("expected the root node to be the slowest, got %s", all[0].Name)
+	}
+
+	var report bytes.Buffer
+	if err := p.WriteReport(&report); err != nil {
+		t.Fatalf("WriteReport: %s", err)
+	}
+
+	for _, s := range []string{"Function", "Node", "Price * Quantity", "lambda"} {
+		if !strings.Contains(report.String(), s) {
+			t.Errorf("expected report to contain %q", s)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatalf("WritePprof: %s", err)
+	}
+
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip: %s", err)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("gzip: %s", err)
+	}
+
+	// The node names are in the profile's string table.
+	for _, s := range []string{"calls", "nanoseconds", "Price * Quantity", "$x * 2"} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("expected profile to contain %q", s)
+		}
+	}
+}
+
+func TestProfilerTailCalls(t *testing.T) {
+
+	e := MustCompile(`(
+		$fact := function($n, $acc) { $n <= 1 ? $acc : $fact($n - 1, $acc * $n) };
+		$fact(5, 1)
+	)`)
+
+	p := NewProfiler()
+
+	output, err := e.EvalWithOptions(context.Background(), nil, EvalOptions{
+		Profiler: p,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if output != float64(120) {
+		t.Errorf("expected 120, got %v", output)
+	}
+
+	// The conditional is in tail position, but it should
+	// still be profiled on every call.
+	var found bool
+	for _, e := range p.Nodes() {
+		if strings.HasPrefix(e.Name, "$n <= 1 ?") {
+			found = true
+			if e.Calls != 5 {
+				t.Errorf("node %s: expected 5 calls, got %d", e.Name, e.Calls)
+			}
+		}
+	}
+
+	if !found {
+		t.Error("expected the conditional to be profiled")
+	}
+}
+
+func TestProfilerRecursion(t *testing.T) {
+
+	e := MustCompile(`(
+		$fact := function($n) { $n <= 1 ? 1 : $n * $fact($n - 1) };
+		$fact(50)
+	)`)
+
+	p := NewProfiler()
+
+	_, err := e.EvalWithOptions(context.Background(), nil, EvalOptions{
+		Profiler: p,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var root, cond ProfileEntry
+	for _, e := range p.Nodes() {
+		switch {
+		case strings.HasPrefix(e.Name, "($fact"):
+			root = e
+		case strings.HasPrefix(e.Name, "$n <= 1 ?"):
+			cond = e
+		}
+	}
+
+	if cond.Calls != 50 {
+		t.Errorf("expected 50 evaluations of the conditional, got %d", cond.Calls)
+	}
+
+	// Recursive evaluations are counted once, so no node or
+	// function can take longer than the whole expression.
+	if cond.Time > root.Time {
+		t.Errorf("conditional took %s, longer than the expression (%s)", cond.Time, root.Time)
+	}
+
+	for _, f := range p.Functions() {
+		if f.Name == "fact" && f.Time > root.Time {
+			t.Errorf("$fact took %s, longer than the expression (%s)", f.Time, root.Time)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// ErrRegistryFrozen is returned when adding functions or
+// variables to a Registry that has been frozen.
+var ErrRegistryFrozen = errors.New("registry is frozen")
+
+// defaultRegistry holds the functions and variables registered
+// with the package level RegisterExts and RegisterVars. It is
+// used by Compile.
+var defaultRegistry = NewRegistry()
+
+// A Registry is a set of custom functions and variables that
+// can be made available to JSONata expressions. Pass a Registry
+// to CompileWith to create expressions that use it.
+//
+// A Registry is typically built once, on program startup, and
+// then frozen. Expressions compiled with a frozen Registry share
+// its contents without copying them. Registries that are not
+// frozen are copied by CompileWith, so changes made after an
+// expression is compiled do not affect that expression.
+//
+// A Registry is safe for concurrent use by multiple goroutines.
+type Registry struct {
+	mu     sync.RWMutex
+	values map[string]reflect.Value
+	frozen bool
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// RegisterExts adds custom functions to the Registry. If the
+// Registry is frozen, RegisterExts returns ErrRegistryFrozen.
+func (r *Registry) RegisterExts(exts map[string]Extension) error {
+
+	values, err := processExts(exts)
+	if err != nil {
+		return err
+	}
+
+	return r.update(values)
+}
+
+// RegisterVars adds custom variables to the Registry. If the
+// Registry is frozen, RegisterVars returns ErrRegistryFrozen.
+func (r *Registry) RegisterVars(vars map[string]interface{}) error {
+
+	values, err := processVars(vars)
+	if err != nil {
+		return err
+	}
+
+	return r.update(values)
+}
+
+// Freeze prevents further changes to the Registry. Once a
+// Registry is frozen, calls to RegisterExts and RegisterVars
+// return ErrRegistryFrozen.
+func (r *Registry) Freeze() {
+	r.mu.Lock()
+	r.frozen = true
+	r.mu.Unlock()
+}
+
+// Frozen reports whether the Registry has been frozen.
+func (r *Registry) Frozen() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.frozen
+}
+
+func (r *Registry) update(values map[string]reflect.Value) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.frozen {
+		return ErrRegistryFrozen
+	}
+
+	for name, v := range values {
+		if r.values == nil {
+			r.values = make(map[string]reflect.Value, len(values))
+		}
+		r.values[name] = v
+	}
+
+	return nil
+}
+
+// snapshot returns the contents of the Registry. The returned
+// map must not be modified.
+func (r *Registry) snapshot() map[string]reflect.Value {
+
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// The values of a frozen Registry never change so they
+	// can be shared.
+	if r.frozen {
+		return r.values
+	}
+
+	return mergeValues(nil, r.values)
+}
+
+// mergeValues returns a new map containing the contents of
+// both m1 and m2. If a name appears in both maps, the value
+// from m2 is used.
+func mergeValues(m1, m2 map[string]reflect.Value) map[string]reflect.Value {
+
+	if len(m1)+len(m2) == 0 {
+		return nil
+	}
+
+	m := make(map[string]reflect.Value, len(m1)+len(m2))
+
+	for name, v := range m1 {
+		m[name] = v
+	}
+
+	for name, v := range m2 {
+		m[name] = v
+	}
+
+	return m
+}
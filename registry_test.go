@@ -0,0 +1,176 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stepzen-dev/jsonata-go/jtypes"
+)
+
+func TestRegistry(t *testing.T) {
+
+	r := NewRegistry()
+
+	must(t, "Exts", r.RegisterExts(map[string]Extension{
+		"shout": {
+			Func: strings.ToUpper,
+		},
+	}))
+
+	must(t, "Vars", r.RegisterVars(map[string]interface{}{
+		"greeting": "hello",
+	}))
+
+	e1, err := CompileWith(`$shout($greeting) & $exists($name)`, r)
+	if err != nil {
+		t.Fatalf("CompileWith: %s", err)
+	}
+
+	// Changes to an unfrozen Registry do not affect
+	// expressions that have already been compiled.
+	must(t, "Vars", r.RegisterVars(map[string]interface{}{
+		"name": "world",
+	}))
+
+	r.Freeze()
+
+	if !r.Frozen() {
+		t.Errorf("expected registry to be frozen")
+	}
+
+	e2, err := CompileWith(`$shout($greeting & " " & $name)`, r)
+	if err != nil {
+		t.Fatalf("CompileWith: %s", err)
+	}
+
+	tests := []struct {
+		Expr   *Expr
+		Output interface{}
+	}{
+		{
+			Expr:   e1,
+			Output: "HELLOfalse",
+		},
+		{
+			Expr:   e2,
+			Output: "HELLO WORLD",
+		},
+	}
+
+	for _, test := range tests {
+
+		output, err := test.Expr.Eval(nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.Expr, err)
+		}
+		if output != test.Output {
+			t.Errorf("%s: expected output %v, got %v", test.Expr, test.Output, output)
+		}
+	}
+
+	err = r.RegisterVars(map[string]interface{}{
+		"name": "everyone",
+	})
+	if err != ErrRegistryFrozen {
+		t.Errorf("expected error %v, got %v", ErrRegistryFrozen, err)
+	}
+
+	err = r.RegisterExts(map[string]Extension{
+		"whisper": {
+			Func: strings.ToLower,
+		},
+	})
+	if err != ErrRegistryFrozen {
+		t.Errorf("expected error %v, got %v", ErrRegistryFrozen, err)
+	}
+}
+
+func TestCompileWithNilRegistry(t *testing.T) {
+
+	must(t, "Vars", RegisterVars(map[string]interface{}{
+		"registryTestVar": "global",
+	}))
+
+	e, err := CompileWith(`$registryTestVar`, nil)
+	if err != nil {
+		t.Fatalf("CompileWith: %s", err)
+	}
+
+	_, err = e.Eval(nil)
+	if err != ErrUndefined {
+		t.Errorf("expected error %v, got %v", ErrUndefined, err)
+	}
+
+	e = MustCompile(`$registryTestVar`)
+
+	output, err := e.Eval(nil)
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if output != "global" {
+		t.Errorf("expected output %q, got %v", "global", output)
+	}
+}
+
+func TestConcurrentEval(t *testing.T) {
+
+	r := NewRegistry()
+
+	// prefix uses the evaluation context when called with
+	// a single argument.
+	must(t, "Exts", r.RegisterExts(map[string]Extension{
+		"prefix": {
+			Func: func(s string, prefix string) string {
+				return prefix + s
+			},
+			EvalContextHandler: jtypes.ArgCountEquals(1),
+		},
+	}))
+
+	r.Freeze()
+
+	e, err := CompileWith(`items.($ ~> $prefix($user & ":"))`, r)
+	if err != nil {
+		t.Fatalf("CompileWith: %s", err)
+	}
+
+	data := map[string]interface{}{
+		"items": []interface{}{"a", "b", "c"},
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			user := fmt.Sprintf("user%d", i)
+
+			for j := 0; j < 10; j++ {
+				output, err := e.EvalWithBindings(data, map[string]interface{}{
+					"user": user,
+				})
+				if err != nil {
+					t.Errorf("%s: unexpected error %v", user, err)
+					return
+				}
+
+				exp := []interface{}{user + ":a", user + ":b", user + ":c"}
+				if !reflect.DeepEqual(output, exp) {
+					t.Errorf("%s: expected output %v, got %v", user, exp, output)
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/stepzen-dev/jsonata-go/jtypes"
+)
+
+// An evalState holds the settings and bookkeeping for a single
+// evaluation of an Expr. It is shared by every environment
+// created during that evaluation (see newEnvironment). The
+// counters are updated atomically because parts of an
+// evaluation may run in parallel (see EvalOptions.Parallelism).
+type evalState struct {
+	ctx  context.Context
+	done <-chan struct{}
+	opts EvalOptions
+
+	depth atomic.Int64
+	steps atomic.Int64
+
+	// parallel is set while an array is being processed by
+	// several goroutines (see workers).
+	parallel atomic.Bool
+
+	// frames is the stack of nodes being evaluated and calls
+	// counts the calls in progress to each function. They are
+	// only used when profiling.
+	frames []profileFrame
+	calls  map[string]int
+}
+
+func newEvalState(ctx context.Context, opts EvalOptions) *evalState {
+	return &evalState{
+		ctx:  ctx,
+		done: ctx.Done(),
+		opts: opts,
+	}
+}
+
+// context returns the context.Context for this evaluation.
+// It is safe to call on a nil evalState.
+func (s *evalState) context() context.Context {
+	if s == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// checkCancel returns an error if the evaluation's context has
+// been cancelled or its deadline has passed. It's called at path
+// steps, lambda calls and other loops so that a long-running
+// expression can be stopped. It is safe to call on a nil
+// evalState.
+func (s *evalState) checkCancel() error {
+	if s == nil || s.done == nil {
+		return nil
+	}
+
+	select {
+	case <-s.done:
+		return newCancelError(s.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// enter records the start of a call to the named function. It
+// returns an error if the call would exceed the maximum depth
+// set in EvalOptions. Each successful call to enter must be
+// paired with a call to exit. It is safe to call on a nil
+// evalState.
+func (s *evalState) enter(name string) error {
+	if s == nil {
+		return nil
+	}
+
+	depth := s.depth.Add(1)
+	if s.opts.MaxDepth > 0 && depth > int64(s.opts.MaxDepth) {
+		s.depth.Add(-1)
+		return newEvalError(ErrMaxDepth, name, strconv.Itoa(s.opts.MaxDepth))
+	}
+
+	return nil
+}
+
+// exit records the end of a function call started by enter.
+func (s *evalState) exit() {
+	if s != nil {
+		s.depth.Add(-1)
+	}
+}
+
+// step records the evaluation of a single node. It returns an
+// error if the evaluation has exceeded the maximum number of
+// steps set in EvalOptions. It is safe to call on a nil
+// evalState.
+func (s *evalState) step() error {
+	if s == nil {
+		return nil
+	}
+
+	steps := s.steps.Add(1)
+	if s.opts.MaxSteps > 0 && steps > int64(s.opts.MaxSteps) {
+		return newEvalError(ErrMaxSteps, nil, strconv.Itoa(s.opts.MaxSteps))
+	}
+
+	return nil
+}
+
+// decimal reports whether decimal arithmetic is enabled. It
+// is safe to call on a nil evalState.
+func (s *evalState) decimal() bool {
+	return s != nil && s.opts.Decimal
+}
+
+// tracer returns the Tracer for this evaluation, if any. It
+// is safe to call on a nil evalState.
+func (s *evalState) tracer() Tracer {
+	if s == nil {
+		return nil
+	}
+	return s.opts.Tracer
+}
+
+// checkSize returns an error if v is an array with more items
+// than the maximum result size set in EvalOptions. It is safe
+// to call on a nil evalState.
+func (s *evalState) checkSize(v reflect.Value) error {
+	if s == nil || s.opts.MaxResultSize <= 0 {
+		return nil
+	}
+
+	if jtypes.IsArray(v) {
+		return s.checkLen(jtypes.Resolve(v).Len())
+	}
+
+	return nil
+}
+
+// checkLen returns an error if n exceeds the maximum result
+// size set in EvalOptions. It is safe to call on a nil
+// evalState.
+func (s *evalState) checkLen(n int) error {
+	if s == nil || s.opts.MaxResultSize <= 0 {
+		return nil
+	}
+
+	if n > s.opts.MaxResultSize {
+		return newEvalError(ErrMaxResultSize, nil, strconv.Itoa(s.opts.MaxResultSize))
+	}
+
+	return nil
+}
+
+// newCancelError converts a context error into an EvalError.
+func newCancelError(err error) *EvalError {
+	if err == context.DeadlineExceeded {
+		return newEvalError(ErrDeadlineExceeded, nil, nil)
+	}
+	return newEvalError(ErrCanceled, nil, nil)
+}
+
+// isContextError reports whether err is one of the errors
+// returned by context.Context.Err.
+func isContextError(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}